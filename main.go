@@ -19,6 +19,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/zxh326/kite/internal"
+	"github.com/zxh326/kite/pkg/alert"
 	"github.com/zxh326/kite/pkg/auth"
 	"github.com/zxh326/kite/pkg/cluster"
 	"github.com/zxh326/kite/pkg/common"
@@ -114,6 +115,13 @@ func setupAPIRouter(r *gin.RouterGroup, cm *cluster.ClusterManager) {
 	adminAPI.Use(authHandler.RequireAuth(), authHandler.RequireAdmin())
 	{
 		adminAPI.GET("/audit-logs", handlers.ListAuditLogs)
+		recordingAPI := adminAPI.Group("/terminal-recordings")
+		{
+			recordingAPI.GET("/", handlers.ListTerminalRecordings)
+			recordingAPI.GET("/:id", handlers.GetTerminalRecording)
+			recordingAPI.GET("/:id/cast", handlers.GetTerminalRecordingCast)
+			recordingAPI.DELETE("/:id", handlers.DeleteTerminalRecording)
+		}
 		oauthProviderAPI := adminAPI.Group("/oauth-providers")
 		{
 			oauthProviderAPI.GET("/", authHandler.ListOAuthProviders)
@@ -127,7 +135,9 @@ func setupAPIRouter(r *gin.RouterGroup, cm *cluster.ClusterManager) {
 		{
 			clusterAPI.GET("/", cm.GetClusterList)
 			clusterAPI.POST("/", cm.CreateCluster)
+			clusterAPI.POST("/kubeconfig/import", cm.ImportKubeconfigs)
 			clusterAPI.PUT("/:id", cm.UpdateCluster)
+			clusterAPI.PUT("/:id/credentials", cm.RotateClusterCredentials)
 			clusterAPI.DELETE("/:id", cm.DeleteCluster)
 		}
 
@@ -160,6 +170,27 @@ func setupAPIRouter(r *gin.RouterGroup, cm *cluster.ClusterManager) {
 			apiKeyAPI.DELETE("/:id", handlers.DeleteAPIKey)
 		}
 
+		alertAPI := adminAPI.Group("/alerts")
+		{
+			alertAPI.GET("/", handlers.ListActiveAlerts)
+			alertAPI.GET("/notifications", handlers.ListAlertNotifications)
+
+			alertAPI.GET("/rules", handlers.ListAlertRules)
+			alertAPI.POST("/rules", handlers.CreateAlertRule)
+			alertAPI.PUT("/rules/:id", handlers.UpdateAlertRule)
+			alertAPI.DELETE("/rules/:id", handlers.DeleteAlertRule)
+
+			alertAPI.GET("/targets", handlers.ListAlertTargets)
+			alertAPI.POST("/targets", handlers.CreateAlertTarget)
+			alertAPI.PUT("/targets/:id", handlers.UpdateAlertTarget)
+			alertAPI.DELETE("/targets/:id", handlers.DeleteAlertTarget)
+			alertAPI.POST("/targets/:id/test", handlers.TestAlertTarget)
+
+			alertAPI.GET("/silences", handlers.ListAlertSilences)
+			alertAPI.POST("/silences", handlers.CreateAlertSilence)
+			alertAPI.DELETE("/silences/:id", handlers.ExpireAlertSilence)
+		}
+
 		templateAPI := adminAPI.Group("/templates")
 		{
 			templateAPI.POST("/", handlers.CreateTemplate)
@@ -171,6 +202,13 @@ func setupAPIRouter(r *gin.RouterGroup, cm *cluster.ClusterManager) {
 	// API routes group (protected)
 	api := r.Group("/api/v1")
 	api.GET("/clusters", authHandler.RequireAuth(), cm.GetClusters)
+	// Span several clusters, so they do not use the ClusterMiddleware
+	multiClusterHandler := handlers.NewMultiClusterHandler(cm)
+	api.GET("/multicluster/:resource", authHandler.RequireAuth(), multiClusterHandler.List)
+	diffHandler := handlers.NewDiffHandler(cm)
+	api.POST("/diff", authHandler.RequireAuth(), diffHandler.Diff)
+	promoteHandler := handlers.NewPromoteHandler(cm)
+	api.POST("/promote", authHandler.RequireAuth(), promoteHandler.Promote)
 	api.Use(authHandler.RequireAuth(), middleware.ClusterMiddleware(cm))
 	{
 		api.GET("/overview", handlers.GetOverview)
@@ -181,6 +219,8 @@ func setupAPIRouter(r *gin.RouterGroup, cm *cluster.ClusterManager) {
 
 		logsHandler := handlers.NewLogsHandler()
 		api.GET("/logs/:namespace/:podName/ws", logsHandler.HandleLogsWebSocket)
+		api.GET("/logs/:namespace/_workload/:kind/:name/ws", logsHandler.HandleWorkloadLogsWebSocket)
+		api.GET("/logs/:namespace/:podName/download", logsHandler.DownloadLogs)
 
 		terminalHandler := handlers.NewTerminalHandler()
 		api.GET("/terminal/:namespace/:podName/ws", terminalHandler.HandleTerminalWebSocket)
@@ -188,6 +228,11 @@ func setupAPIRouter(r *gin.RouterGroup, cm *cluster.ClusterManager) {
 		nodeTerminalHandler := handlers.NewNodeTerminalHandler()
 		api.GET("/node-terminal/:nodeName/ws", nodeTerminalHandler.HandleNodeTerminalWebSocket)
 
+		// Checks event access per namespace, so users limited to some namespaces can stream too.
+		// "-" is not a valid namespace name, so the route cannot shadow a namespace
+		eventHandler := resources.NewEventHandler()
+		api.GET("/events/-/stream", eventHandler.StreamClusterEvents)
+
 		searchHandler := handlers.NewSearchHandler()
 		api.GET("/search", searchHandler.GlobalSearch)
 
@@ -229,12 +274,14 @@ func main() {
 	model.InitDB()
 	rbac.InitRBAC()
 	handlers.InitTemplates()
+	handlers.InitTerminalRecording()
 	internal.LoadConfigFromEnv()
 
 	cm, err := cluster.NewClusterManager()
 	if err != nil {
 		log.Fatalf("Failed to create ClusterManager: %v", err)
 	}
+	alert.Start(cm)
 
 	base := r.Group(common.Base)
 	// Setup router
@@ -0,0 +1,263 @@
+package alert
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/zxh326/kite/pkg/model"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultPVCThreshold         = 85
+	defaultCertificateThreshold = 14
+	// crashLoopRestartWindow is how long a restarted container that is not
+	// ready counts as crashlooping. It is longer than the kubelet's maximum
+	// back-off of 5 minutes, so a crashlooping container that is briefly
+	// running between restarts is still matched.
+	crashLoopRestartWindow = 10 * time.Minute
+)
+
+// pvcUsageSource reports the used fraction of PVCs keyed by namespace/name
+type pvcUsageSource interface {
+	GetPVCUsage(ctx context.Context) (map[string]float64, error)
+}
+
+// clusterSource is what conditions read from a cluster. Objects come from the
+// informer cache, Secrets are read live so they are never cached.
+type clusterSource struct {
+	name      string
+	cache     client.Reader
+	clientset kubernetes.Interface
+	// prometheus is nil when the cluster has no Prometheus
+	prometheus pvcUsageSource
+	// err is set when the cluster is not available, e.g. still connecting
+	err error
+}
+
+// finding is a matching object, since is when the condition started if the
+// object records it, otherwise the time it was first seen is used
+type finding struct {
+	namespace string
+	kind      string
+	name      string
+	detail    string
+	message   string
+	since     time.Time
+}
+
+type conditionFunc func(ctx context.Context, src *clusterSource, rule *model.AlertRule, now time.Time) ([]finding, error)
+
+var conditions = map[string]conditionFunc{
+	model.AlertConditionCrashLoop:             crashLoopCondition,
+	model.AlertConditionNodeNotReady:          nodeNotReadyCondition,
+	model.AlertConditionDeploymentUnavailable: deploymentUnavailableCondition,
+	model.AlertConditionPVCAlmostFull:         pvcAlmostFullCondition,
+	model.AlertConditionCertificateExpiry:     certificateExpiryCondition,
+}
+
+// IsValidCondition reports whether condition is a known alert condition
+func IsValidCondition(condition string) bool {
+	_, ok := conditions[condition]
+	return ok
+}
+
+// inScope reports whether value is allowed by a rule scope list, an empty
+// list or "*" allows everything
+func inScope(list model.SliceString, value string) bool {
+	empty := true
+	for _, v := range list {
+		if v == "" {
+			continue
+		}
+		empty = false
+		if v == "*" || v == value {
+			return true
+		}
+	}
+	return empty
+}
+
+func crashLoopCondition(ctx context.Context, src *clusterSource, rule *model.AlertRule, now time.Time) ([]finding, error) {
+	var pods corev1.PodList
+	if err := src.cache.List(ctx, &pods); err != nil {
+		return nil, err
+	}
+	var findings []finding
+	for _, pod := range pods.Items {
+		if !inScope(rule.Namespaces, pod.Namespace) {
+			continue
+		}
+		statuses := slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses)
+		for _, status := range statuses {
+			if !isCrashLooping(status, now) {
+				continue
+			}
+			findings = append(findings, finding{
+				namespace: pod.Namespace,
+				kind:      "Pod",
+				name:      pod.Name,
+				detail:    status.Name,
+				message: fmt.Sprintf("Container %s of pod %s/%s is in CrashLoopBackOff, restarted %d times",
+					status.Name, pod.Namespace, pod.Name, status.RestartCount),
+			})
+		}
+	}
+	return findings, nil
+}
+
+// isCrashLooping reports whether a container is in CrashLoopBackOff, or is
+// running between two restarts of a crash loop
+func isCrashLooping(status corev1.ContainerStatus, now time.Time) bool {
+	if status.State.Waiting != nil {
+		return status.State.Waiting.Reason == "CrashLoopBackOff"
+	}
+	last := status.LastTerminationState.Terminated
+	return status.State.Running != nil && !status.Ready && last != nil &&
+		now.Sub(last.FinishedAt.Time) < crashLoopRestartWindow
+}
+
+func nodeNotReadyCondition(ctx context.Context, src *clusterSource, _ *model.AlertRule, _ time.Time) ([]finding, error) {
+	var nodes corev1.NodeList
+	if err := src.cache.List(ctx, &nodes); err != nil {
+		return nil, err
+	}
+	var findings []finding
+	for _, node := range nodes.Items {
+		for _, cond := range node.Status.Conditions {
+			if cond.Type != corev1.NodeReady || cond.Status == corev1.ConditionTrue {
+				continue
+			}
+			findings = append(findings, finding{
+				kind:    "Node",
+				name:    node.Name,
+				message: fmt.Sprintf("Node %s is not ready: %s %s", node.Name, cond.Reason, cond.Message),
+				since:   cond.LastTransitionTime.Time,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func deploymentUnavailableCondition(ctx context.Context, src *clusterSource, rule *model.AlertRule, _ time.Time) ([]finding, error) {
+	var deployments appsv1.DeploymentList
+	if err := src.cache.List(ctx, &deployments); err != nil {
+		return nil, err
+	}
+	var findings []finding
+	for _, d := range deployments.Items {
+		if !inScope(rule.Namespaces, d.Namespace) {
+			continue
+		}
+		if d.Spec.Replicas != nil && *d.Spec.Replicas == 0 {
+			continue
+		}
+		for _, cond := range d.Status.Conditions {
+			if cond.Type != appsv1.DeploymentAvailable || cond.Status != corev1.ConditionFalse {
+				continue
+			}
+			findings = append(findings, finding{
+				namespace: d.Namespace,
+				kind:      "Deployment",
+				name:      d.Name,
+				message: fmt.Sprintf("Deployment %s/%s is unavailable, %d of %d replicas available: %s",
+					d.Namespace, d.Name, d.Status.AvailableReplicas, d.Status.Replicas, cond.Message),
+				since: cond.LastTransitionTime.Time,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func pvcAlmostFullCondition(ctx context.Context, src *clusterSource, rule *model.AlertRule, _ time.Time) ([]finding, error) {
+	if src.prometheus == nil {
+		return nil, fmt.Errorf("PVC usage needs Prometheus, which is not configured for cluster %s", src.name)
+	}
+	usage, err := src.prometheus.GetPVCUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	threshold := rule.Threshold
+	if threshold <= 0 {
+		threshold = defaultPVCThreshold
+	}
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := src.cache.List(ctx, &pvcs); err != nil {
+		return nil, err
+	}
+	var findings []finding
+	for _, pvc := range pvcs.Items {
+		if !inScope(rule.Namespaces, pvc.Namespace) {
+			continue
+		}
+		used, ok := usage[pvc.Namespace+"/"+pvc.Name]
+		if !ok || used*100 < threshold {
+			continue
+		}
+		findings = append(findings, finding{
+			namespace: pvc.Namespace,
+			kind:      "PersistentVolumeClaim",
+			name:      pvc.Name,
+			message:   fmt.Sprintf("PVC %s/%s is %.1f%% full", pvc.Namespace, pvc.Name, used*100),
+		})
+	}
+	return findings, nil
+}
+
+func certificateExpiryCondition(ctx context.Context, src *clusterSource, rule *model.AlertRule, now time.Time) ([]finding, error) {
+	secrets, err := src.clientset.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: "type=" + string(corev1.SecretTypeTLS),
+	})
+	if err != nil {
+		return nil, err
+	}
+	days := rule.Threshold
+	if days <= 0 {
+		days = defaultCertificateThreshold
+	}
+	deadline := now.Add(time.Duration(days * float64(24*time.Hour)))
+	var findings []finding
+	for _, secret := range secrets.Items {
+		if !inScope(rule.Namespaces, secret.Namespace) {
+			continue
+		}
+		cert := parseCertificate(secret.Data[corev1.TLSCertKey])
+		if cert == nil || cert.NotAfter.After(deadline) {
+			continue
+		}
+		message := fmt.Sprintf("Certificate %s in secret %s/%s expires at %s",
+			cert.Subject.CommonName, secret.Namespace, secret.Name, cert.NotAfter.UTC().Format(time.RFC3339))
+		if cert.NotAfter.Before(now) {
+			message = fmt.Sprintf("Certificate %s in secret %s/%s expired at %s",
+				cert.Subject.CommonName, secret.Namespace, secret.Name, cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+		findings = append(findings, finding{
+			namespace: secret.Namespace,
+			kind:      "Secret",
+			name:      secret.Name,
+			message:   message,
+		})
+	}
+	return findings, nil
+}
+
+// parseCertificate returns the leaf certificate of a PEM bundle
+func parseCertificate(data []byte) *x509.Certificate {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return cert
+}
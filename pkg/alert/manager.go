@@ -0,0 +1,356 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zxh326/kite/pkg/cluster"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// AlertStatusPending is the status of an alert whose condition holds for less than the rule's duration
+const AlertStatusPending = "pending"
+
+// Alert is one object matching a rule in one cluster
+type Alert struct {
+	Fingerprint string     `json:"fingerprint"`
+	RuleID      uint       `json:"ruleId"`
+	Rule        string     `json:"rule"`
+	Cluster     string     `json:"cluster"`
+	Namespace   string     `json:"namespace,omitempty"`
+	Kind        string     `json:"kind"`
+	Name        string     `json:"name"`
+	Message     string     `json:"message"`
+	Status      string     `json:"status"`
+	Silenced    bool       `json:"silenced,omitempty"`
+	ActiveSince time.Time  `json:"activeSince"`
+	FiredAt     *time.Time `json:"firedAt,omitempty"`
+	ResolvedAt  *time.Time `json:"resolvedAt,omitempty"`
+}
+
+type alertState struct {
+	alert Alert
+	// notified is set once a firing notification was accepted by a target,
+	// only those alerts send a resolved notification
+	notified     bool
+	lastNotified time.Time
+}
+
+// Manager evaluates the alert rules periodically. Alert state is kept in
+// memory, after a restart firing alerts are notified again.
+type Manager struct {
+	// sources returns the clusters to evaluate the rules in and a function
+	// releasing them
+	sources func(rules []model.AlertRule) ([]*clusterSource, func())
+	client  *http.Client
+
+	mu     sync.Mutex
+	states map[string]*alertState
+}
+
+var defaultManager *Manager
+
+// Start evaluates the alert rules against the clusters of cm every ALERT_EVALUATION_INTERVAL
+func Start(cm *cluster.ClusterManager) {
+	defaultManager = &Manager{
+		sources: func(rules []model.AlertRule) ([]*clusterSource, func()) { return clusterSources(cm, rules) },
+		client:  &http.Client{},
+		states:  map[string]*alertState{},
+	}
+	go func() {
+		ticker := time.NewTicker(common.AlertEvaluationInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			defaultManager.run(context.Background())
+		}
+	}()
+}
+
+// ActiveAlerts returns the pending and firing alerts, nil before Start
+func ActiveAlerts() []Alert {
+	if defaultManager == nil {
+		return nil
+	}
+	return defaultManager.activeAlerts()
+}
+
+// clusterSources acquires the clusters targeted by an enabled rule. Acquiring
+// connects idle clusters and keeps them from being disconnected; a cluster
+// that is still connecting is evaluated on a later run.
+func clusterSources(cm *cluster.ClusterManager, rules []model.AlertRule) ([]*clusterSource, func()) {
+	var sources []*clusterSource
+	var releases []func()
+	for _, name := range cm.ClusterNames() {
+		if !slices.ContainsFunc(rules, func(rule model.AlertRule) bool { return inScope(rule.Clusters, name) }) {
+			continue
+		}
+		cs, release, err := cm.AcquireClientSet(name)
+		if err != nil {
+			sources = append(sources, &clusterSource{name: name, err: err})
+			continue
+		}
+		releases = append(releases, release)
+		src := &clusterSource{
+			name:      cs.Name,
+			cache:     cs.K8sClient.Client,
+			clientset: cs.K8sClient.ClientSet,
+		}
+		if cs.PromClient != nil {
+			src.prometheus = cs.PromClient
+		}
+		sources = append(sources, src)
+	}
+	return sources, func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+}
+
+func (m *Manager) run(ctx context.Context) {
+	rules, err := model.ListEnabledAlertRules()
+	if err != nil {
+		klog.Errorf("Failed to list alert rules: %v", err)
+		return
+	}
+	now := time.Now()
+	silences, err := model.ListActiveAlertSilences(now)
+	if err != nil {
+		klog.Warningf("Failed to list alert silences: %v", err)
+	}
+	sources, release := m.sources(rules)
+	notifications := m.evaluate(ctx, rules, silences, sources, now)
+	release()
+	rulesByID := make(map[uint]*model.AlertRule, len(rules))
+	for i := range rules {
+		rulesByID[rules[i].ID] = &rules[i]
+	}
+	for _, n := range notifications {
+		if m.deliver(ctx, rulesByID[n.RuleID], n) && n.Status == model.AlertStatusFiring {
+			m.markNotified(n)
+		}
+	}
+	if common.AlertNotificationMaxRecords > 0 {
+		if n, err := model.TrimAlertNotifications(common.AlertNotificationMaxRecords); err != nil {
+			klog.Errorf("Failed to trim alert notifications: %v", err)
+		} else if n > 0 {
+			klog.V(1).Infof("Deleted %d alert notifications over the limit", n)
+		}
+	}
+}
+
+// markNotified marks the alerts of a delivered firing notification as
+// notified. Alerts of undelivered notifications are notified again on the
+// next evaluation.
+func (m *Manager) markNotified(n *Notification) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range n.Alerts {
+		if state, ok := m.states[a.Fingerprint]; ok {
+			state.notified = true
+			state.lastNotified = n.SentAt
+		}
+	}
+}
+
+// evaluate updates the alert state and returns the notifications to send,
+// grouped by rule, cluster and status
+func (m *Manager) evaluate(ctx context.Context, rules []model.AlertRule, silences []model.AlertSilence, sources []*clusterSource, now time.Time) []*Notification {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := map[string]bool{}
+	// evaluated holds rule/cluster pairs that were evaluated successfully,
+	// alerts of failed evaluations are kept as they are
+	evaluated := map[string]bool{}
+	groups := map[string]*Notification{}
+	addToGroup := func(rule *model.AlertRule, clusterName, status string, a Alert) {
+		key := fmt.Sprintf("%d/%s/%s", rule.ID, clusterName, status)
+		n, ok := groups[key]
+		if !ok {
+			n = &Notification{
+				Status:    status,
+				GroupKey:  fmt.Sprintf("%d/%s", rule.ID, clusterName),
+				RuleID:    rule.ID,
+				Rule:      rule.Name,
+				Condition: rule.Condition,
+				Severity:  rule.Severity,
+				Cluster:   clusterName,
+				SentAt:    now,
+			}
+			groups[key] = n
+		}
+		n.Alerts = append(n.Alerts, a)
+	}
+
+	activeRules := map[uint]*model.AlertRule{}
+	for i := range rules {
+		rule := &rules[i]
+		activeRules[rule.ID] = rule
+		condition, ok := conditions[rule.Condition]
+		if !ok {
+			klog.Warningf("Alert rule %s has unknown condition %s", rule.Name, rule.Condition)
+			continue
+		}
+		for _, src := range sources {
+			if !inScope(rule.Clusters, src.name) {
+				continue
+			}
+			if src.err != nil {
+				// The alerts of the cluster are kept until it can be evaluated
+				klog.V(1).Infof("Skipping alert rule %s in cluster %s: %v", rule.Name, src.name, src.err)
+				continue
+			}
+			findings, err := condition(ctx, src, rule, now)
+			if err != nil {
+				klog.Warningf("Failed to evaluate alert rule %s in cluster %s: %v", rule.Name, src.name, err)
+				continue
+			}
+			evaluated[fmt.Sprintf("%d/%s", rule.ID, src.name)] = true
+			for _, f := range findings {
+				fingerprint := strings.Join([]string{fmt.Sprint(rule.ID), src.name, f.namespace, f.kind, f.name, f.detail}, "/")
+				seen[fingerprint] = true
+				state, ok := m.states[fingerprint]
+				if !ok {
+					since := now
+					if !f.since.IsZero() && f.since.Before(now) {
+						since = f.since
+					}
+					state = &alertState{alert: Alert{
+						Fingerprint: fingerprint,
+						RuleID:      rule.ID,
+						Rule:        rule.Name,
+						Cluster:     src.name,
+						Namespace:   f.namespace,
+						Kind:        f.kind,
+						Name:        f.name,
+						Status:      AlertStatusPending,
+						ActiveSince: since,
+					}}
+					m.states[fingerprint] = state
+				}
+				state.alert.Message = f.message
+				state.alert.Silenced = isSilenced(silences, rule.ID, &state.alert)
+
+				if state.alert.Status == AlertStatusPending && now.Sub(state.alert.ActiveSince) >= time.Duration(rule.ForMinutes)*time.Minute {
+					firedAt := now
+					state.alert.Status = model.AlertStatusFiring
+					state.alert.FiredAt = &firedAt
+				}
+				if state.alert.Status != model.AlertStatusFiring || state.alert.Silenced {
+					continue
+				}
+				repeatDue := rule.RepeatMinutes > 0 && now.Sub(state.lastNotified) >= time.Duration(rule.RepeatMinutes)*time.Minute
+				if !state.notified || repeatDue {
+					addToGroup(rule, src.name, model.AlertStatusFiring, state.alert)
+				}
+			}
+		}
+	}
+
+	for fingerprint, state := range m.states {
+		if seen[fingerprint] {
+			continue
+		}
+		rule, ok := activeRules[state.alert.RuleID]
+		if !ok {
+			// The rule was deleted or disabled
+			delete(m.states, fingerprint)
+			continue
+		}
+		if !evaluated[fmt.Sprintf("%d/%s", state.alert.RuleID, state.alert.Cluster)] {
+			if !slices.ContainsFunc(sources, func(s *clusterSource) bool { return s.name == state.alert.Cluster }) {
+				delete(m.states, fingerprint)
+			}
+			continue
+		}
+		delete(m.states, fingerprint)
+		if state.notified {
+			resolvedAt := now
+			resolved := state.alert
+			resolved.Status = model.AlertStatusResolved
+			resolved.ResolvedAt = &resolvedAt
+			addToGroup(rule, resolved.Cluster, model.AlertStatusResolved, resolved)
+		}
+	}
+
+	notifications := make([]*Notification, 0, len(groups))
+	for _, n := range groups {
+		slices.SortFunc(n.Alerts, func(a, b Alert) int { return strings.Compare(a.Fingerprint, b.Fingerprint) })
+		notifications = append(notifications, n)
+	}
+	slices.SortFunc(notifications, func(a, b *Notification) int {
+		return strings.Compare(a.GroupKey+a.Status, b.GroupKey+b.Status)
+	})
+	return notifications
+}
+
+func isSilenced(silences []model.AlertSilence, ruleID uint, a *Alert) bool {
+	for _, s := range silences {
+		if (s.RuleID == 0 || s.RuleID == ruleID) &&
+			(s.Cluster == "" || s.Cluster == a.Cluster) &&
+			(s.Namespace == "" || s.Namespace == a.Namespace) &&
+			(s.Name == "" || s.Name == a.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver sends a notification to the enabled targets of the rule and records
+// the result. It reports whether at least one target accepted the notification.
+func (m *Manager) deliver(ctx context.Context, rule *model.AlertRule, n *Notification) bool {
+	if rule == nil {
+		return false
+	}
+	delivered := false
+	payload, _ := json.Marshal(n)
+	for i := range rule.Targets {
+		target := &rule.Targets[i]
+		if !target.Enabled {
+			continue
+		}
+		record := &model.AlertNotification{
+			RuleID:     rule.ID,
+			RuleName:   rule.Name,
+			Cluster:    n.Cluster,
+			Status:     n.Status,
+			GroupKey:   n.GroupKey,
+			AlertCount: len(n.Alerts),
+			Payload:    string(payload),
+			TargetID:   target.ID,
+			TargetName: target.Name,
+			Success:    true,
+		}
+		if err := send(ctx, m.client, target, n); err != nil {
+			klog.Warningf("Failed to send %s notification of alert rule %s to %s: %v", n.Status, rule.Name, target.Name, err)
+			record.Success = false
+			record.Error = err.Error()
+		} else {
+			delivered = true
+		}
+		if err := model.AddAlertNotification(record); err != nil {
+			klog.Errorf("Failed to record alert notification: %v", err)
+		}
+	}
+	return delivered
+}
+
+func (m *Manager) activeAlerts() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	alerts := make([]Alert, 0, len(m.states))
+	for _, state := range m.states {
+		alerts = append(alerts, state.alert)
+	}
+	slices.SortFunc(alerts, func(a, b Alert) int { return a.ActiveSince.Compare(b.ActiveSince) })
+	return alerts
+}
@@ -0,0 +1,222 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/zxh326/kite/pkg/kube"
+	"github.com/zxh326/kite/pkg/model"
+	"gorm.io/gorm"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func crashLoopPod(name string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:         "app",
+			RestartCount: 4,
+			State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		}}},
+	}
+}
+
+func TestManagerEvaluate(t *testing.T) {
+	cache := fake.NewClientBuilder().WithScheme(kube.GetScheme()).
+		WithObjects(crashLoopPod("web-0"), crashLoopPod("web-1")).Build()
+	sources := []*clusterSource{{name: "c1", cache: cache}}
+	rule := model.AlertRule{Model: model.Model{ID: 1}, Name: "crash", Condition: model.AlertConditionCrashLoop, ForMinutes: 5}
+	rules := []model.AlertRule{rule}
+	m := &Manager{states: map[string]*alertState{}}
+	ctx := context.Background()
+	start := time.Now()
+
+	if n := m.evaluate(ctx, rules, nil, sources, start); len(n) != 0 {
+		t.Fatalf("pending alerts notified: %+v", n)
+	}
+	if alerts := m.activeAlerts(); len(alerts) != 2 || alerts[0].Status != AlertStatusPending {
+		t.Fatalf("activeAlerts() = %+v, want 2 pending", alerts)
+	}
+
+	// Both pods fire in one grouped notification once the duration has passed
+	n := m.evaluate(ctx, rules, nil, sources, start.Add(5*time.Minute))
+	if len(n) != 1 || n[0].Status != model.AlertStatusFiring || len(n[0].Alerts) != 2 {
+		t.Fatalf("evaluate() = %+v, want one firing group with 2 alerts", n)
+	}
+	// Undelivered alerts are notified again on the next evaluation
+	n = m.evaluate(ctx, rules, nil, sources, start.Add(5*time.Minute+30*time.Second))
+	if len(n) != 1 || len(n[0].Alerts) != 2 {
+		t.Fatalf("evaluate() = %+v, want the undelivered group again", n)
+	}
+	m.markNotified(n[0])
+	// Still firing alerts are not notified again once delivered
+	if n := m.evaluate(ctx, rules, nil, sources, start.Add(6*time.Minute)); len(n) != 0 {
+		t.Fatalf("duplicate notification: %+v", n)
+	}
+
+	// A recovered pod is resolved
+	if err := cache.Delete(ctx, crashLoopPod("web-1")); err != nil {
+		t.Fatal(err)
+	}
+	n = m.evaluate(ctx, rules, nil, sources, start.Add(7*time.Minute))
+	if len(n) != 1 || n[0].Status != model.AlertStatusResolved || n[0].Alerts[0].Name != "web-1" {
+		t.Fatalf("evaluate() = %+v, want web-1 resolved", n)
+	}
+
+	// Silenced alerts fire without a notification
+	if err := cache.Create(ctx, crashLoopPod("web-2")); err != nil {
+		t.Fatal(err)
+	}
+	silences := []model.AlertSilence{{Name: "web-2"}}
+	m.evaluate(ctx, rules, silences, sources, start.Add(8*time.Minute))
+	if n := m.evaluate(ctx, rules, silences, sources, start.Add(14*time.Minute)); len(n) != 0 {
+		t.Fatalf("silenced alert notified: %+v", n)
+	}
+	// and are notified once the silence ends
+	n = m.evaluate(ctx, rules, nil, sources, start.Add(15*time.Minute))
+	if len(n) != 1 || len(n[0].Alerts) != 1 || n[0].Alerts[0].Name != "web-2" {
+		t.Fatalf("evaluate() = %+v, want web-2 firing", n)
+	}
+	m.markNotified(n[0])
+
+	// Alerts of a cluster that is still connecting are kept, not resolved
+	unavailable := []*clusterSource{{name: "c1", err: errors.New("cluster is warming up")}}
+	if n := m.evaluate(ctx, rules, nil, unavailable, start.Add(15*time.Minute+30*time.Second)); len(n) != 0 || len(m.activeAlerts()) != 2 {
+		t.Fatalf("evaluate() of an unavailable cluster = %+v, active %d", n, len(m.activeAlerts()))
+	}
+
+	// Alerts of a removed rule are dropped without notification
+	if n := m.evaluate(ctx, nil, nil, sources, start.Add(16*time.Minute)); len(n) != 0 || len(m.activeAlerts()) != 0 {
+		t.Fatalf("evaluate() without rules = %+v, active %d", n, len(m.activeAlerts()))
+	}
+}
+
+func TestManagerEvaluateCrashLoopBetweenRestarts(t *testing.T) {
+	pod := crashLoopPod("web-0")
+	cache := fake.NewClientBuilder().WithScheme(kube.GetScheme()).WithObjects(pod).Build()
+	sources := []*clusterSource{{name: "c1", cache: cache}}
+	rules := []model.AlertRule{{Model: model.Model{ID: 1}, Name: "crash", Condition: model.AlertConditionCrashLoop, ForMinutes: 5}}
+	m := &Manager{states: map[string]*alertState{}}
+	ctx := context.Background()
+	start := time.Now()
+
+	// The container alternates between back-off and briefly running after each restart
+	setState := func(running bool, at time.Time) {
+		t.Helper()
+		current := &corev1.Pod{}
+		if err := cache.Get(ctx, client.ObjectKeyFromObject(pod), current); err != nil {
+			t.Fatal(err)
+		}
+		status := &current.Status.ContainerStatuses[0]
+		status.State = crashLoopPod("").Status.ContainerStatuses[0].State
+		if running {
+			status.State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(at)}}
+			status.LastTerminationState = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				ExitCode: 1, FinishedAt: metav1.NewTime(at.Add(-time.Second)),
+			}}
+		}
+		if err := cache.Status().Update(ctx, current); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		setState(i%2 == 1, at)
+		if n := m.evaluate(ctx, rules, nil, sources, at); len(n) != 0 {
+			t.Fatalf("evaluate() at minute %d = %+v, want no notification", i, n)
+		}
+	}
+	setState(true, start.Add(5*time.Minute))
+	n := m.evaluate(ctx, rules, nil, sources, start.Add(5*time.Minute))
+	if len(n) != 1 || n[0].Status != model.AlertStatusFiring {
+		t.Fatalf("evaluate() = %+v, want the crash loop firing", n)
+	}
+	m.markNotified(n[0])
+
+	// A container that has been ready since the restart is not crashlooping
+	current := &corev1.Pod{}
+	if err := cache.Get(ctx, client.ObjectKeyFromObject(pod), current); err != nil {
+		t.Fatal(err)
+	}
+	current.Status.ContainerStatuses[0].Ready = true
+	if err := cache.Status().Update(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	n = m.evaluate(ctx, rules, nil, sources, start.Add(6*time.Minute))
+	if len(n) != 1 || n[0].Status != model.AlertStatusResolved {
+		t.Fatalf("evaluate() = %+v, want the crash loop resolved", n)
+	}
+}
+
+func TestManagerDeliver(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.AlertNotification{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := model.DB
+	model.DB = db
+	t.Cleanup(func() { model.DB = prev })
+
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	rule := &model.AlertRule{Model: model.Model{ID: 1}, Name: "crash", Targets: []model.AlertTarget{
+		{Model: model.Model{ID: 1}, Name: "down", Type: model.AlertTargetWebhook, URL: "http://127.0.0.1:0", Enabled: true},
+		{Model: model.Model{ID: 2}, Name: "hook", Type: model.AlertTargetWebhook, URL: model.SecretString(server.URL), Enabled: true},
+	}}
+	m := &Manager{client: server.Client(), states: map[string]*alertState{}}
+	n := &Notification{Status: model.AlertStatusFiring, RuleID: 1, Alerts: []Alert{{Fingerprint: "a"}}}
+
+	if m.deliver(context.Background(), rule, n) {
+		t.Fatal("deliver() = true, want false when every target failed")
+	}
+	status = http.StatusOK
+	if !m.deliver(context.Background(), rule, n) {
+		t.Fatal("deliver() = false, want true when a target accepted")
+	}
+	var records []model.AlertNotification
+	if err := db.Order("id").Find(&records).Error; err != nil || len(records) != 4 {
+		t.Fatalf("records = %+v, %v, want 4", records, err)
+	}
+	if records[1].Success || !records[3].Success {
+		t.Errorf("unexpected delivery records: %+v", records)
+	}
+}
+
+func TestSendSlackNotification(t *testing.T) {
+	var got slackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	target := &model.AlertTarget{Type: model.AlertTargetSlack, URL: model.SecretString(server.URL)}
+	n := &Notification{
+		Status:  model.AlertStatusFiring,
+		Rule:    "crash",
+		Cluster: "c1",
+		Alerts:  []Alert{{Message: "pod web-0 is crashing"}},
+	}
+	if err := send(context.Background(), server.Client(), target, n); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+	if got.Text != "[FIRING:1] crash (cluster c1)" || len(got.Attachments) != 1 || got.Attachments[0].Color != "danger" {
+		t.Errorf("unexpected slack payload: %+v", got)
+	}
+}
@@ -0,0 +1,126 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zxh326/kite/pkg/model"
+)
+
+const (
+	notifyTimeout = 10 * time.Second
+	// maxSlackAlerts is the number of alerts listed in one Slack message
+	maxSlackAlerts = 20
+)
+
+// Notification is a group of alerts of one rule and cluster with the same status,
+// it is the payload of generic webhook targets
+type Notification struct {
+	Status    string    `json:"status"`
+	GroupKey  string    `json:"groupKey"`
+	RuleID    uint      `json:"ruleId"`
+	Rule      string    `json:"rule"`
+	Condition string    `json:"condition"`
+	Severity  string    `json:"severity,omitempty"`
+	Cluster   string    `json:"cluster"`
+	Alerts    []Alert   `json:"alerts"`
+	SentAt    time.Time `json:"sentAt"`
+}
+
+type slackAttachment struct {
+	Color string `json:"color"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+func (n *Notification) title() string {
+	return fmt.Sprintf("[%s:%d] %s (cluster %s)", strings.ToUpper(n.Status), len(n.Alerts), n.Rule, n.Cluster)
+}
+
+func (n *Notification) slackPayload() slackMessage {
+	color := "danger"
+	if n.Status == model.AlertStatusResolved {
+		color = "good"
+	}
+	var lines []string
+	for i, a := range n.Alerts {
+		if i == maxSlackAlerts {
+			lines = append(lines, fmt.Sprintf("... and %d more", len(n.Alerts)-maxSlackAlerts))
+			break
+		}
+		lines = append(lines, "• "+a.Message)
+	}
+	title := n.Rule
+	if n.Severity != "" {
+		title = fmt.Sprintf("%s [%s]", n.Rule, n.Severity)
+	}
+	return slackMessage{
+		Text:        n.title(),
+		Attachments: []slackAttachment{{Color: color, Title: title, Text: strings.Join(lines, "\n")}},
+	}
+}
+
+// send posts the notification to a target in the format of its type
+func send(ctx context.Context, httpClient *http.Client, target *model.AlertTarget, n *Notification) error {
+	var payload any = n
+	if target.Type == model.AlertTargetSlack {
+		payload = n.slackPayload()
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, string(target.URL), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// IsValidTargetType reports whether t is a supported target type
+func IsValidTargetType(t string) bool {
+	return t == model.AlertTargetWebhook || t == model.AlertTargetSlack
+}
+
+// SendTestNotification sends a sample firing notification to a target
+func SendTestNotification(ctx context.Context, target *model.AlertTarget) error {
+	now := time.Now()
+	n := &Notification{
+		Status:    model.AlertStatusFiring,
+		GroupKey:  "test",
+		Rule:      "Test notification",
+		Condition: "test",
+		Cluster:   "-",
+		Alerts: []Alert{{
+			Fingerprint: "test",
+			Status:      model.AlertStatusFiring,
+			Message:     "This is a test notification from Kite",
+			ActiveSince: now,
+		}},
+		SentAt: now,
+	}
+	return send(ctx, http.DefaultClient, target, n)
+}
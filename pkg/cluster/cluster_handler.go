@@ -3,42 +3,51 @@ package cluster
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/kube"
 	"github.com/zxh326/kite/pkg/model"
 	"github.com/zxh326/kite/pkg/rbac"
 	"gorm.io/gorm"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 func (cm *ClusterManager) GetClusters(c *gin.Context) {
-	result := make([]common.ClusterInfo, 0, len(cm.clusters))
+	selector, err := labels.Parse(c.Query("labelSelector"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid labelSelector: " + err.Error()})
+		return
+	}
+	snapshot := cm.load()
+	result := make([]common.ClusterInfo, 0, len(snapshot.configs))
 	user := c.MustGet("user").(model.User)
-	for name, cluster := range cm.clusters {
-		if !rbac.CanAccessCluster(user, name) {
+	for name, config := range snapshot.configs {
+		if !selector.Matches(labels.Set(config.Labels)) || !rbac.CanAccessCluster(user, name) {
 			continue
 		}
-		result = append(result, common.ClusterInfo{
+		info := common.ClusterInfo{
 			Name:      name,
-			Version:   cluster.Version,
-			IsDefault: name == cm.defaultContext,
-		})
-	}
-	for name, errMsg := range cm.errors {
-		if !rbac.CanAccessCluster(user, name) {
-			continue
+			IsDefault: name == snapshot.defaultContext,
+			Labels:    config.Labels,
+			State:     cm.state(snapshot, name),
 		}
-		result = append(result, common.ClusterInfo{
-			Name:      name,
-			Version:   "",
-			IsDefault: false,
-			Error:     errMsg,
-		})
+		if cluster, ok := snapshot.clusters[name]; ok {
+			info.Version = cluster.Version
+			info.Health = cluster.Health()
+		} else if errMsg, ok := snapshot.errors[name]; ok {
+			info.IsDefault = false
+			info.Error = errMsg
+		}
+		result = append(result, info)
 	}
 	sort.Slice(result, func(i, j int) bool {
 		return result[i].Name < result[j].Name
@@ -46,30 +55,73 @@ func (cm *ClusterManager) GetClusters(c *gin.Context) {
 	c.JSON(200, result)
 }
 
+// state returns the connection state of an enabled cluster
+func (cm *ClusterManager) state(s *clusterSnapshot, name string) string {
+	if _, ok := s.clusters[name]; ok {
+		return common.ClusterStateConnected
+	}
+	if cm.isConnecting(name) {
+		return common.ClusterStateConnecting
+	}
+	return common.ClusterStateIdle
+}
+
 func (cm *ClusterManager) GetClusterList(c *gin.Context) {
+	selector, err := labels.Parse(c.Query("labelSelector"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid labelSelector: " + err.Error()})
+		return
+	}
 	clusters, err := model.ListClusters()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	snapshot := cm.load()
 	result := make([]gin.H, 0, len(clusters))
 	for _, cluster := range clusters {
+		if !selector.Matches(labels.Set(cluster.Labels)) {
+			continue
+		}
 		clusterInfo := gin.H{
-			"id":            cluster.ID,
-			"name":          cluster.Name,
-			"description":   cluster.Description,
-			"enabled":       cluster.Enable,
-			"inCluster":     cluster.InCluster,
-			"isDefault":     cluster.IsDefault,
-			"prometheusURL": cluster.PrometheusURL,
-			"config":        "",
+			"id":                 cluster.ID,
+			"name":               cluster.Name,
+			"description":        cluster.Description,
+			"labels":             cluster.Labels,
+			"enabled":            cluster.Enable,
+			"inCluster":          cluster.InCluster,
+			"isDefault":          cluster.IsDefault,
+			"prometheusURL":      cluster.PrometheusURL,
+			"lokiURL":            cluster.LokiURL,
+			"execProtocol":       cluster.ExecProtocol,
+			"recordEvents":       cluster.RecordEvents,
+			"recordNormalEvents": cluster.RecordNormalEvents,
+			"alwaysOn":           cluster.AlwaysOn,
+			"config":             "",
+			"authType":           authType(cluster),
+			"server":             cluster.Server,
+			"proxyURL":           cluster.ProxyURL,
+			"proxyUsername":      cluster.ProxyUsername,
+			"tlsServerName":      cluster.TLSServerName,
+
+			"cacheNamespaces":         nonEmpty(cluster.CacheNamespaces),
+			"cacheUncachedResources":  nonEmpty(cluster.CacheUncachedResources),
+			"cacheStripManagedFields": cluster.CacheStripManagedFields,
+			"cacheMaxAnnotationSize":  cluster.CacheMaxAnnotationSize,
+		}
+		if cluster.Enable {
+			clusterInfo["state"] = cm.state(snapshot, cluster.Name)
+		}
+		if expiry := storedCredentialsExpiry(cluster); expiry != nil {
+			clusterInfo["credentialsExpireAt"] = expiry
 		}
 
-		if clientSet, exists := cm.clusters[cluster.Name]; exists {
+		if clientSet, exists := snapshot.clusters[cluster.Name]; exists {
 			clusterInfo["version"] = clientSet.Version
+			clusterInfo["health"] = clientSet.Health()
 		}
-		if errMsg, exists := cm.errors[cluster.Name]; exists {
+		if errMsg, exists := snapshot.errors[cluster.Name]; exists {
 			clusterInfo["error"] = errMsg
 		}
 
@@ -79,20 +131,191 @@ func (cm *ClusterManager) GetClusterList(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// validateClusterLabels checks that labels are valid Kubernetes labels
+func validateClusterLabels(clusterLabels map[string]string) error {
+	for key, value := range clusterLabels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid value of label %s: %s", key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// cacheRequest holds the informer cache settings of create and update
+// requests, settings that are not included keep their stored values
+type cacheRequest struct {
+	CacheNamespaces         []string `json:"cacheNamespaces"`
+	CacheUncachedResources  []string `json:"cacheUncachedResources"`
+	CacheStripManagedFields *bool    `json:"cacheStripManagedFields"`
+	CacheMaxAnnotationSize  *int     `json:"cacheMaxAnnotationSize"`
+}
+
+func (r *cacheRequest) validate() error {
+	if r.CacheMaxAnnotationSize != nil && *r.CacheMaxAnnotationSize < 0 {
+		return fmt.Errorf("cacheMaxAnnotationSize must not be negative")
+	}
+	return kube.ValidateCacheScope(&kube.CacheScope{Uncached: nonEmpty(r.CacheUncachedResources)})
+}
+
+// apply sets the included cache settings on cluster and returns the changed columns
+func (r *cacheRequest) apply(cluster *model.Cluster) map[string]interface{} {
+	updates := map[string]interface{}{}
+	if r.CacheNamespaces != nil {
+		cluster.CacheNamespaces = nonEmpty(r.CacheNamespaces)
+		updates["cache_namespaces"] = cluster.CacheNamespaces
+	}
+	if r.CacheUncachedResources != nil {
+		cluster.CacheUncachedResources = nonEmpty(r.CacheUncachedResources)
+		updates["cache_uncached_resources"] = cluster.CacheUncachedResources
+	}
+	if r.CacheStripManagedFields != nil {
+		cluster.CacheStripManagedFields = *r.CacheStripManagedFields
+		updates["cache_strip_managed_fields"] = cluster.CacheStripManagedFields
+	}
+	if r.CacheMaxAnnotationSize != nil {
+		cluster.CacheMaxAnnotationSize = *r.CacheMaxAnnotationSize
+		updates["cache_max_annotation_size"] = cluster.CacheMaxAnnotationSize
+	}
+	return updates
+}
+
+// credentialsRequest holds the structured credentials of create, update and
+// rotate requests, empty secrets keep the stored values
+type credentialsRequest struct {
+	AuthType   string `json:"authType"`
+	Server     string `json:"server"`
+	CAData     string `json:"caData"`
+	Token      string `json:"token"`
+	ClientCert string `json:"clientCert"`
+	ClientKey  string `json:"clientKey"`
+}
+
+// apply sets the given credentials on cluster and returns the changed columns
+func (r *credentialsRequest) apply(cluster *model.Cluster) map[string]interface{} {
+	updates := map[string]interface{}{}
+	if r.AuthType != "" {
+		cluster.AuthType = r.AuthType
+		updates["auth_type"] = r.AuthType
+	}
+	if r.Server != "" {
+		cluster.Server = strings.TrimRight(r.Server, "/")
+		updates["server"] = cluster.Server
+	}
+	secrets := []struct {
+		value  string
+		field  *model.SecretString
+		column string
+	}{
+		{r.CAData, &cluster.CAData, "ca_data"},
+		{r.Token, &cluster.Token, "token"},
+		{r.ClientCert, &cluster.ClientCert, "client_cert"},
+		{r.ClientKey, &cluster.ClientKey, "client_key"},
+	}
+	for _, secret := range secrets {
+		if secret.value != "" {
+			*secret.field = model.SecretString(secret.value)
+			updates[secret.column] = *secret.field
+		}
+	}
+	return updates
+}
+
+// networkRequest holds the proxy settings of create and update requests.
+// Settings that are not included keep their stored values, an empty
+// proxyPassword keeps the stored password of the same proxy user.
+type networkRequest struct {
+	ProxyURL      *string `json:"proxyURL"`
+	ProxyUsername *string `json:"proxyUsername"`
+	ProxyPassword *string `json:"proxyPassword"`
+	TLSServerName *string `json:"tlsServerName"`
+}
+
+// apply sets the included network settings on cluster and returns the changed columns
+func (r *networkRequest) apply(cluster *model.Cluster) map[string]interface{} {
+	updates := map[string]interface{}{}
+	if r.ProxyURL != nil {
+		cluster.ProxyURL = *r.ProxyURL
+		updates["proxy_url"] = cluster.ProxyURL
+	}
+	if r.ProxyUsername != nil {
+		if *r.ProxyUsername == "" || *r.ProxyUsername != cluster.ProxyUsername {
+			cluster.ProxyPassword = ""
+			updates["proxy_password"] = cluster.ProxyPassword
+		}
+		cluster.ProxyUsername = *r.ProxyUsername
+		updates["proxy_username"] = cluster.ProxyUsername
+	}
+	if r.ProxyPassword != nil && *r.ProxyPassword != "" {
+		cluster.ProxyPassword = model.SecretString(*r.ProxyPassword)
+		updates["proxy_password"] = cluster.ProxyPassword
+	}
+	if r.TLSServerName != nil {
+		cluster.TLSServerName = *r.TLSServerName
+		updates["tls_server_name"] = cluster.TLSServerName
+	}
+	return updates
+}
+
+func authType(cluster *model.Cluster) string {
+	if cluster.InCluster {
+		return ""
+	}
+	if cluster.AuthType == "" {
+		return model.ClusterAuthKubeconfig
+	}
+	return cluster.AuthType
+}
+
+// storedCredentialsExpiry returns when the stored credentials of a cluster expire
+func storedCredentialsExpiry(cluster *model.Cluster) *time.Time {
+	if cluster.InCluster {
+		return nil
+	}
+	config, err := restConfigForCluster(cluster)
+	if err != nil {
+		return nil
+	}
+	return credentialsExpiry(config)
+}
+
 func (cm *ClusterManager) CreateCluster(c *gin.Context) {
 	var req struct {
-		Name          string `json:"name" binding:"required"`
-		Description   string `json:"description"`
-		Config        string `json:"config"`
-		PrometheusURL string `json:"prometheusURL"`
-		InCluster     bool   `json:"inCluster"`
-		IsDefault     bool   `json:"isDefault"`
+		Name               string            `json:"name" binding:"required"`
+		Description        string            `json:"description"`
+		Labels             map[string]string `json:"labels"`
+		Config             string            `json:"config"`
+		PrometheusURL      string            `json:"prometheusURL"`
+		LokiURL            string            `json:"lokiURL"`
+		InCluster          bool              `json:"inCluster"`
+		IsDefault          bool              `json:"isDefault"`
+		ExecProtocol       string            `json:"execProtocol"`
+		RecordEvents       bool              `json:"recordEvents"`
+		RecordNormalEvents bool              `json:"recordNormalEvents"`
+		AlwaysOn           bool              `json:"alwaysOn"`
+		cacheRequest
+		credentialsRequest
+		networkRequest
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !kube.IsValidExecProtocol(req.ExecProtocol) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "execProtocol must be one of auto, websocket, spdy"})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateClusterLabels(req.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if _, err := model.GetClusterByName(req.Name); err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "cluster already exists"})
@@ -110,13 +333,30 @@ func (cm *ClusterManager) CreateCluster(c *gin.Context) {
 	}
 
 	cluster := &model.Cluster{
-		Name:          req.Name,
-		Description:   req.Description,
-		Config:        model.SecretString(req.Config),
-		PrometheusURL: req.PrometheusURL,
-		InCluster:     req.InCluster,
-		IsDefault:     req.IsDefault,
-		Enable:        true,
+		Name:               req.Name,
+		Description:        req.Description,
+		Labels:             req.Labels,
+		Config:             model.SecretString(req.Config),
+		PrometheusURL:      req.PrometheusURL,
+		LokiURL:            req.LokiURL,
+		InCluster:          req.InCluster,
+		IsDefault:          req.IsDefault,
+		Enable:             true,
+		ExecProtocol:       req.ExecProtocol,
+		RecordEvents:       req.RecordEvents,
+		RecordNormalEvents: req.RecordNormalEvents,
+		AlwaysOn:           req.AlwaysOn,
+	}
+	req.cacheRequest.apply(cluster)
+	req.credentialsRequest.apply(cluster)
+	req.networkRequest.apply(cluster)
+	if err := ValidateClusterCredentials(cluster); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := ValidateClusterNetwork(cluster); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	if err := model.AddCluster(cluster); err != nil {
@@ -141,19 +381,40 @@ func (cm *ClusterManager) UpdateCluster(c *gin.Context) {
 	}
 
 	var req struct {
-		Name          string `json:"name"`
-		Description   string `json:"description"`
-		Config        string `json:"config"`
-		PrometheusURL string `json:"prometheusURL"`
-		InCluster     bool   `json:"inCluster"`
-		IsDefault     bool   `json:"isDefault"`
-		Enabled       bool   `json:"enabled"`
+		Name               string            `json:"name"`
+		Description        string            `json:"description"`
+		Labels             map[string]string `json:"labels"`
+		Config             string            `json:"config"`
+		PrometheusURL      string            `json:"prometheusURL"`
+		LokiURL            *string           `json:"lokiURL"`
+		InCluster          bool              `json:"inCluster"`
+		IsDefault          bool              `json:"isDefault"`
+		Enabled            bool              `json:"enabled"`
+		ExecProtocol       *string           `json:"execProtocol"`
+		RecordEvents       *bool             `json:"recordEvents"`
+		RecordNormalEvents *bool             `json:"recordNormalEvents"`
+		AlwaysOn           *bool             `json:"alwaysOn"`
+		cacheRequest
+		credentialsRequest
+		networkRequest
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.ExecProtocol != nil && !kube.IsValidExecProtocol(*req.ExecProtocol) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "execProtocol must be one of auto, websocket, spdy"})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateClusterLabels(req.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	cluster, err := model.GetClusterByID(uint(id))
 	if err != nil {
@@ -180,12 +441,45 @@ func (cm *ClusterManager) UpdateCluster(c *gin.Context) {
 		"enable":         req.Enabled,
 	}
 
+	// Role cluster selectors match the labels, so they only change when included
+	if req.Labels != nil {
+		updates["labels"] = model.StringMap(req.Labels)
+	}
+	if req.LokiURL != nil {
+		updates["loki_url"] = *req.LokiURL
+	}
+	if req.ExecProtocol != nil {
+		updates["exec_protocol"] = *req.ExecProtocol
+	}
+	if req.RecordEvents != nil {
+		updates["record_events"] = *req.RecordEvents
+	}
+	if req.RecordNormalEvents != nil {
+		updates["record_normal_events"] = *req.RecordNormalEvents
+	}
+	if req.AlwaysOn != nil {
+		updates["always_on"] = *req.AlwaysOn
+	}
+
 	if req.Name != "" && req.Name != cluster.Name {
 		updates["name"] = req.Name
 	}
 
 	if req.Config != "" {
 		updates["config"] = model.SecretString(req.Config)
+		cluster.Config = model.SecretString(req.Config)
+	}
+	cluster.InCluster = req.InCluster
+	maps.Copy(updates, req.cacheRequest.apply(cluster))
+	maps.Copy(updates, req.credentialsRequest.apply(cluster))
+	maps.Copy(updates, req.networkRequest.apply(cluster))
+	if err := ValidateClusterCredentials(cluster); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := ValidateClusterNetwork(cluster); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	if err := model.UpdateCluster(cluster, updates); err != nil {
@@ -198,6 +492,69 @@ func (cm *ClusterManager) UpdateCluster(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "cluster updated successfully"})
 }
 
+// RotateClusterCredentials replaces the token, certificate, CA or kubeconfig
+// of a cluster. Sessions using the old credentials finish before they are dropped.
+func (cm *ClusterManager) RotateClusterCredentials(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cluster id"})
+		return
+	}
+
+	var req struct {
+		credentialsRequest
+		Config string `json:"config"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cluster, err := model.GetClusterByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cluster not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if cluster.InCluster {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "in-cluster clusters use the service account of Kite"})
+		return
+	}
+
+	updates := req.credentialsRequest.apply(cluster)
+	if req.Config != "" {
+		cluster.Config = model.SecretString(req.Config)
+		updates["config"] = cluster.Config
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no credentials given"})
+		return
+	}
+	if err := ValidateClusterCredentials(cluster); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := restConfigForCluster(cluster); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := model.UpdateCluster(cluster, updates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	syncNow <- struct{}{}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "cluster credentials updated successfully",
+		"credentialsExpireAt": storedCredentialsExpiry(cluster),
+	})
+}
+
 func (cm *ClusterManager) DeleteCluster(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
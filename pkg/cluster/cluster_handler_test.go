@@ -0,0 +1,148 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/kube"
+	"github.com/zxh326/kite/pkg/model"
+	"github.com/zxh326/kite/pkg/rbac"
+	"gorm.io/gorm"
+)
+
+// setupClusterDB stores cluster in an in-memory database
+func setupClusterDB(t *testing.T, cluster *model.Cluster) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Cluster{}))
+	prev := model.DB
+	model.DB = db
+	t.Cleanup(func() { model.DB = prev })
+	require.NoError(t, model.AddCluster(cluster))
+}
+
+func runUpdate(t *testing.T, id uint, body map[string]any) *model.Cluster {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(data))
+	c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(id)}}
+	new(ClusterManager).UpdateCluster(c)
+	// Drain the sync request of the handler
+	select {
+	case <-syncNow:
+	default:
+	}
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	cluster, err := model.GetClusterByID(id)
+	require.NoError(t, err)
+	return cluster
+}
+
+// formUpdate is the body the cluster edit form sends
+func formUpdate(description string) map[string]any {
+	return map[string]any{
+		"name":          "prod",
+		"description":   description,
+		"prometheusURL": "http://prometheus",
+		"enabled":       true,
+	}
+}
+
+func TestUpdateClusterKeepsOmittedSettings(t *testing.T) {
+	cluster := &model.Cluster{
+		Name:         "prod",
+		Config:       model.SecretString(testKubeconfig(t, "prod", "prod")),
+		Enable:       true,
+		ExecProtocol: "spdy",
+		LokiURL:      "http://loki:3100",
+		RecordEvents: true,
+		AlwaysOn:     true,
+
+		ProxyURL:      "socks5://bastion:1080",
+		ProxyUsername: "u",
+		ProxyPassword: "p",
+		TLSServerName: "k8s.internal",
+
+		CacheNamespaces:         model.SliceString{"shop"},
+		CacheUncachedResources:  model.SliceString{"secrets"},
+		CacheStripManagedFields: true,
+		CacheMaxAnnotationSize:  1024,
+	}
+	setupClusterDB(t, cluster)
+
+	updated := runUpdate(t, cluster.ID, formUpdate("edited"))
+	assert.Equal(t, "edited", updated.Description)
+	assert.Equal(t, "spdy", updated.ExecProtocol)
+	assert.Equal(t, "http://loki:3100", updated.LokiURL)
+	assert.True(t, updated.RecordEvents)
+	assert.True(t, updated.AlwaysOn)
+	assert.Equal(t, "socks5://bastion:1080", updated.ProxyURL)
+	assert.Equal(t, "u", updated.ProxyUsername)
+	assert.Equal(t, model.SecretString("p"), updated.ProxyPassword)
+	assert.Equal(t, "k8s.internal", updated.TLSServerName)
+	assert.Equal(t, model.SliceString{"shop"}, updated.CacheNamespaces)
+	assert.Equal(t, model.SliceString{"secrets"}, updated.CacheUncachedResources)
+	assert.True(t, updated.CacheStripManagedFields)
+	assert.Equal(t, 1024, updated.CacheMaxAnnotationSize)
+
+	updated = runUpdate(t, cluster.ID, map[string]any{"enabled": true, "execProtocol": "websocket", "lokiURL": ""})
+	assert.Equal(t, "websocket", updated.ExecProtocol)
+	assert.Empty(t, updated.LokiURL)
+	assert.True(t, updated.RecordEvents)
+
+	updated = runUpdate(t, cluster.ID, map[string]any{"enabled": true, "recordEvents": false, "recordNormalEvents": true})
+	assert.False(t, updated.RecordEvents)
+	assert.True(t, updated.RecordNormalEvents)
+
+	updated = runUpdate(t, cluster.ID, map[string]any{"enabled": true, "alwaysOn": false})
+	assert.False(t, updated.AlwaysOn)
+
+	updated = runUpdate(t, cluster.ID, map[string]any{"enabled": true, "cacheNamespaces": []string{}, "cacheMaxAnnotationSize": 0})
+	assert.Equal(t, &kube.CacheScope{Uncached: []string{"secrets"}, StripManagedFields: true}, cacheScope(updated))
+}
+
+func TestUpdateClusterKeepsLabelsForRoleSelectors(t *testing.T) {
+	cluster := &model.Cluster{
+		Name:   "prod",
+		Config: model.SecretString(testKubeconfig(t, "prod", "prod")),
+		Enable: true,
+		Labels: model.StringMap{"env": "prod"},
+	}
+	setupClusterDB(t, cluster)
+	prevConfig := rbac.RBACConfig
+	rbac.RBACConfig = &common.RolesConfig{
+		Roles:       []common.Role{{Name: "prod-viewer", ClusterSelector: "env=prod", Namespaces: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"get"}}},
+		RoleMapping: []common.RoleMapping{{Name: "prod-viewer", Users: []string{"*"}}},
+	}
+	t.Cleanup(func() {
+		rbac.RBACConfig = prevConfig
+		rbac.SetClusterLabels(nil)
+	})
+	user := model.User{Username: "alice"}
+	// syncLabels does what a cluster sync does with the stored labels
+	syncLabels := func(c *model.Cluster) {
+		rbac.SetClusterLabels(map[string]map[string]string{c.Name: c.Labels})
+	}
+
+	updated := runUpdate(t, cluster.ID, formUpdate("edited"))
+	assert.Equal(t, model.StringMap{"env": "prod"}, updated.Labels)
+	syncLabels(updated)
+	assert.True(t, rbac.CanAccessCluster(user, "prod"))
+
+	updated = runUpdate(t, cluster.ID, map[string]any{"enabled": true, "labels": map[string]string{"env": "staging"}})
+	syncLabels(updated)
+	assert.False(t, rbac.CanAccessCluster(user, "prod"))
+}
@@ -3,17 +3,23 @@ package cluster
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/zxh326/kite/pkg/common"
 	"github.com/zxh326/kite/pkg/kube"
+	"github.com/zxh326/kite/pkg/loki"
 	"github.com/zxh326/kite/pkg/model"
 	"github.com/zxh326/kite/pkg/prometheus"
+	"github.com/zxh326/kite/pkg/rbac"
 	"gorm.io/gorm"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/klog/v2"
 )
@@ -23,49 +29,91 @@ type ClientSet struct {
 	Version    string // Kubernetes version
 	K8sClient  *kube.K8sClient
 	PromClient *prometheus.Client
+	LokiClient *loki.Client
 
 	DiscoveredPrometheusURL string
-	config                  string
-	prometheusURL           string
+	// CredentialsExpireAt is when the static credentials expire, nil when they do not
+	CredentialsExpireAt *time.Time
+
+	config             string
+	network            string
+	persistedConfig    *atomic.Pointer[string]
+	prometheusURL      string
+	lokiURL            string
+	cacheScope         *kube.CacheScope
+	recordEvents       bool
+	recordNormalEvents bool
+	eventRecorder      *eventRecorder
+	prober             *clusterProber
+	health             atomic.Pointer[common.ClusterHealth]
+	lifecycle          clientSetLifecycle
 }
 
-type ClusterManager struct {
+// stop stops the informers of the cluster, it runs after the ClientSet was
+// retired and its sessions drained
+func (cs *ClientSet) stop() {
+	cs.K8sClient.Stop(cs.Name)
+}
+
+// clusterSnapshot is the set of connected clusters. A snapshot is never
+// modified after it was stored, syncClusters builds a new one and swaps it in.
+type clusterSnapshot struct {
 	clusters       map[string]*ClientSet
 	errors         map[string]string
 	defaultContext string
+	// configs holds every enabled cluster, connected or not
+	configs map[string]*model.Cluster
 }
 
-func createClientSetInCluster(name, prometheusURL string) (*ClientSet, error) {
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return nil, err
+// clone returns a copy of the snapshot that can be modified
+func (s *clusterSnapshot) clone() *clusterSnapshot {
+	next := &clusterSnapshot{
+		clusters:       maps.Clone(s.clusters),
+		errors:         maps.Clone(s.errors),
+		defaultContext: s.defaultContext,
+		configs:        maps.Clone(s.configs),
+	}
+	if next.clusters == nil {
+		next.clusters = make(map[string]*ClientSet)
+	}
+	if next.errors == nil {
+		next.errors = make(map[string]string)
 	}
+	if next.configs == nil {
+		next.configs = make(map[string]*model.Cluster)
+	}
+	return next
+}
+
+type ClusterManager struct {
+	snapshot atomic.Pointer[clusterSnapshot]
+	// syncMu serializes syncClusters
+	syncMu sync.Mutex
+
+	subMu          sync.Mutex
+	subscribers    map[int]func(ClusterEvent)
+	nextSubscriber int
 
-	return newClientSet(name, config, prometheusURL)
+	connMu     sync.Mutex
+	connecting map[string]*connectAttempt
 }
 
-func createClientSetFromConfig(name, content, prometheusURL string) (*ClientSet, error) {
-	restConfig, err := clientcmd.RESTConfigFromKubeConfig([]byte(content))
-	if err != nil {
-		klog.Warningf("Failed to create REST config for cluster %s: %v", name, err)
-		return nil, err
-	}
-	cs, err := newClientSet(name, restConfig, prometheusURL)
-	if err != nil {
-		return nil, err
+func (cm *ClusterManager) load() *clusterSnapshot {
+	if s := cm.snapshot.Load(); s != nil {
+		return s
 	}
-	cs.config = content
-
-	return cs, nil
+	return &clusterSnapshot{}
 }
 
-func newClientSet(name string, k8sConfig *rest.Config, prometheusURL string) (*ClientSet, error) {
+func newClientSet(name string, k8sConfig *rest.Config, prometheusURL string, scope *kube.CacheScope) (*ClientSet, error) {
 	cs := &ClientSet{
 		Name:          name,
 		prometheusURL: prometheusURL,
+		cacheScope:    scope,
 	}
+	cs.lifecycle.lastUsed = time.Now()
 	var err error
-	cs.K8sClient, err = kube.NewClient(k8sConfig)
+	cs.K8sClient, err = kube.NewClientWithCacheScope(k8sConfig, scope)
 	if err != nil {
 		klog.Warningf("Failed to create k8s client for cluster %s: %v", name, err)
 		return nil, err
@@ -78,16 +126,7 @@ func newClientSet(name string, k8sConfig *rest.Config, prometheusURL string) (*C
 		}
 	}
 	if prometheusURL != "" {
-		var rt = http.DefaultTransport
-		var err error
-		if isClusterLocalURL(prometheusURL) {
-			rt, err = createK8sProxyTransport(k8sConfig, prometheusURL)
-			if err != nil {
-				klog.Warningf("Failed to create k8s proxy transport for cluster %s: %v, using direct connection", name, err)
-			} else {
-				klog.Infof("Using k8s API proxy for Prometheus in cluster %s", name)
-			}
-		}
+		rt := backendRoundTripper(name, k8sConfig, prometheusURL, "Prometheus")
 		cs.PromClient, err = prometheus.NewClientWithRoundTripper(prometheusURL, rt)
 		if err != nil {
 			klog.Warningf("Failed to create Prometheus client for cluster %s, some features may not work as expected, err: %v", name, err)
@@ -103,6 +142,21 @@ func newClientSet(name string, k8sConfig *rest.Config, prometheusURL string) (*C
 	return cs, nil
 }
 
+// backendRoundTripper returns the transport for an in-cluster backend such as
+// Prometheus or Loki, cluster local URLs are reached through the API server proxy
+func backendRoundTripper(name string, k8sConfig *rest.Config, backendURL, backend string) http.RoundTripper {
+	if !isClusterLocalURL(backendURL) {
+		return backendTransport(k8sConfig)
+	}
+	rt, err := createK8sProxyTransport(k8sConfig, backendURL)
+	if err != nil {
+		klog.Warningf("Failed to create k8s proxy transport for cluster %s: %v, using direct connection", name, err)
+		return http.DefaultTransport
+	}
+	klog.Infof("Using k8s API proxy for %s in cluster %s", backend, name)
+	return rt
+}
+
 func isClusterLocalURL(urlStr string) bool {
 	return strings.Contains(urlStr, ".svc.cluster.local") || strings.Contains(urlStr, ".svc:")
 }
@@ -167,23 +221,81 @@ func (t *k8sProxyTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	return t.transport.RoundTrip(req)
 }
 
+// GetClientSet returns the ClientSet of a cluster, an empty name selects the
+// default cluster. A cluster that is not connected yet starts connecting and
+// ErrClusterWarmingUp is returned until it is ready.
 func (cm *ClusterManager) GetClientSet(clusterName string) (*ClientSet, error) {
-	if len(cm.clusters) == 0 {
+	s := cm.load()
+	if len(s.clusters) == 0 && len(s.configs) == 0 {
 		return nil, fmt.Errorf("no clusters available")
 	}
-	if clusterName == "" {
-		if cm.defaultContext == "" {
-			// If no default context is set, return the first available cluster
-			for _, cs := range cm.clusters {
-				return cs, nil
-			}
+	name := s.resolve(clusterName)
+	if cs, ok := s.clusters[name]; ok {
+		return cs, nil
+	}
+	if cluster, ok := s.configs[name]; ok {
+		return nil, cm.connect(cluster)
+	}
+	return nil, fmt.Errorf("cluster not found: %s", name)
+}
+
+// resolve returns the cluster selected by name, an empty name selects the
+// default cluster or, without a default, the first available cluster
+func (s *clusterSnapshot) resolve(clusterName string) string {
+	if clusterName != "" {
+		return clusterName
+	}
+	if s.defaultContext != "" {
+		return s.defaultContext
+	}
+	for name := range s.clusters {
+		return name
+	}
+	for name := range s.configs {
+		return name
+	}
+	return ""
+}
+
+// AcquireClientSet returns the ClientSet of a cluster and keeps it running
+// until release is called, even if the cluster is updated in the meantime
+func (cm *ClusterManager) AcquireClientSet(clusterName string) (*ClientSet, func(), error) {
+	for {
+		cs, err := cm.GetClientSet(clusterName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cs.acquire() {
+			return cs, cs.release, nil
 		}
-		return cm.GetClientSet(cm.defaultContext)
+		// The ClientSet was retired after the snapshot was loaded, the
+		// next snapshot is already stored
 	}
-	if cluster, ok := cm.clusters[clusterName]; ok {
-		return cluster, nil
+}
+
+// ClientSets returns the connected clusters
+func (cm *ClusterManager) ClientSets() []*ClientSet {
+	s := cm.load()
+	clientSets := make([]*ClientSet, 0, len(s.clusters))
+	for _, cs := range s.clusters {
+		clientSets = append(clientSets, cs)
 	}
-	return nil, fmt.Errorf("cluster not found: %s", clusterName)
+	return clientSets
+}
+
+// IsConnected reports whether a cluster is connected, idle clusters connect
+// on their next request
+func (cm *ClusterManager) IsConnected(name string) bool {
+	_, ok := cm.load().clusters[name]
+	return ok
+}
+
+// ClusterNames returns the enabled clusters, connected or not, sorted by name
+func (cm *ClusterManager) ClusterNames() []string {
+	s := cm.load()
+	names := slices.Collect(maps.Keys(s.configs))
+	slices.Sort(names)
+	return names
 }
 
 func ImportClustersFromKubeconfig(kubeconfig *clientcmdapi.Config) int64 {
@@ -192,19 +304,8 @@ func ImportClustersFromKubeconfig(kubeconfig *clientcmdapi.Config) int64 {
 	}
 
 	importedCount := 0
-	for contextName, context := range kubeconfig.Contexts {
-		config := clientcmdapi.NewConfig()
-		config.Contexts = map[string]*clientcmdapi.Context{
-			contextName: context,
-		}
-		config.CurrentContext = contextName
-		config.Clusters = map[string]*clientcmdapi.Cluster{
-			context.Cluster: kubeconfig.Clusters[context.Cluster],
-		}
-		config.AuthInfos = map[string]*clientcmdapi.AuthInfo{
-			context.AuthInfo: kubeconfig.AuthInfos[context.AuthInfo],
-		}
-		configStr, err := clientcmd.Write(*config)
+	for contextName := range kubeconfig.Contexts {
+		configStr, err := contextKubeconfig(kubeconfig, contextName)
 		if err != nil {
 			continue
 		}
@@ -232,50 +333,87 @@ var (
 )
 
 func syncClusters(cm *ClusterManager) error {
+	cm.syncMu.Lock()
+	defer cm.syncMu.Unlock()
+
 	clusters, err := model.ListClusters()
 	if err != nil {
 		klog.Warningf("list cluster err: %v", err)
 		time.Sleep(5 * time.Second)
 		return err
 	}
+	next := cm.load().clone()
+	next.defaultContext = ""
+	next.configs = make(map[string]*model.Cluster, len(clusters))
+	var events []ClusterEvent
+	var retired []*ClientSet
+
 	dbClusterMap := make(map[string]interface{})
+	clusterLabels := make(map[string]map[string]string, len(clusters))
 	for _, cluster := range clusters {
 		dbClusterMap[cluster.Name] = cluster
+		clusterLabels[cluster.Name] = cluster.Labels
 		if cluster.IsDefault {
-			cm.defaultContext = cluster.Name
+			next.defaultContext = cluster.Name
+		}
+		if cluster.Enable {
+			next.configs[cluster.Name] = cluster
+		}
+		current, currentExist := next.clusters[cluster.Name]
+		if !currentExist && cluster.Enable && !isPinned(cluster) {
+			// Connected on the first request, see GetClientSet
+			continue
 		}
-		current, currentExist := cm.clusters[cluster.Name]
 		if shouldUpdateCluster(current, cluster) {
 			if currentExist {
-				delete(cm.clusters, cluster.Name)
-				current.K8sClient.Stop(cluster.Name)
+				delete(next.clusters, cluster.Name)
+				retired = append(retired, current)
 			}
 			if cluster.Enable {
 				clientSet, err := buildClientSet(cluster)
 				if err != nil {
 					klog.Errorf("Failed to build k8s client for cluster %s, in cluster: %t, err: %v", cluster.Name, cluster.InCluster, err)
-					cm.errors[cluster.Name] = err.Error()
+					next.errors[cluster.Name] = err.Error()
+					if currentExist {
+						events = append(events, ClusterEvent{Type: ClusterRemoved, Name: cluster.Name})
+					}
 					continue
 				}
-				delete(cm.errors, cluster.Name)
-				cm.clusters[cluster.Name] = clientSet
+				delete(next.errors, cluster.Name)
+				next.clusters[cluster.Name] = clientSet
+				eventType := ClusterAdded
+				if currentExist {
+					eventType = ClusterUpdated
+				}
+				events = append(events, ClusterEvent{Type: eventType, Name: cluster.Name, ClientSet: clientSet})
 			} else {
-				delete(cm.errors, cluster.Name)
+				delete(next.errors, cluster.Name)
+				if currentExist {
+					events = append(events, ClusterEvent{Type: ClusterRemoved, Name: cluster.Name})
+				}
 			}
 		}
 	}
-	for name, clientSet := range cm.clusters {
+	for name, clientSet := range next.clusters {
 		if _, ok := dbClusterMap[name]; !ok {
-			delete(cm.clusters, name)
-			clientSet.K8sClient.Stop(name)
+			delete(next.clusters, name)
+			retired = append(retired, clientSet)
+			events = append(events, ClusterEvent{Type: ClusterRemoved, Name: name})
 		}
 	}
-	for name := range cm.errors {
+	for name := range next.errors {
 		if _, ok := dbClusterMap[name]; !ok {
-			delete(cm.errors, name)
+			delete(next.errors, name)
 		}
 	}
 
+	cm.snapshot.Store(next)
+	rbac.SetClusterLabels(clusterLabels)
+	// Old clients are stopped once the requests that still use them finish
+	for _, cs := range retired {
+		cs.retire()
+	}
+	cm.publish(events)
 	return nil
 }
 
@@ -295,18 +433,48 @@ func shouldUpdateCluster(cs *ClientSet, cluster *model.Cluster) bool {
 		return true
 	}
 
-	// kubeconfig change
-	if cs.config != string(cluster.Config) {
+	// kubeconfig or credentials change, tokens persisted by the auth provider are not a change
+	if key := configKey(cluster); cs.config != key && !cs.persisted(key) {
 		klog.Infof("Kubeconfig changed for cluster %s, updating", cluster.Name)
 		return true
 	}
 
+	// proxy or TLS server name change
+	if cs.network != networkKey(cluster) {
+		klog.Infof("Network settings changed for cluster %s, updating", cluster.Name)
+		return true
+	}
+
 	// prometheus URL change
 	if cs.prometheusURL != cluster.PrometheusURL {
 		klog.Infof("Prometheus URL changed for cluster %s, updating", cluster.Name)
 		return true
 	}
 
+	// loki URL change
+	if cs.lokiURL != cluster.LokiURL {
+		klog.Infof("Loki URL changed for cluster %s, updating", cluster.Name)
+		return true
+	}
+
+	// cache scope change
+	if !cs.cacheScope.Equal(cacheScope(cluster)) {
+		klog.Infof("Cache scope changed for cluster %s, updating", cluster.Name)
+		return true
+	}
+
+	// exec protocol change
+	if cs.K8sClient.ExecProtocol != cluster.ExecProtocol {
+		klog.Infof("Exec protocol changed for cluster %s, updating", cluster.Name)
+		return true
+	}
+
+	// event recording change
+	if cs.recordEvents != cluster.RecordEvents || (cluster.RecordEvents && cs.recordNormalEvents != cluster.RecordNormalEvents) {
+		klog.Infof("Event recording changed for cluster %s, updating", cluster.Name)
+		return true
+	}
+
 	// k8s version change
 	// TODO: Replace direct ClientSet.Discovery() call with a small DiscoveryInterface.
 	// current code depends on *kubernetes.Clientset, which is hard to mock in tests.
@@ -321,26 +489,107 @@ func shouldUpdateCluster(cs *ClientSet, cluster *model.Cluster) bool {
 	return false
 }
 
+// persisted reports whether config was written by the auth provider persister of the ClientSet
+func (cs *ClientSet) persisted(config string) bool {
+	if cs.persistedConfig == nil {
+		return false
+	}
+	p := cs.persistedConfig.Load()
+	return p != nil && *p == config
+}
+
+// cacheScope returns the informer cache settings of a cluster, nil caches everything
+func cacheScope(cluster *model.Cluster) *kube.CacheScope {
+	scope := &kube.CacheScope{
+		Namespaces:         nonEmpty(cluster.CacheNamespaces),
+		Uncached:           nonEmpty(cluster.CacheUncachedResources),
+		StripManagedFields: cluster.CacheStripManagedFields,
+		MaxAnnotationSize:  cluster.CacheMaxAnnotationSize,
+	}
+	if scope.IsZero() {
+		return nil
+	}
+	return scope
+}
+
+// nonEmpty drops blank entries, an empty SliceString column scans as [""]
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 func buildClientSet(cluster *model.Cluster) (*ClientSet, error) {
-	if cluster.InCluster {
-		return createClientSetInCluster(cluster.Name, cluster.PrometheusURL)
+	restConfig, err := restConfigForCluster(cluster)
+	if err != nil {
+		klog.Warningf("Failed to create REST config for cluster %s: %v", cluster.Name, err)
+		return nil, err
 	}
-	return createClientSetFromConfig(cluster.Name, string(cluster.Config), cluster.PrometheusURL)
+	persisted := withAuthProviderPersister(cluster, restConfig)
+	cs, err := newClientSet(cluster.Name, restConfig, cluster.PrometheusURL, cacheScope(cluster))
+	if err != nil {
+		return nil, err
+	}
+	if !cluster.InCluster {
+		cs.config = configKey(cluster)
+		cs.network = networkKey(cluster)
+		cs.persistedConfig = persisted
+		cs.CredentialsExpireAt = credentialsExpiry(restConfig)
+		recordCredentialsExpiry(cs.Name, cs.CredentialsExpireAt)
+	}
+	cs.K8sClient.ExecProtocol = cluster.ExecProtocol
+	if cluster.LokiURL != "" {
+		cs.lokiURL = cluster.LokiURL
+		rt := backendRoundTripper(cluster.Name, cs.K8sClient.Configuration, cluster.LokiURL, "Loki")
+		cs.LokiClient, err = loki.NewClientWithRoundTripper(cluster.LokiURL, rt)
+		if err != nil {
+			klog.Warningf("Failed to create Loki client for cluster %s, historical logs are disabled, err: %v", cluster.Name, err)
+		}
+	}
+	if cluster.RecordEvents {
+		cs.recordEvents = true
+		cs.recordNormalEvents = cluster.RecordNormalEvents
+		cs.eventRecorder, err = startEventRecorder(cluster.Name, cs.K8sClient, cluster.RecordNormalEvents)
+		if err != nil {
+			klog.Warningf("Failed to start event recorder for cluster %s: %v", cluster.Name, err)
+		}
+	}
+	return cs, nil
 }
 
 func NewClusterManager() (*ClusterManager, error) {
 	cm := new(ClusterManager)
-	cm.clusters = make(map[string]*ClientSet)
-	cm.errors = make(map[string]string)
+	cm.snapshot.Store(&clusterSnapshot{
+		clusters: make(map[string]*ClientSet),
+		errors:   make(map[string]string),
+	})
+	startEventArchivePurge()
+	cm.Subscribe(func(e ClusterEvent) {
+		// Idle clusters keep their health metrics, kite_cluster_connected reports them
+		if e.Type == ClusterRemoved {
+			deleteHealthMetrics(e.Name)
+		}
+		cm.recordConnectionMetrics()
+	})
 	go func() {
 		ticker := time.NewTicker(1 * time.Minute)
 		defer ticker.Stop()
+		healthTicker := time.NewTicker(common.ClusterHealthInterval)
+		defer healthTicker.Stop()
 		for {
 			select {
+			case <-healthTicker.C:
+				cm.recordConnectionMetrics()
+				go probeClusters(cm.ClientSets())
 			case <-ticker.C:
 				if err := syncClusters(cm); err != nil {
 					klog.Warningf("Failed to sync clusters: %v", err)
 				}
+				cm.disconnectIdleClusters(time.Now())
 			case <-syncNow:
 				if err := syncClusters(cm); err != nil {
 					klog.Warningf("Failed to sync clusters: %v", err)
@@ -352,5 +601,7 @@ func NewClusterManager() (*ClusterManager, error) {
 	if err := syncClusters(cm); err != nil {
 		klog.Warningf("Failed to sync clusters: %v", err)
 	}
+	cm.recordConnectionMetrics()
+	go probeClusters(cm.ClientSets())
 	return cm, nil
 }
@@ -104,6 +104,34 @@ func Test_shouldUpdateCluster(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "exec protocol change, need update",
+			args: args{
+				cs: &ClientSet{
+					Name:    "test",
+					Version: "v1.34.0",
+					K8sClient: &kube.K8sClient{
+						ClientSet: &kubernetes.Clientset{},
+					},
+				},
+				cluster: &model.Cluster{Name: "test", Enable: true, ExecProtocol: kube.ExecProtocolSPDY},
+			},
+			want: true,
+		},
+		{
+			name: "event recording enabled, need update",
+			args: args{
+				cs: &ClientSet{
+					Name:    "test",
+					Version: "v1.34.0",
+					K8sClient: &kube.K8sClient{
+						ClientSet: &kubernetes.Clientset{},
+					},
+				},
+				cluster: &model.Cluster{Name: "test", Enable: true, RecordEvents: true},
+			},
+			want: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
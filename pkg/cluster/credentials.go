@@ -0,0 +1,236 @@
+package cluster
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zxh326/kite/pkg/model"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	// Registers the oidc auth provider for kubeconfigs using it
+	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
+)
+
+// restConfigForCluster returns the client config of a cluster registered
+// in-cluster, with structured credentials or with a kubeconfig
+func restConfigForCluster(cluster *model.Cluster) (*rest.Config, error) {
+	if cluster.InCluster {
+		return rest.InClusterConfig()
+	}
+	var config *rest.Config
+	switch cluster.AuthType {
+	case model.ClusterAuthToken, model.ClusterAuthCertificate:
+		config = &rest.Config{
+			Host: cluster.Server,
+			TLSClientConfig: rest.TLSClientConfig{
+				CAData: []byte(cluster.CAData),
+			},
+		}
+		if cluster.AuthType == model.ClusterAuthToken {
+			config.BearerToken = string(cluster.Token)
+		} else {
+			config.CertData = []byte(cluster.ClientCert)
+			config.KeyData = []byte(cluster.ClientKey)
+		}
+	default:
+		var err error
+		config, err = clientcmd.RESTConfigFromKubeConfig([]byte(cluster.Config))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := applyNetworkSettings(cluster, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// configKey identifies the credentials of a cluster, a change reconnects it.
+// It is the kubeconfig itself for kubeconfig clusters.
+func configKey(cluster *model.Cluster) string {
+	switch cluster.AuthType {
+	case model.ClusterAuthToken, model.ClusterAuthCertificate:
+		h := sha256.New()
+		for _, v := range []string{cluster.AuthType, cluster.Server, string(cluster.CAData), string(cluster.Token), string(cluster.ClientCert), string(cluster.ClientKey)} {
+			h.Write([]byte(v))
+			h.Write([]byte{0})
+		}
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	return string(cluster.Config)
+}
+
+// ValidateClusterCredentials checks the credentials of a cluster before it is
+// saved, it does not contact the cluster
+func ValidateClusterCredentials(cluster *model.Cluster) error {
+	if cluster.InCluster {
+		return nil
+	}
+	switch cluster.AuthType {
+	case model.ClusterAuthToken, model.ClusterAuthCertificate:
+		u, err := url.Parse(cluster.Server)
+		if err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+			return fmt.Errorf("server must be an http(s) URL of the API server")
+		}
+		if cluster.CAData != "" {
+			if !x509.NewCertPool().AppendCertsFromPEM([]byte(cluster.CAData)) {
+				return fmt.Errorf("caData does not contain a PEM encoded certificate")
+			}
+		}
+		if cluster.AuthType == model.ClusterAuthToken {
+			if cluster.Token == "" {
+				return fmt.Errorf("token is required")
+			}
+			return nil
+		}
+		if _, err := tls.X509KeyPair([]byte(cluster.ClientCert), []byte(cluster.ClientKey)); err != nil {
+			return fmt.Errorf("invalid client certificate or key: %w", err)
+		}
+		return nil
+	case "", model.ClusterAuthKubeconfig:
+	default:
+		return fmt.Errorf("authType must be one of kubeconfig, token, certificate")
+	}
+	if cluster.Config == "" {
+		return nil
+	}
+	kubeconfig, err := clientcmd.Load([]byte(cluster.Config))
+	if err != nil {
+		return fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+	context, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return fmt.Errorf("kubeconfig has no current context")
+	}
+	if authInfo := kubeconfig.AuthInfos[context.AuthInfo]; authInfo != nil && authInfo.Exec != nil {
+		// The plugin runs in the Kite container, e.g. aws or kubelogin
+		if _, err := exec.LookPath(authInfo.Exec.Command); err != nil {
+			return fmt.Errorf("exec credential plugin %q is not installed: %w", authInfo.Exec.Command, err)
+		}
+	}
+	return nil
+}
+
+// authProviderPersister stores refreshed auth provider tokens, e.g. the OIDC
+// id-token and a rotated refresh-token, in the kubeconfig of the cluster
+type authProviderPersister struct {
+	cluster  string
+	authInfo string
+	// persisted is the kubeconfig written last, the sync does not reconnect for it
+	persisted *atomic.Pointer[string]
+}
+
+func (p *authProviderPersister) Persist(config map[string]string) error {
+	cluster, err := model.GetClusterByName(p.cluster)
+	if err != nil {
+		return err
+	}
+	kubeconfig, err := clientcmd.Load([]byte(cluster.Config))
+	if err != nil {
+		return err
+	}
+	authInfo := kubeconfig.AuthInfos[p.authInfo]
+	if authInfo == nil || authInfo.AuthProvider == nil {
+		return fmt.Errorf("user %s of cluster %s has no auth provider", p.authInfo, p.cluster)
+	}
+	authInfo.AuthProvider.Config = config
+	content, err := clientcmd.Write(*kubeconfig)
+	if err != nil {
+		return err
+	}
+	persisted := string(content)
+	p.persisted.Store(&persisted)
+	klog.Infof("Persisting refreshed %s credentials of cluster %s", authInfo.AuthProvider.Name, p.cluster)
+	return model.UpdateCluster(cluster, map[string]interface{}{"config": model.SecretString(persisted)})
+}
+
+// withAuthProviderPersister makes refreshed auth provider tokens survive
+// restarts, it returns the holder of the last persisted kubeconfig
+func withAuthProviderPersister(cluster *model.Cluster, config *rest.Config) *atomic.Pointer[string] {
+	if config.AuthProvider == nil || cluster.InCluster || configKey(cluster) != string(cluster.Config) {
+		return nil
+	}
+	kubeconfig, err := clientcmd.Load([]byte(cluster.Config))
+	if err != nil {
+		return nil
+	}
+	context, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return nil
+	}
+	persisted := new(atomic.Pointer[string])
+	config.AuthConfigPersister = &authProviderPersister{
+		cluster:   cluster.Name,
+		authInfo:  context.AuthInfo,
+		persisted: persisted,
+	}
+	return persisted
+}
+
+// credentialsExpiry returns when the static credentials of a config expire,
+// nil when they do not expire or are refreshed by a plugin
+func credentialsExpiry(config *rest.Config) *time.Time {
+	if config.ExecProvider != nil || config.AuthProvider != nil {
+		return nil
+	}
+	var expiry *time.Time
+	earliest := func(t *time.Time) {
+		if t != nil && (expiry == nil || t.Before(*expiry)) {
+			expiry = t
+		}
+	}
+	if config.BearerToken != "" {
+		earliest(jwtExpiry(config.BearerToken))
+	}
+	if len(config.CertData) > 0 {
+		earliest(certificateExpiry(config.CertData))
+	}
+	return expiry
+}
+
+// jwtExpiry returns the exp claim of a JWT, nil for other tokens
+func jwtExpiry(token string) *time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return nil
+	}
+	t := time.Unix(claims.Exp, 0)
+	return &t
+}
+
+// certificateExpiry returns the NotAfter of the first PEM certificate
+func certificateExpiry(data []byte) *time.Time {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	t := cert.NotAfter
+	return &t
+}
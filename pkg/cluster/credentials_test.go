@@ -0,0 +1,170 @@
+package cluster
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zxh326/kite/pkg/model"
+	"gorm.io/gorm"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func testCertificate(t *testing.T, notAfter time.Time) (certPEM, keyPEM string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kite"},
+		NotBefore:    notAfter.Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func testJWT(exp int64) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return enc([]byte(`{"alg":"RS256"}`)) + "." + enc([]byte(`{"exp":`+big.NewInt(exp).String()+`}`)) + ".sig"
+}
+
+func TestRestConfigForCluster(t *testing.T) {
+	config, err := restConfigForCluster(&model.Cluster{
+		AuthType: model.ClusterAuthToken, Server: "https://k8s:6443", CAData: "ca", Token: "t",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://k8s:6443", config.Host)
+	assert.Equal(t, "t", config.BearerToken)
+	assert.Equal(t, []byte("ca"), config.CAData)
+
+	config, err = restConfigForCluster(&model.Cluster{
+		AuthType: model.ClusterAuthCertificate, Server: "https://k8s:6443", ClientCert: "cert", ClientKey: "key",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, config.BearerToken)
+	assert.Equal(t, []byte("cert"), config.CertData)
+	assert.Equal(t, []byte("key"), config.KeyData)
+}
+
+func TestConfigKey(t *testing.T) {
+	kubeconfig := &model.Cluster{Config: "apiVersion: v1"}
+	assert.Equal(t, "apiVersion: v1", configKey(kubeconfig))
+
+	token := &model.Cluster{AuthType: model.ClusterAuthToken, Server: "https://k8s", Token: "a"}
+	rotated := &model.Cluster{AuthType: model.ClusterAuthToken, Server: "https://k8s", Token: "b"}
+	assert.NotEqual(t, configKey(token), configKey(rotated))
+	assert.Equal(t, configKey(token), configKey(&model.Cluster{AuthType: model.ClusterAuthToken, Server: "https://k8s", Token: "a"}))
+}
+
+func TestValidateClusterCredentials(t *testing.T) {
+	cert, key := testCertificate(t, time.Now().Add(time.Hour))
+	_, otherKey := testCertificate(t, time.Now().Add(time.Hour))
+
+	execConfig := clientcmdapi.NewConfig()
+	execConfig.Clusters["c"] = &clientcmdapi.Cluster{Server: "https://k8s"}
+	execConfig.AuthInfos["u"] = &clientcmdapi.AuthInfo{Exec: &clientcmdapi.ExecConfig{Command: "kite-missing-credential-plugin", APIVersion: "client.authentication.k8s.io/v1"}}
+	execConfig.Contexts["ctx"] = &clientcmdapi.Context{Cluster: "c", AuthInfo: "u"}
+	execConfig.CurrentContext = "ctx"
+	execKubeconfig, err := clientcmd.Write(*execConfig)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		cluster model.Cluster
+		wantErr string
+	}{
+		{"in cluster", model.Cluster{InCluster: true}, ""},
+		{"token", model.Cluster{AuthType: model.ClusterAuthToken, Server: "https://k8s:6443", Token: "t"}, ""},
+		{"token without server", model.Cluster{AuthType: model.ClusterAuthToken, Token: "t"}, "server must be an http(s) URL of the API server"},
+		{"missing token", model.Cluster{AuthType: model.ClusterAuthToken, Server: "https://k8s"}, "token is required"},
+		{"invalid CA", model.Cluster{AuthType: model.ClusterAuthToken, Server: "https://k8s", Token: "t", CAData: "nope"}, "caData does not contain a PEM encoded certificate"},
+		{"certificate", model.Cluster{AuthType: model.ClusterAuthCertificate, Server: "https://k8s", CAData: model.SecretString(cert), ClientCert: model.SecretString(cert), ClientKey: model.SecretString(key)}, ""},
+		{"mismatched key", model.Cluster{AuthType: model.ClusterAuthCertificate, Server: "https://k8s", ClientCert: model.SecretString(cert), ClientKey: model.SecretString(otherKey)}, "invalid client certificate or key"},
+		{"unknown auth type", model.Cluster{AuthType: "basic"}, "authType must be one of kubeconfig, token, certificate"},
+		{"invalid kubeconfig", model.Cluster{Config: "{"}, "invalid kubeconfig"},
+		{"missing exec plugin", model.Cluster{Config: model.SecretString(execKubeconfig)}, `exec credential plugin "kite-missing-credential-plugin" is not installed`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateClusterCredentials(&tt.cluster)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestCredentialsExpiry(t *testing.T) {
+	certExpiry := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	cert, _ := testCertificate(t, certExpiry)
+	tokenExpiry := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	assert.Nil(t, credentialsExpiry(&rest.Config{BearerToken: "opaque"}))
+	assert.Equal(t, tokenExpiry.Unix(), credentialsExpiry(&rest.Config{BearerToken: testJWT(tokenExpiry.Unix())}).Unix())
+	assert.Equal(t, certExpiry.Unix(), credentialsExpiry(&rest.Config{TLSClientConfig: rest.TLSClientConfig{CertData: []byte(cert)}}).Unix())
+	// The earlier of both
+	both := &rest.Config{BearerToken: testJWT(tokenExpiry.Unix()), TLSClientConfig: rest.TLSClientConfig{CertData: []byte(cert)}}
+	assert.Equal(t, tokenExpiry.Unix(), credentialsExpiry(both).Unix())
+	// Plugins refresh their credentials
+	both.ExecProvider = &clientcmdapi.ExecConfig{Command: "aws"}
+	assert.Nil(t, credentialsExpiry(both))
+}
+
+func TestAuthProviderPersister(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Cluster{}))
+	prev := model.DB
+	model.DB = db
+	t.Cleanup(func() { model.DB = prev })
+
+	kubeconfig := clientcmdapi.NewConfig()
+	kubeconfig.Clusters["c"] = &clientcmdapi.Cluster{Server: "https://k8s"}
+	kubeconfig.AuthInfos["u"] = &clientcmdapi.AuthInfo{AuthProvider: &clientcmdapi.AuthProviderConfig{
+		Name:   "oidc",
+		Config: map[string]string{"id-token": "old", "refresh-token": "r1"},
+	}}
+	kubeconfig.Contexts["ctx"] = &clientcmdapi.Context{Cluster: "c", AuthInfo: "u"}
+	kubeconfig.CurrentContext = "ctx"
+	content, err := clientcmd.Write(*kubeconfig)
+	require.NoError(t, err)
+	cluster := &model.Cluster{Name: "oidc", Config: model.SecretString(content), Enable: true}
+	require.NoError(t, model.AddCluster(cluster))
+
+	config, err := restConfigForCluster(cluster)
+	require.NoError(t, err)
+	persisted := withAuthProviderPersister(cluster, config)
+	require.NotNil(t, persisted)
+	require.NoError(t, config.AuthConfigPersister.Persist(map[string]string{"id-token": "new", "refresh-token": "r2"}))
+
+	stored, err := model.GetClusterByName("oidc")
+	require.NoError(t, err)
+	updated, err := clientcmd.Load([]byte(stored.Config))
+	require.NoError(t, err)
+	assert.Equal(t, "r2", updated.AuthInfos["u"].AuthProvider.Config["refresh-token"])
+
+	// The refreshed token does not reconnect the cluster
+	cs := &ClientSet{config: configKey(cluster), persistedConfig: persisted}
+	assert.True(t, cs.persisted(configKey(stored)))
+	assert.False(t, cs.persisted(configKey(cluster)))
+}
@@ -0,0 +1,214 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/kube"
+	"github.com/zxh326/kite/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// eventFlushInterval is how often observed events are written to the database
+const eventFlushInterval = 10 * time.Second
+
+// eventRecorder archives the events of a cluster, it watches them through the
+// informer cache and writes the latest version of every changed event in batches
+type eventRecorder struct {
+	cluster       string
+	includeNormal bool
+
+	informer     cache.Informer
+	registration toolscache.ResourceEventHandlerRegistration
+	cancel       context.CancelFunc
+	done         chan struct{}
+
+	mu      sync.Mutex
+	pending map[types.UID]*model.ArchivedEvent
+}
+
+func startEventRecorder(name string, k8sClient *kube.K8sClient, includeNormal bool) (*eventRecorder, error) {
+	if k8sClient.Cache == nil {
+		return nil, fmt.Errorf("event recording needs the informer cache, which is disabled by DISABLE_CACHE")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	informer, err := k8sClient.Cache.GetInformer(ctx, &corev1.Event{})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r := &eventRecorder{
+		cluster:       name,
+		includeNormal: includeNormal,
+		informer:      informer,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+		pending:       map[types.UID]*model.ArchivedEvent{},
+	}
+	r.registration, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    r.observe,
+		UpdateFunc: func(_, obj any) { r.observe(obj) },
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go r.run(ctx)
+	klog.Infof("Recording events of cluster %s, normal events: %t", name, includeNormal)
+	return r, nil
+}
+
+func (r *eventRecorder) observe(obj any) {
+	event, ok := obj.(*corev1.Event)
+	if !ok {
+		return
+	}
+	if event.Type != corev1.EventTypeWarning && !(r.includeNormal && event.Type == corev1.EventTypeNormal) {
+		return
+	}
+	archived := archivedEventFromEvent(r.cluster, event)
+	r.mu.Lock()
+	r.pending[event.UID] = archived
+	r.mu.Unlock()
+}
+
+func (r *eventRecorder) run(ctx context.Context) {
+	defer close(r.done)
+	ticker := time.NewTicker(eventFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.flush()
+			return
+		case <-ticker.C:
+			r.flush()
+		}
+	}
+}
+
+func (r *eventRecorder) flush() {
+	r.mu.Lock()
+	if len(r.pending) == 0 {
+		r.mu.Unlock()
+		return
+	}
+	events := make([]*model.ArchivedEvent, 0, len(r.pending))
+	for _, e := range r.pending {
+		events = append(events, e)
+	}
+	r.pending = map[types.UID]*model.ArchivedEvent{}
+	r.mu.Unlock()
+
+	// Oldest first, so that later occurrences of the same reason fold into the row
+	slices.SortFunc(events, func(a, b *model.ArchivedEvent) int {
+		return a.LastTimestamp.Compare(b.LastTimestamp)
+	})
+	for _, e := range events {
+		if err := model.ArchiveEvent(e); err != nil {
+			klog.Warningf("Failed to archive event %s/%s of cluster %s: %v", e.Namespace, e.LastEventUID, r.cluster, err)
+		}
+	}
+}
+
+// stop removes the event handler and writes the remaining events
+func (r *eventRecorder) stop() {
+	if err := r.informer.RemoveEventHandler(r.registration); err != nil {
+		klog.V(1).Infof("Failed to remove event handler of cluster %s: %v", r.cluster, err)
+	}
+	r.cancel()
+	<-r.done
+}
+
+func archivedEventFromEvent(clusterName string, event *corev1.Event) *model.ArchivedEvent {
+	count := event.Count
+	if count == 0 && event.Series != nil {
+		count = event.Series.Count
+	}
+	if count == 0 {
+		count = 1
+	}
+	first := event.FirstTimestamp.Time
+	if first.IsZero() {
+		first = event.EventTime.Time
+	}
+	if first.IsZero() {
+		first = event.CreationTimestamp.Time
+	}
+	last := event.LastTimestamp.Time
+	if event.Series != nil && event.Series.LastObservedTime.After(last) {
+		last = event.Series.LastObservedTime.Time
+	}
+	if last.IsZero() {
+		last = first
+	}
+	source := event.Source.Component
+	if source == "" {
+		source = event.ReportingController
+	}
+	return &model.ArchivedEvent{
+		ClusterName:    clusterName,
+		Namespace:      event.Namespace,
+		InvolvedKind:   event.InvolvedObject.Kind,
+		InvolvedName:   event.InvolvedObject.Name,
+		InvolvedUID:    string(event.InvolvedObject.UID),
+		Reason:         event.Reason,
+		Type:           event.Type,
+		Message:        event.Message,
+		Source:         source,
+		FirstTimestamp: first,
+		LastTimestamp:  last,
+		LastEventUID:   string(event.UID),
+		LastEventCount: count,
+	}
+}
+
+// startEventArchivePurge deletes archived events beyond the retention limits every hour
+func startEventArchivePurge() {
+	if common.EventArchiveRetentionDays <= 0 && common.EventArchiveMaxEvents <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for {
+			purgeArchivedEvents()
+			<-ticker.C
+		}
+	}()
+}
+
+func purgeArchivedEvents() {
+	if common.EventArchiveRetentionDays > 0 {
+		before := time.Now().AddDate(0, 0, -common.EventArchiveRetentionDays)
+		n, err := model.DeleteArchivedEventsBefore(before)
+		if err != nil {
+			klog.Errorf("Failed to delete expired archived events: %v", err)
+		} else if n > 0 {
+			klog.Infof("Deleted %d expired archived events", n)
+		}
+	}
+	if common.EventArchiveMaxEvents > 0 {
+		clusters, err := model.ListArchivedEventClusters()
+		if err != nil {
+			klog.Errorf("Failed to list clusters with archived events: %v", err)
+			return
+		}
+		for _, name := range clusters {
+			n, err := model.TrimArchivedEvents(name, common.EventArchiveMaxEvents)
+			if err != nil {
+				klog.Errorf("Failed to trim archived events of cluster %s: %v", name, err)
+			} else if n > 0 {
+				klog.Infof("Deleted %d archived events of cluster %s over the limit", n, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zxh326/kite/pkg/common"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+const (
+	healthProbeTimeout = 10 * time.Second
+	// slowAPILatency marks a cluster as degraded when /readyz takes longer
+	slowAPILatency = 5 * time.Second
+)
+
+var (
+	clusterUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kite_cluster_up",
+		Help: "Whether the API server of the cluster answered /readyz with ok in the last probe.",
+	}, []string{"cluster"})
+	clusterHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kite_cluster_healthy",
+		Help: "Whether the last probe found the cluster healthy, i.e. ready, discoverable and with synced caches.",
+	}, []string{"cluster"})
+	clusterAPILatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kite_cluster_api_latency_seconds",
+		Help: "Latency of the last /readyz request to the API server of the cluster.",
+	}, []string{"cluster"})
+	clusterDiscoveryErrors = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kite_cluster_discovery_errors",
+		Help: "Number of API groups whose discovery failed in the last probe.",
+	}, []string{"cluster"})
+	clusterCacheSynced = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kite_cluster_cache_synced",
+		Help: "Whether the informer caches of the cluster are synced.",
+	}, []string{"cluster"})
+	clusterLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kite_cluster_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful contact with the API server of the cluster.",
+	}, []string{"cluster"})
+	clusterCredentialsExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kite_cluster_credentials_expiry_timestamp_seconds",
+		Help: "Unix time when the static credentials of the cluster expire, unset when they do not expire.",
+	}, []string{"cluster"})
+	clusterConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kite_cluster_connected",
+		Help: "Whether an enabled cluster is connected, idle clusters are not probed and keep the metrics of their last probe.",
+	}, []string{"cluster"})
+	clusterProbeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kite_cluster_probe_failures_total",
+		Help: "Number of health probes that could not reach the API server of the cluster.",
+	}, []string{"cluster"})
+)
+
+func init() {
+	prometheus.MustRegister(clusterUp, clusterHealthy, clusterAPILatency, clusterDiscoveryErrors,
+		clusterCacheSynced, clusterLastSuccess, clusterCredentialsExpiry, clusterConnected, clusterProbeFailures)
+}
+
+// clusterProber checks one cluster, it is created once per ClientSet
+type clusterProber struct {
+	discovery discovery.DiscoveryInterface
+	// cacheErrors returns the recent watch errors of the informer cache, nil
+	// when caching is disabled
+	cacheErrors func() []string
+}
+
+func newClusterProber(cs *ClientSet) (*clusterProber, error) {
+	config := rest.CopyConfig(cs.K8sClient.Configuration)
+	config.Timeout = healthProbeTimeout
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	p := &clusterProber{discovery: dc}
+	if cs.K8sClient.Cache != nil {
+		p.cacheErrors = cs.K8sClient.CacheErrors
+	}
+	return p, nil
+}
+
+// probe runs all checks, prev is the result of the previous probe or nil
+func (p *clusterProber) probe(ctx context.Context, prev *common.ClusterHealth, now time.Time) *common.ClusterHealth {
+	h := &common.ClusterHealth{
+		Status:      common.ClusterHealthHealthy,
+		CacheSynced: true,
+		LastCheck:   now,
+	}
+	if prev != nil {
+		h.LastSuccess = prev.LastSuccess
+		h.ConsecutiveFailures = prev.ConsecutiveFailures
+	}
+
+	start := time.Now()
+	body, err := p.discovery.RESTClient().Get().AbsPath("/readyz").Do(ctx).Raw()
+	latency := time.Since(start)
+	h.LatencyMs = latency.Milliseconds()
+	var statusErr apierrors.APIStatus
+	switch {
+	case err == nil:
+		h.Ready = strings.TrimSpace(string(body)) == "ok"
+	case errors.As(err, &statusErr):
+		// The API server answered, but is not ready
+		h.ReadyzError = readyzMessage(body, err)
+	default:
+		h.Status = common.ClusterHealthUnreachable
+		h.ReadyzError = err.Error()
+		h.ConsecutiveFailures++
+		return h
+	}
+	contact := now
+	h.LastSuccess = &contact
+	h.ConsecutiveFailures = 0
+
+	if _, _, err := p.discovery.ServerGroupsAndResources(); err != nil {
+		var groupErr *discovery.ErrGroupDiscoveryFailed
+		if errors.As(err, &groupErr) {
+			for gv, gvErr := range groupErr.Groups {
+				h.DiscoveryErrors = append(h.DiscoveryErrors, gv.String()+": "+gvErr.Error())
+			}
+			sort.Strings(h.DiscoveryErrors)
+		} else {
+			h.DiscoveryErrors = []string{err.Error()}
+		}
+	}
+
+	// WaitForCacheSync only covers the initial list, a cache whose watches
+	// fail afterwards keeps serving stale objects
+	if p.cacheErrors != nil {
+		h.CacheErrors = p.cacheErrors()
+		h.CacheSynced = len(h.CacheErrors) == 0
+	}
+
+	if !h.Ready || len(h.DiscoveryErrors) > 0 || !h.CacheSynced || latency > slowAPILatency {
+		h.Status = common.ClusterHealthDegraded
+	}
+	return h
+}
+
+func readyzMessage(body []byte, err error) string {
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return msg
+	}
+	return err.Error()
+}
+
+// recordHealthMetrics exports the probe result as kite_cluster_* metrics
+func recordHealthMetrics(name string, h *common.ClusterHealth) {
+	clusterUp.WithLabelValues(name).Set(boolGauge(h.Ready))
+	clusterHealthy.WithLabelValues(name).Set(boolGauge(h.Status == common.ClusterHealthHealthy))
+	clusterAPILatency.WithLabelValues(name).Set(float64(h.LatencyMs) / 1000)
+	clusterDiscoveryErrors.WithLabelValues(name).Set(float64(len(h.DiscoveryErrors)))
+	clusterCacheSynced.WithLabelValues(name).Set(boolGauge(h.CacheSynced))
+	if h.LastSuccess != nil {
+		clusterLastSuccess.WithLabelValues(name).Set(float64(h.LastSuccess.Unix()))
+	}
+	if h.Status == common.ClusterHealthUnreachable {
+		clusterProbeFailures.WithLabelValues(name).Inc()
+	}
+}
+
+func deleteHealthMetrics(name string) {
+	for _, vec := range []*prometheus.GaugeVec{clusterUp, clusterHealthy, clusterAPILatency, clusterDiscoveryErrors, clusterCacheSynced, clusterLastSuccess, clusterCredentialsExpiry} {
+		vec.DeleteLabelValues(name)
+	}
+	clusterProbeFailures.DeleteLabelValues(name)
+}
+
+// recordConnectionMetrics exports whether each enabled cluster is connected
+func (cm *ClusterManager) recordConnectionMetrics() {
+	s := cm.load()
+	clusterConnected.Reset()
+	for name := range s.configs {
+		_, connected := s.clusters[name]
+		clusterConnected.WithLabelValues(name).Set(boolGauge(connected))
+	}
+}
+
+func recordCredentialsExpiry(name string, expiry *time.Time) {
+	if expiry == nil {
+		clusterCredentialsExpiry.DeleteLabelValues(name)
+		return
+	}
+	clusterCredentialsExpiry.WithLabelValues(name).Set(float64(expiry.Unix()))
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// probeRunning keeps a slow probe round from overlapping with the next one
+var probeRunning sync.Mutex
+
+// probeClusters probes the given clusters concurrently and stores the results
+func probeClusters(clientSets []*ClientSet) {
+	if !probeRunning.TryLock() {
+		klog.V(1).Info("Skipping cluster health probe, the previous probe is still running")
+		return
+	}
+	defer probeRunning.Unlock()
+	var wg sync.WaitGroup
+	for _, cs := range clientSets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cs.prober == nil {
+				prober, err := newClusterProber(cs)
+				if err != nil {
+					klog.Warningf("Failed to create health prober for cluster %s: %v", cs.Name, err)
+					return
+				}
+				cs.prober = prober
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 2*healthProbeTimeout)
+			defer cancel()
+			h := cs.prober.probe(ctx, cs.health.Load(), time.Now())
+			if h.Status != common.ClusterHealthHealthy {
+				klog.V(1).Infof("Cluster %s is %s: readyz %q, discovery errors %d, cache synced %t",
+					cs.Name, h.Status, h.ReadyzError, len(h.DiscoveryErrors), h.CacheSynced)
+			}
+			cs.health.Store(h)
+			recordHealthMetrics(cs.Name, h)
+		}()
+	}
+	wg.Wait()
+}
+
+// Health returns the result of the last health probe, nil before the first probe
+func (cs *ClientSet) Health() *common.ClusterHealth {
+	return cs.health.Load()
+}
@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zxh326/kite/pkg/common"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+func newTestProber(t *testing.T, readyz func(w http.ResponseWriter)) *clusterProber {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) { readyz(w) })
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind":"APIVersions","versions":["v1"]}`))
+	})
+	mux.HandleFunc("/api/v1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind":"APIResourceList","groupVersion":"v1","resources":[]}`))
+	})
+	mux.HandleFunc("/apis", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind":"APIGroupList","groups":[{"name":"metrics.k8s.io","versions":[{"groupVersion":"metrics.k8s.io/v1beta1","version":"v1beta1"}],"preferredVersion":{"groupVersion":"metrics.k8s.io/v1beta1","version":"v1beta1"}}]}`))
+	})
+	mux.HandleFunc("/apis/metrics.k8s.io/v1beta1", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	dc, err := discovery.NewDiscoveryClientForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &clusterProber{discovery: dc}
+}
+
+func TestClusterProberProbe(t *testing.T) {
+	now := time.Now()
+
+	p := newTestProber(t, func(w http.ResponseWriter) { _, _ = w.Write([]byte("ok")) })
+	p.cacheErrors = func() []string { return nil }
+	h := p.probe(context.Background(), nil, now)
+	if !h.Ready || h.LastSuccess == nil || !h.CacheSynced {
+		t.Fatalf("probe() = %+v, want ready with last success", h)
+	}
+	// Failing watches mark the cache as out of sync
+	p.cacheErrors = func() []string { return []string{"*v1.Pod: forbidden"} }
+	if h := p.probe(context.Background(), nil, now); h.CacheSynced || len(h.CacheErrors) != 1 {
+		t.Errorf("probe() = %+v, want cache out of sync", h)
+	}
+	// The unavailable aggregated API degrades the cluster
+	if h.Status != common.ClusterHealthDegraded || len(h.DiscoveryErrors) != 1 {
+		t.Errorf("probe() status = %s, discovery errors %v, want degraded with one error", h.Status, h.DiscoveryErrors)
+	}
+
+	p = newTestProber(t, func(w http.ResponseWriter) {
+		http.Error(w, "[-]etcd failed: reason withheld", http.StatusInternalServerError)
+	})
+	h = p.probe(context.Background(), nil, now)
+	if h.Ready || h.Status != common.ClusterHealthDegraded || h.ReadyzError == "" || h.LastSuccess == nil {
+		t.Errorf("probe() = %+v, want answered but not ready", h)
+	}
+
+	dc, err := discovery.NewDiscoveryClientForConfig(&rest.Config{Host: "http://127.0.0.1:1", Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := now.Add(-time.Minute)
+	prev := &common.ClusterHealth{LastSuccess: &last, ConsecutiveFailures: 2}
+	h = (&clusterProber{discovery: dc}).probe(context.Background(), prev, now)
+	if h.Status != common.ClusterHealthUnreachable || h.ConsecutiveFailures != 3 || !h.LastSuccess.Equal(last) {
+		t.Errorf("probe() = %+v, want unreachable keeping the last success", h)
+	}
+}
@@ -0,0 +1,313 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/model"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+)
+
+const importValidationTimeout = 10 * time.Second
+
+// contextKubeconfig returns a kubeconfig holding only the given context
+func contextKubeconfig(kubeconfig *clientcmdapi.Config, contextName string) (string, error) {
+	context, ok := kubeconfig.Contexts[contextName]
+	if !ok {
+		return "", fmt.Errorf("context %s not found", contextName)
+	}
+	cluster, ok := kubeconfig.Clusters[context.Cluster]
+	if !ok {
+		return "", fmt.Errorf("cluster %s of context %s not found", context.Cluster, contextName)
+	}
+	config := clientcmdapi.NewConfig()
+	config.Contexts = map[string]*clientcmdapi.Context{contextName: context}
+	config.CurrentContext = contextName
+	config.Clusters = map[string]*clientcmdapi.Cluster{context.Cluster: cluster}
+	if authInfo, ok := kubeconfig.AuthInfos[context.AuthInfo]; ok {
+		config.AuthInfos = map[string]*clientcmdapi.AuthInfo{context.AuthInfo: authInfo}
+	}
+	content, err := clientcmd.Write(*config)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// checkConnectivity returns the server version of a cluster, it is replaced in tests
+var checkConnectivity = func(ctx context.Context, cluster *model.Cluster) (string, error) {
+	config, err := restConfigForCluster(cluster)
+	if err != nil {
+		return "", err
+	}
+	config = rest.CopyConfig(config)
+	config.Timeout = importValidationTimeout
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return "", err
+	}
+	type result struct {
+		version string
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := dc.ServerVersion()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{version: v.String()}
+	}()
+	select {
+	case r := <-done:
+		return r.version, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// importItem is one context of the request with its resolved plan
+type importItem struct {
+	plan    common.KubeconfigImportPlan
+	config  string
+	current bool
+	result  common.KubeconfigImportResult
+}
+
+// planKubeconfigImport resolves the action of every context, the results of
+// invalid entries are already failed
+func planKubeconfigImport(req *common.KubeconfigImportRequest, existing map[string]*model.Cluster) ([]*importItem, error) {
+	defaultAction := req.DefaultAction
+	if defaultAction == "" {
+		defaultAction = common.ImportActionImport
+	}
+	if defaultAction != common.ImportActionImport && defaultAction != common.ImportActionSkip {
+		return nil, fmt.Errorf("defaultAction must be import or skip")
+	}
+
+	var items []*importItem
+	plans := map[[2]string]common.KubeconfigImportPlan{}
+	for _, p := range req.Plan {
+		if p.Kubeconfig < 0 || p.Kubeconfig >= len(req.Kubeconfigs) {
+			return nil, fmt.Errorf("plan for context %s refers to kubeconfig %d, only %d given", p.Context, p.Kubeconfig, len(req.Kubeconfigs))
+		}
+		plans[[2]string{fmt.Sprint(p.Kubeconfig), p.Context}] = p
+	}
+
+	for i, content := range req.Kubeconfigs {
+		kubeconfig, err := clientcmd.Load([]byte(content))
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %d is invalid: %w", i, err)
+		}
+		contexts := make([]string, 0, len(kubeconfig.Contexts))
+		for name := range kubeconfig.Contexts {
+			contexts = append(contexts, name)
+		}
+		sort.Strings(contexts)
+		for _, p := range req.Plan {
+			if p.Kubeconfig == i && !slices.Contains(contexts, p.Context) {
+				if p.Name == "" {
+					p.Name = p.Context
+				}
+				items = append(items, &importItem{plan: p, result: failedImport(p, fmt.Errorf("context %s not found", p.Context))})
+			}
+		}
+		for _, name := range contexts {
+			plan, ok := plans[[2]string{fmt.Sprint(i), name}]
+			if !ok {
+				plan = common.KubeconfigImportPlan{Kubeconfig: i, Context: name, Action: defaultAction}
+			}
+			if plan.Action == "" {
+				plan.Action = common.ImportActionImport
+			}
+			if plan.Name == "" {
+				plan.Name = name
+			}
+			item := &importItem{plan: plan, current: name == kubeconfig.CurrentContext}
+			item.result = common.KubeconfigImportResult{
+				Kubeconfig: i,
+				Context:    name,
+				Name:       plan.Name,
+				Action:     plan.Action,
+			}
+			item.config, err = contextKubeconfig(kubeconfig, name)
+			if err != nil {
+				item.result = failedImport(plan, err)
+			}
+			items = append(items, item)
+		}
+	}
+
+	targets := map[string]bool{}
+	for _, item := range items {
+		if item.result.Status != "" {
+			continue
+		}
+		_, exists := existing[item.plan.Name]
+		var err error
+		switch item.plan.Action {
+		case common.ImportActionSkip:
+			item.result.Status = common.ImportStatusSkipped
+			continue
+		case common.ImportActionImport:
+			if exists {
+				err = fmt.Errorf("cluster %s already exists, choose another name or overwrite it", item.plan.Name)
+			}
+		case common.ImportActionOverwrite:
+		case common.ImportActionMerge:
+			if !exists {
+				err = fmt.Errorf("cluster %s not found", item.plan.Name)
+			} else if item.plan.PrometheusURL == "" {
+				err = fmt.Errorf("prometheusURL is required to merge")
+			}
+		default:
+			err = fmt.Errorf("action must be one of import, overwrite, merge, skip")
+		}
+		if err == nil && targets[item.plan.Name] {
+			err = fmt.Errorf("cluster %s is the target of more than one context", item.plan.Name)
+		}
+		if err == nil && item.plan.Action != common.ImportActionMerge {
+			err = ValidateClusterCredentials(&model.Cluster{Config: model.SecretString(item.config)})
+		}
+		if err != nil {
+			item.result = failedImport(item.plan, err)
+			continue
+		}
+		targets[item.plan.Name] = true
+	}
+	return items, nil
+}
+
+func failedImport(plan common.KubeconfigImportPlan, err error) common.KubeconfigImportResult {
+	return common.KubeconfigImportResult{
+		Kubeconfig: plan.Kubeconfig,
+		Context:    plan.Context,
+		Name:       plan.Name,
+		Action:     plan.Action,
+		Status:     common.ImportStatusFailed,
+		Error:      err.Error(),
+	}
+}
+
+// validateImport checks that the clusters of import and overwrite items are reachable
+func validateImport(ctx context.Context, items []*importItem) {
+	var wg sync.WaitGroup
+	for _, item := range items {
+		if item.result.Status != "" || item.plan.Action == common.ImportActionMerge {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			version, err := checkConnectivity(ctx, &model.Cluster{Name: item.plan.Name, Config: model.SecretString(item.config)})
+			if err != nil {
+				item.result = failedImport(item.plan, fmt.Errorf("cluster is not reachable: %w", err))
+				return
+			}
+			item.result.Version = version
+		}()
+	}
+	wg.Wait()
+}
+
+// commitImport saves an item, it is only called for items that passed planning and validation
+func commitImport(item *importItem, existing *model.Cluster, makeDefault bool) error {
+	switch {
+	case item.plan.Action == common.ImportActionMerge:
+		item.result.Status = common.ImportStatusUpdated
+		return model.UpdateCluster(existing, map[string]interface{}{"prometheus_url": item.plan.PrometheusURL})
+	case existing != nil:
+		updates := map[string]interface{}{
+			"config":     model.SecretString(item.config),
+			"auth_type":  model.ClusterAuthKubeconfig,
+			"in_cluster": false,
+		}
+		if item.plan.PrometheusURL != "" {
+			updates["prometheus_url"] = item.plan.PrometheusURL
+		}
+		item.result.Status = common.ImportStatusUpdated
+		return model.UpdateCluster(existing, updates)
+	default:
+		item.result.Status = common.ImportStatusCreated
+		return model.AddCluster(&model.Cluster{
+			Name:          item.plan.Name,
+			Config:        model.SecretString(item.config),
+			PrometheusURL: item.plan.PrometheusURL,
+			IsDefault:     makeDefault,
+			Enable:        true,
+		})
+	}
+}
+
+// ImportKubeconfigs imports the contexts of kubeconfigs following a per
+// context plan. Clusters are checked for connectivity before they are saved,
+// every context gets a result.
+func (cm *ClusterManager) ImportKubeconfigs(c *gin.Context) {
+	var req common.KubeconfigImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clusters, err := model.ListClusters()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	existing := make(map[string]*model.Cluster, len(clusters))
+	hasDefault := false
+	for _, cluster := range clusters {
+		existing[cluster.Name] = cluster
+		hasDefault = hasDefault || cluster.IsDefault
+	}
+
+	items, err := planKubeconfigImport(&req, existing)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.SkipValidation {
+		validateImport(c.Request.Context(), items)
+	}
+
+	changed := false
+	results := make([]common.KubeconfigImportResult, 0, len(items))
+	for _, item := range items {
+		if item.result.Status == "" {
+			if req.DryRun {
+				item.result.Status = common.ImportStatusUpdated
+				if _, ok := existing[item.plan.Name]; !ok {
+					item.result.Status = common.ImportStatusCreated
+				}
+			} else {
+				// The current context of the first kubeconfig becomes the default cluster if there is none
+				makeDefault := !hasDefault && item.current && item.plan.Kubeconfig == 0 && existing[item.plan.Name] == nil
+				if err := commitImport(item, existing[item.plan.Name], makeDefault); err != nil {
+					klog.Warningf("Failed to import context %s as cluster %s: %v", item.plan.Context, item.plan.Name, err)
+					item.result = failedImport(item.plan, err)
+				} else {
+					changed = true
+					hasDefault = hasDefault || makeDefault
+				}
+			}
+		}
+		results = append(results, item.result)
+	}
+
+	if changed {
+		syncNow <- struct{}{}
+	}
+	c.JSON(http.StatusOK, gin.H{"dryRun": req.DryRun, "results": results})
+}
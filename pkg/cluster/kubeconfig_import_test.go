@@ -0,0 +1,155 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/model"
+	"gorm.io/gorm"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func testKubeconfig(t *testing.T, current string, contexts ...string) string {
+	t.Helper()
+	config := clientcmdapi.NewConfig()
+	for _, name := range contexts {
+		config.Clusters[name] = &clientcmdapi.Cluster{Server: "https://" + name + ".example.com"}
+		config.AuthInfos[name] = &clientcmdapi.AuthInfo{Token: "token-" + name}
+		config.Contexts[name] = &clientcmdapi.Context{Cluster: name, AuthInfo: name}
+	}
+	config.CurrentContext = current
+	content, err := clientcmd.Write(*config)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func runImport(t *testing.T, req common.KubeconfigImportRequest) (int, []common.KubeconfigImportResult) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	new(ClusterManager).ImportKubeconfigs(c)
+	// Drain the sync request of the handler
+	select {
+	case <-syncNow:
+	default:
+	}
+	var resp struct {
+		Results []common.KubeconfigImportResult `json:"results"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp.Results
+}
+
+func TestImportKubeconfigs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Cluster{}))
+	prev := model.DB
+	model.DB = db
+	t.Cleanup(func() { model.DB = prev })
+
+	prevCheck := checkConnectivity
+	checkConnectivity = func(ctx context.Context, cluster *model.Cluster) (string, error) {
+		if cluster.Name == "down" {
+			return "", errors.New("connection refused")
+		}
+		return "v1.31.0", nil
+	}
+	t.Cleanup(func() { checkConnectivity = prevCheck })
+
+	require.NoError(t, model.AddCluster(&model.Cluster{Name: "staging", Config: "old", PrometheusURL: "http://old", Enable: true}))
+	require.NoError(t, model.AddCluster(&model.Cluster{Name: "dev", Config: "dev", Enable: true}))
+
+	code, results := runImport(t, common.KubeconfigImportRequest{
+		Kubeconfigs: []string{
+			testKubeconfig(t, "prod", "prod", "staging", "dev", "down", "ignored"),
+			testKubeconfig(t, "dev", "dev"),
+		},
+		Plan: []common.KubeconfigImportPlan{
+			{Context: "prod", Name: "prod-eu"},
+			{Context: "staging", Action: common.ImportActionOverwrite},
+			{Context: "dev", Action: common.ImportActionMerge, PrometheusURL: "http://prom"},
+			{Context: "ignored", Action: common.ImportActionSkip},
+			{Context: "missing"},
+			{Kubeconfig: 1, Context: "dev"},
+		},
+	})
+	require.Equal(t, http.StatusOK, code)
+
+	status := map[string]common.KubeconfigImportResult{}
+	for _, r := range results {
+		status[r.Context+"/"+r.Name+"/"+string(rune('0'+r.Kubeconfig))] = r
+	}
+	assert.Equal(t, common.ImportStatusCreated, status["prod/prod-eu/0"].Status)
+	assert.Equal(t, "v1.31.0", status["prod/prod-eu/0"].Version)
+	assert.Equal(t, common.ImportStatusUpdated, status["staging/staging/0"].Status)
+	assert.Equal(t, common.ImportStatusUpdated, status["dev/dev/0"].Status)
+	assert.Equal(t, common.ImportStatusSkipped, status["ignored/ignored/0"].Status)
+	assert.Equal(t, common.ImportStatusFailed, status["down/down/0"].Status)
+	assert.Contains(t, status["down/down/0"].Error, "not reachable")
+	assert.Equal(t, "context missing not found", status["missing/missing/0"].Error)
+	assert.Contains(t, status["dev/dev/1"].Error, "already exists")
+	assert.Len(t, results, 7)
+
+	prod, err := model.GetClusterByName("prod-eu")
+	require.NoError(t, err)
+	assert.True(t, prod.IsDefault, "the current context becomes the default cluster")
+	_, err = model.GetClusterByName("down")
+	assert.Error(t, err, "unreachable clusters are not saved")
+
+	staging, err := model.GetClusterByName("staging")
+	require.NoError(t, err)
+	assert.Contains(t, string(staging.Config), "staging.example.com")
+	assert.Equal(t, "http://old", staging.PrometheusURL, "overwrite keeps the Prometheus URL")
+
+	dev, err := model.GetClusterByName("dev")
+	require.NoError(t, err)
+	assert.Equal(t, "dev", string(dev.Config), "merge keeps the credentials")
+	assert.Equal(t, "http://prom", dev.PrometheusURL)
+}
+
+func TestImportKubeconfigsDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Cluster{}))
+	prev := model.DB
+	model.DB = db
+	t.Cleanup(func() { model.DB = prev })
+
+	code, results := runImport(t, common.KubeconfigImportRequest{
+		Kubeconfigs:    []string{testKubeconfig(t, "a", "a", "b")},
+		Plan:           []common.KubeconfigImportPlan{{Context: "a", Name: "x"}, {Context: "b", Name: "x"}},
+		DryRun:         true,
+		SkipValidation: true,
+	})
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, results, 2)
+	assert.Equal(t, common.ImportStatusCreated, results[0].Status)
+	assert.Contains(t, results[1].Error, "target of more than one context")
+	count, err := model.CountClusters()
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	code, _ = runImport(t, common.KubeconfigImportRequest{Kubeconfigs: []string{"{"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = runImport(t, common.KubeconfigImportRequest{
+		Kubeconfigs: []string{testKubeconfig(t, "a", "a")},
+		Plan:        []common.KubeconfigImportPlan{{Kubeconfig: 3, Context: "a"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,140 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// connectRetryInterval is how long a failed connection is reported before
+// the next request tries again
+const connectRetryInterval = 30 * time.Second
+
+// ErrClusterWarmingUp is returned for requests to a cluster whose informer
+// caches are still syncing after it was connected on first use
+var ErrClusterWarmingUp = errors.New("cluster is warming up")
+
+type connectAttempt struct {
+	running    bool
+	err        error
+	finishedAt time.Time
+}
+
+// isPinned reports whether the cluster is connected at startup and never
+// disconnected when idle. Event recording needs the informers running.
+func isPinned(cluster *model.Cluster) bool {
+	return cluster.AlwaysOn || cluster.IsDefault || cluster.RecordEvents
+}
+
+// connect starts connecting a cluster in the background unless it is
+// already connecting or failed recently
+func (cm *ClusterManager) connect(cluster *model.Cluster) error {
+	cm.connMu.Lock()
+	defer cm.connMu.Unlock()
+	if cm.connecting == nil {
+		cm.connecting = make(map[string]*connectAttempt)
+	}
+	if a, ok := cm.connecting[cluster.Name]; ok {
+		if a.running {
+			return fmt.Errorf("%w: %s", ErrClusterWarmingUp, cluster.Name)
+		}
+		if time.Since(a.finishedAt) < connectRetryInterval {
+			return fmt.Errorf("failed to connect to cluster %s: %w", cluster.Name, a.err)
+		}
+	}
+	cm.connecting[cluster.Name] = &connectAttempt{running: true}
+	go cm.connectCluster(cluster)
+	return fmt.Errorf("%w: %s", ErrClusterWarmingUp, cluster.Name)
+}
+
+func (cm *ClusterManager) isConnecting(name string) bool {
+	cm.connMu.Lock()
+	defer cm.connMu.Unlock()
+	a, ok := cm.connecting[name]
+	return ok && a.running
+}
+
+func (cm *ClusterManager) connectCluster(cluster *model.Cluster) {
+	klog.Infof("Connecting cluster %s on first use", cluster.Name)
+	cs, err := buildClientSet(cluster)
+
+	cm.syncMu.Lock()
+	prev := cm.load()
+	var events []ClusterEvent
+	latest, enabled := prev.configs[cluster.Name]
+	switch {
+	case !enabled || !latest.UpdatedAt.Equal(cluster.UpdatedAt) || prev.clusters[cluster.Name] != nil:
+		// The cluster was changed or connected by syncClusters meanwhile,
+		// the next request starts over with the current settings
+		if cs != nil {
+			cs.retire()
+		}
+		err = nil
+	case err != nil:
+		klog.Errorf("Failed to connect cluster %s: %v", cluster.Name, err)
+		next := prev.clone()
+		next.errors[cluster.Name] = err.Error()
+		cm.snapshot.Store(next)
+	default:
+		next := prev.clone()
+		next.clusters[cluster.Name] = cs
+		delete(next.errors, cluster.Name)
+		cm.snapshot.Store(next)
+		events = append(events, ClusterEvent{Type: ClusterAdded, Name: cluster.Name, ClientSet: cs})
+	}
+	cm.syncMu.Unlock()
+	cm.publish(events)
+
+	cm.connMu.Lock()
+	defer cm.connMu.Unlock()
+	if err != nil {
+		cm.connecting[cluster.Name] = &connectAttempt{err: err, finishedAt: time.Now()}
+	} else {
+		delete(cm.connecting, cluster.Name)
+	}
+}
+
+// idleFor reports whether the ClientSet had no requests for at least d
+func (cs *ClientSet) idleFor(d time.Duration, now time.Time) bool {
+	cs.lifecycle.mu.Lock()
+	defer cs.lifecycle.mu.Unlock()
+	return cs.lifecycle.refs == 0 && now.Sub(cs.lifecycle.lastUsed) >= d
+}
+
+// disconnectIdleClusters stops the clients of clusters that were not used
+// for CLUSTER_IDLE_TIMEOUT, they connect again on the next request
+func (cm *ClusterManager) disconnectIdleClusters(now time.Time) {
+	if common.ClusterIdleTimeout <= 0 {
+		return
+	}
+	cm.syncMu.Lock()
+	defer cm.syncMu.Unlock()
+	prev := cm.load()
+	var idle []*ClientSet
+	for name, cs := range prev.clusters {
+		cluster, ok := prev.configs[name]
+		if !ok || isPinned(cluster) || !cs.idleFor(common.ClusterIdleTimeout, now) {
+			continue
+		}
+		idle = append(idle, cs)
+	}
+	if len(idle) == 0 {
+		return
+	}
+	next := prev.clone()
+	events := make([]ClusterEvent, 0, len(idle))
+	for _, cs := range idle {
+		delete(next.clusters, cs.Name)
+		events = append(events, ClusterEvent{Type: ClusterDisconnected, Name: cs.Name})
+	}
+	cm.snapshot.Store(next)
+	for _, cs := range idle {
+		klog.Infof("Disconnecting cluster %s, it was not used for %s", cs.Name, common.ClusterIdleTimeout)
+		cs.retire()
+	}
+	cm.publish(events)
+}
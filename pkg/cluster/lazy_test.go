@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/model"
+)
+
+func TestGetClientSetConnectsOnFirstUse(t *testing.T) {
+	cm := new(ClusterManager)
+	broken := &model.Cluster{Name: "broken", Enable: true, Config: "not a kubeconfig"}
+	cm.snapshot.Store(&clusterSnapshot{configs: map[string]*model.Cluster{"broken": broken}})
+
+	_, err := cm.GetClientSet("broken")
+	require.True(t, errors.Is(err, ErrClusterWarmingUp), "got %v", err)
+
+	require.Eventually(t, func() bool {
+		_, failed := cm.load().errors["broken"]
+		return failed && !cm.isConnecting("broken")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A failed connection is reported until the retry interval passed
+	_, err = cm.GetClientSet("broken")
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, ErrClusterWarmingUp))
+	assert.Contains(t, err.Error(), "failed to connect to cluster broken")
+
+	_, err = cm.GetClientSet("missing")
+	assert.EqualError(t, err, "cluster not found: missing")
+}
+
+func TestDisconnectIdleClusters(t *testing.T) {
+	timeout := common.ClusterIdleTimeout
+	common.ClusterIdleTimeout = time.Minute
+	defer func() { common.ClusterIdleTimeout = timeout }()
+
+	now := time.Now()
+	idle := newTestClientSet("idle")
+	pinned := newTestClientSet("pinned")
+	busy := newTestClientSet("busy")
+	recent := newTestClientSet("recent")
+	require.True(t, busy.acquire())
+	require.True(t, recent.acquire())
+	recent.release()
+
+	cm := new(ClusterManager)
+	var disconnected []string
+	cm.Subscribe(func(e ClusterEvent) {
+		if e.Type == ClusterDisconnected {
+			disconnected = append(disconnected, e.Name)
+		}
+	})
+	cm.snapshot.Store(&clusterSnapshot{
+		clusters: map[string]*ClientSet{"idle": idle, "pinned": pinned, "busy": busy, "recent": recent},
+		configs: map[string]*model.Cluster{
+			"idle":   {Name: "idle", Enable: true},
+			"pinned": {Name: "pinned", Enable: true, AlwaysOn: true},
+			"busy":   {Name: "busy", Enable: true},
+			"recent": {Name: "recent", Enable: true},
+		},
+	})
+	// recent was just released, the others were last used two minutes ago
+	idle.lifecycle.lastUsed = now.Add(-2 * time.Minute)
+	pinned.lifecycle.lastUsed = now.Add(-2 * time.Minute)
+	busy.lifecycle.lastUsed = now.Add(-2 * time.Minute)
+
+	cm.disconnectIdleClusters(now)
+
+	assert.Equal(t, []string{"idle"}, disconnected)
+	assert.True(t, isStopped(idle))
+	snapshot := cm.load()
+	assert.NotContains(t, snapshot.clusters, "idle")
+	assert.Contains(t, snapshot.configs, "idle", "idle clusters reconnect on the next request")
+	assert.Len(t, snapshot.clusters, 3)
+	assert.Equal(t, common.ClusterStateIdle, cm.state(snapshot, "idle"))
+	assert.Equal(t, common.ClusterStateConnected, cm.state(snapshot, "busy"))
+}
+
+func TestIsPinned(t *testing.T) {
+	assert.False(t, isPinned(&model.Cluster{}))
+	assert.True(t, isPinned(&model.Cluster{AlwaysOn: true}))
+	assert.True(t, isPinned(&model.Cluster{IsDefault: true}))
+	assert.True(t, isPinned(&model.Cluster{RecordEvents: true}))
+}
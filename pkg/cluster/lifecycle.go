@@ -0,0 +1,174 @@
+package cluster
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// clientSetDrainTimeout bounds how long a replaced ClientSet waits for its
+// sessions, a hung WebSocket must not keep the old informers running forever
+const clientSetDrainTimeout = time.Hour
+
+// clientSetLifecycle counts the requests using a ClientSet. A ClientSet that
+// was replaced or removed is retired: it leaves the snapshot at once, but is
+// only stopped after the last request released it.
+type clientSetLifecycle struct {
+	mu       sync.Mutex
+	refs     int
+	retired  bool
+	stopped  bool
+	lastUsed time.Time
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// acquire takes a reference, it fails when the ClientSet is already retired
+func (cs *ClientSet) acquire() bool {
+	cs.lifecycle.mu.Lock()
+	defer cs.lifecycle.mu.Unlock()
+	if cs.lifecycle.retired {
+		return false
+	}
+	cs.lifecycle.refs++
+	cs.lifecycle.lastUsed = time.Now()
+	return true
+}
+
+// release drops a reference taken by acquire
+func (cs *ClientSet) release() {
+	cs.lifecycle.mu.Lock()
+	cs.lifecycle.refs--
+	cs.lifecycle.lastUsed = time.Now()
+	drained := cs.lifecycle.retired && cs.lifecycle.refs == 0
+	cs.lifecycle.mu.Unlock()
+	if drained {
+		cs.stopOnce()
+	}
+}
+
+// retire removes the ClientSet from service, it is stopped immediately when
+// idle, or once the active sessions are released
+func (cs *ClientSet) retire() {
+	cs.lifecycle.mu.Lock()
+	if cs.lifecycle.retired {
+		cs.lifecycle.mu.Unlock()
+		return
+	}
+	cs.lifecycle.retired = true
+	if cs.lifecycle.done == nil {
+		cs.lifecycle.done = make(chan struct{})
+	}
+	close(cs.lifecycle.done)
+	refs := cs.lifecycle.refs
+	cs.lifecycle.mu.Unlock()
+	// Background work stops at once, the new ClientSet takes it over
+	if cs.eventRecorder != nil {
+		cs.eventRecorder.stop()
+	}
+	if refs == 0 {
+		cs.stopOnce()
+		return
+	}
+	klog.Infof("Cluster %s was replaced, waiting for %d active sessions before stopping the old client", cs.Name, refs)
+	time.AfterFunc(clientSetDrainTimeout, func() {
+		cs.lifecycle.mu.Lock()
+		stopped := cs.lifecycle.stopped
+		cs.lifecycle.mu.Unlock()
+		if !stopped {
+			klog.Warningf("Cluster %s still has active sessions after %s, stopping the old client", cs.Name, clientSetDrainTimeout)
+			cs.stopOnce()
+		}
+	})
+}
+
+func (cs *ClientSet) stopOnce() {
+	cs.lifecycle.stopOnce.Do(func() {
+		cs.lifecycle.mu.Lock()
+		cs.lifecycle.stopped = true
+		cs.lifecycle.mu.Unlock()
+		cs.stop()
+	})
+}
+
+// retiredChan returns the channel closed on retire, it is created lazily so
+// ClientSet literals in tests work
+func (cs *ClientSet) retiredChan() chan struct{} {
+	cs.lifecycle.mu.Lock()
+	defer cs.lifecycle.mu.Unlock()
+	if cs.lifecycle.done == nil {
+		cs.lifecycle.done = make(chan struct{})
+	}
+	return cs.lifecycle.done
+}
+
+// Retired is closed when the cluster was updated or removed. Long running
+// sessions such as watches should end, the client keeps working until they
+// return so they can close cleanly.
+func (cs *ClientSet) Retired() <-chan struct{} {
+	return cs.retiredChan()
+}
+
+// ActiveSessions returns the number of requests currently using the ClientSet
+func (cs *ClientSet) ActiveSessions() int {
+	cs.lifecycle.mu.Lock()
+	defer cs.lifecycle.mu.Unlock()
+	return cs.lifecycle.refs
+}
+
+// ClusterEventType is the kind of change announced to subscribers
+type ClusterEventType string
+
+const (
+	ClusterAdded   ClusterEventType = "added"
+	ClusterUpdated ClusterEventType = "updated"
+	ClusterRemoved ClusterEventType = "removed"
+	// ClusterDisconnected is sent for clusters disconnected when idle, they
+	// are still enabled and connect again on the next request
+	ClusterDisconnected ClusterEventType = "disconnected"
+)
+
+// ClusterEvent announces a change of the connected clusters. ClientSet is the
+// new client for added and updated clusters and nil otherwise.
+type ClusterEvent struct {
+	Type      ClusterEventType
+	Name      string
+	ClientSet *ClientSet
+}
+
+// Subscribe registers fn to be called after every change of the connected
+// clusters. Callbacks run on the sync goroutine in order and must not block.
+// The returned function removes the subscription.
+func (cm *ClusterManager) Subscribe(fn func(ClusterEvent)) func() {
+	cm.subMu.Lock()
+	defer cm.subMu.Unlock()
+	if cm.subscribers == nil {
+		cm.subscribers = make(map[int]func(ClusterEvent))
+	}
+	id := cm.nextSubscriber
+	cm.nextSubscriber++
+	cm.subscribers[id] = fn
+	return func() {
+		cm.subMu.Lock()
+		defer cm.subMu.Unlock()
+		delete(cm.subscribers, id)
+	}
+}
+
+func (cm *ClusterManager) publish(events []ClusterEvent) {
+	if len(events) == 0 {
+		return
+	}
+	cm.subMu.Lock()
+	subscribers := make([]func(ClusterEvent), 0, len(cm.subscribers))
+	for _, fn := range cm.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	cm.subMu.Unlock()
+	for _, e := range events {
+		for _, fn := range subscribers {
+			fn(e)
+		}
+	}
+}
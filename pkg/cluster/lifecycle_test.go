@@ -0,0 +1,131 @@
+package cluster
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zxh326/kite/pkg/kube"
+)
+
+func newTestClientSet(name string) *ClientSet {
+	return &ClientSet{Name: name, K8sClient: &kube.K8sClient{}}
+}
+
+func isStopped(cs *ClientSet) bool {
+	cs.lifecycle.mu.Lock()
+	defer cs.lifecycle.mu.Unlock()
+	return cs.lifecycle.stopped
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestClientSetRetireWaitsForSessions(t *testing.T) {
+	cs := newTestClientSet("test")
+	require.True(t, cs.acquire())
+	require.True(t, cs.acquire())
+
+	cs.retire()
+	assert.True(t, isClosed(cs.Retired()))
+	assert.False(t, isStopped(cs), "retired ClientSet must keep running while sessions are active")
+	assert.False(t, cs.acquire(), "retired ClientSet must not accept new sessions")
+
+	cs.release()
+	assert.False(t, isStopped(cs))
+	cs.release()
+	assert.True(t, isStopped(cs))
+	assert.Equal(t, 0, cs.ActiveSessions())
+}
+
+func TestClientSetRetireIdleStopsImmediately(t *testing.T) {
+	cs := newTestClientSet("test")
+	assert.False(t, isClosed(cs.Retired()))
+	cs.retire()
+	cs.retire()
+	assert.True(t, isStopped(cs))
+}
+
+func TestAcquireClientSet(t *testing.T) {
+	cm := new(ClusterManager)
+	_, _, err := cm.AcquireClientSet("a")
+	assert.Error(t, err)
+
+	a := newTestClientSet("a")
+	cm.snapshot.Store(&clusterSnapshot{clusters: map[string]*ClientSet{"a": a}, defaultContext: "a"})
+
+	cs, release, err := cm.AcquireClientSet("")
+	require.NoError(t, err)
+	assert.Same(t, a, cs)
+	assert.Equal(t, 1, a.ActiveSessions())
+
+	// Replace the cluster while the session is open
+	a2 := newTestClientSet("a")
+	cm.snapshot.Store(&clusterSnapshot{clusters: map[string]*ClientSet{"a": a2}, defaultContext: "a"})
+	a.retire()
+	assert.False(t, isStopped(a))
+
+	cs, release2, err := cm.AcquireClientSet("a")
+	require.NoError(t, err)
+	assert.Same(t, a2, cs)
+
+	release()
+	assert.True(t, isStopped(a))
+	release2()
+	assert.False(t, isStopped(a2))
+
+	_, _, err = cm.AcquireClientSet("b")
+	assert.EqualError(t, err, "cluster not found: b")
+}
+
+func TestSubscribe(t *testing.T) {
+	cm := new(ClusterManager)
+	var got []ClusterEvent
+	unsubscribe := cm.Subscribe(func(e ClusterEvent) { got = append(got, e) })
+
+	events := []ClusterEvent{
+		{Type: ClusterAdded, Name: "a"},
+		{Type: ClusterRemoved, Name: "b"},
+	}
+	cm.publish(events)
+	assert.Equal(t, events, got)
+
+	unsubscribe()
+	cm.publish([]ClusterEvent{{Type: ClusterUpdated, Name: "a"}})
+	assert.Len(t, got, 2)
+}
+
+func TestSnapshotConcurrentAccess(t *testing.T) {
+	cm := new(ClusterManager)
+	cm.snapshot.Store(&clusterSnapshot{clusters: map[string]*ClientSet{"a": newTestClientSet("a")}})
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				if cs, release, err := cm.AcquireClientSet("a"); err == nil {
+					assert.False(t, isStopped(cs), "worker %d got a stopped ClientSet", i)
+					release()
+				}
+				_ = cm.ClientSets()
+			}
+		}()
+	}
+	for i := range 50 {
+		prev := cm.load()
+		next := &clusterSnapshot{clusters: map[string]*ClientSet{"a": newTestClientSet(fmt.Sprint("a", i))}}
+		cm.snapshot.Store(next)
+		prev.clusters["a"].retire()
+	}
+	wg.Wait()
+}
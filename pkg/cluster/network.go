@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/zxh326/kite/pkg/model"
+	"k8s.io/client-go/rest"
+)
+
+// clusterProxyURL returns the proxy of a cluster with its credentials, nil without a proxy
+func clusterProxyURL(cluster *model.Cluster) (*url.URL, error) {
+	if cluster.ProxyURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(cluster.ProxyURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("proxyURL must be an http, https or socks5 URL")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("proxyURL must be an http, https or socks5 URL")
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("proxyURL must not contain credentials, set proxyUsername and proxyPassword instead")
+	}
+	if cluster.ProxyUsername != "" {
+		u.User = url.UserPassword(cluster.ProxyUsername, string(cluster.ProxyPassword))
+	}
+	return u, nil
+}
+
+// applyNetworkSettings routes the connections to the API server through the
+// proxy of the cluster, replacing a proxy-url of the kubeconfig, and sets the
+// TLS server name. Streaming (exec, attach, logs) uses the same config.
+func applyNetworkSettings(cluster *model.Cluster, config *rest.Config) error {
+	proxy, err := clusterProxyURL(cluster)
+	if err != nil {
+		return err
+	}
+	if proxy != nil {
+		config.Proxy = http.ProxyURL(proxy)
+	}
+	if cluster.TLSServerName != "" {
+		config.ServerName = cluster.TLSServerName
+	}
+	return nil
+}
+
+// ValidateClusterNetwork checks the proxy settings of a cluster before it is saved
+func ValidateClusterNetwork(cluster *model.Cluster) error {
+	if _, err := clusterProxyURL(cluster); err != nil {
+		return err
+	}
+	if cluster.ProxyURL == "" && cluster.ProxyUsername != "" {
+		return fmt.Errorf("proxyUsername requires a proxyURL")
+	}
+	return nil
+}
+
+// networkKey identifies the network settings of a cluster, a change reconnects it
+func networkKey(cluster *model.Cluster) string {
+	if cluster.ProxyURL == "" && cluster.TLSServerName == "" {
+		return ""
+	}
+	h := sha256.New()
+	for _, v := range []string{cluster.ProxyURL, cluster.ProxyUsername, string(cluster.ProxyPassword), cluster.TLSServerName} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// backendTransport returns the transport for a backend outside the cluster,
+// it uses the proxy of the API server so backends behind the same bastion
+// are reachable
+func backendTransport(k8sConfig *rest.Config) http.RoundTripper {
+	if k8sConfig.Proxy == nil {
+		return http.DefaultTransport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = k8sConfig.Proxy
+	return transport
+}
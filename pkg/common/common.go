@@ -2,6 +2,7 @@ package common
 
 import (
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -42,6 +43,27 @@ var (
 	DisableVersionCheck = false
 
 	APIKeyProvider = "api_key"
+
+	EnableTerminalRecording              = false
+	TerminalRecordingStorage             = "db"
+	TerminalRecordingDir                 = "recordings"
+	TerminalRecordingRetentionDays       = 30
+	TerminalRecordingMaxSize       int64 = 32 << 20 // 32MiB
+
+	LogStreamMaxStreams = 50
+	LogStreamBufferSize = 1000
+	LogStreamOverflow   = "block"
+
+	EventArchiveRetentionDays = 7
+	EventArchiveMaxEvents     = 50000
+
+	AlertEvaluationInterval     = time.Minute
+	AlertNotificationMaxRecords = 10000
+
+	ClusterHealthInterval = 30 * time.Second
+
+	// ClusterIdleTimeout disconnects clusters that were not used for this long, 0 keeps them connected
+	ClusterIdleTimeout = 30 * time.Minute
 )
 
 func LoadEnvs() {
@@ -93,6 +115,100 @@ func LoadEnvs() {
 		DisableVersionCheck = true
 	}
 
+	if v := os.Getenv("ENABLE_TERMINAL_RECORDING"); v == "true" {
+		EnableTerminalRecording = true
+	}
+	if v := os.Getenv("TERMINAL_RECORDING_STORAGE"); v != "" {
+		if v != "db" && v != "file" {
+			klog.Fatalf("Invalid TERMINAL_RECORDING_STORAGE: %s, must be one of db, file", v)
+		}
+		TerminalRecordingStorage = v
+	}
+	if v := os.Getenv("TERMINAL_RECORDING_DIR"); v != "" {
+		TerminalRecordingDir = v
+	}
+	if v := os.Getenv("TERMINAL_RECORDING_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			klog.Fatalf("Invalid TERMINAL_RECORDING_RETENTION_DAYS: %s", v)
+		}
+		TerminalRecordingRetentionDays = days
+	}
+	if v := os.Getenv("TERMINAL_RECORDING_MAX_SIZE"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			klog.Fatalf("Invalid TERMINAL_RECORDING_MAX_SIZE: %s", v)
+		}
+		TerminalRecordingMaxSize = size
+	}
+
+	if v := os.Getenv("LOG_STREAM_MAX_STREAMS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			klog.Fatalf("Invalid LOG_STREAM_MAX_STREAMS: %s", v)
+		}
+		LogStreamMaxStreams = n
+	}
+	if v := os.Getenv("LOG_STREAM_BUFFER_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			klog.Fatalf("Invalid LOG_STREAM_BUFFER_SIZE: %s", v)
+		}
+		LogStreamBufferSize = n
+	}
+	if v := os.Getenv("LOG_STREAM_OVERFLOW"); v != "" {
+		if v != "block" && v != "drop" && v != "disconnect" {
+			klog.Fatalf("Invalid LOG_STREAM_OVERFLOW: %s, must be one of block, drop, disconnect", v)
+		}
+		LogStreamOverflow = v
+	}
+
+	if v := os.Getenv("EVENT_ARCHIVE_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			klog.Fatalf("Invalid EVENT_ARCHIVE_RETENTION_DAYS: %s", v)
+		}
+		EventArchiveRetentionDays = days
+	}
+	if v := os.Getenv("EVENT_ARCHIVE_MAX_EVENTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			klog.Fatalf("Invalid EVENT_ARCHIVE_MAX_EVENTS: %s", v)
+		}
+		EventArchiveMaxEvents = n
+	}
+
+	if v := os.Getenv("ALERT_EVALUATION_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 10*time.Second {
+			klog.Fatalf("Invalid ALERT_EVALUATION_INTERVAL: %s, must be a duration of at least 10s", v)
+		}
+		AlertEvaluationInterval = d
+	}
+	if v := os.Getenv("ALERT_NOTIFICATION_MAX_RECORDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			klog.Fatalf("Invalid ALERT_NOTIFICATION_MAX_RECORDS: %s", v)
+		}
+		AlertNotificationMaxRecords = n
+	}
+
+	if v := os.Getenv("CLUSTER_HEALTH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 5*time.Second {
+			klog.Fatalf("Invalid CLUSTER_HEALTH_INTERVAL: %s, must be a duration of at least 5s", v)
+		}
+		ClusterHealthInterval = d
+	}
+
+	if v := os.Getenv("CLUSTER_IDLE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || (d != 0 && d < time.Minute) {
+			klog.Fatalf("Invalid CLUSTER_IDLE_TIMEOUT: %s, must be 0 or a duration of at least 1m", v)
+		}
+		ClusterIdleTimeout = d
+	}
+
 	if v := os.Getenv("KITE_BASE"); v != "" {
 		if v[0] != '/' {
 			v = "/" + v
@@ -10,15 +10,20 @@ const (
 	VerbDelete Verb = "delete"
 	VerbLog    Verb = "log"
 	VerbExec   Verb = "exec"
+	VerbAttach Verb = "attach"
 )
 
 type Role struct {
 	Name        string   `yaml:"name" json:"name"`
 	Description string   `yaml:"description" json:"-"`
 	Clusters    []string `yaml:"clusters" json:"clusters"`
-	Resources   []string `yaml:"resources" json:"resources"`
-	Namespaces  []string `yaml:"namespaces" json:"namespaces"`
-	Verbs       []string `yaml:"verbs" json:"verbs"`
+	// ClusterSelector is a label selector matching clusters by their labels, e.g. env!=prod
+	ClusterSelector string   `yaml:"clusterSelector,omitempty" json:"clusterSelector,omitempty"`
+	Resources       []string `yaml:"resources" json:"resources"`
+	Namespaces      []string `yaml:"namespaces" json:"namespaces"`
+	Verbs           []string `yaml:"verbs" json:"verbs"`
+	// Commands lists the terminal commands the role may run besides the default shell
+	Commands []string `yaml:"commands,omitempty" json:"commands,omitempty"`
 }
 
 type RoleMapping struct {
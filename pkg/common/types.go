@@ -1,6 +1,8 @@
 package common
 
 import (
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -41,11 +43,89 @@ type ImportClustersRequest struct {
 	InCluster bool   `json:"inCluster"`
 }
 
+const (
+	ImportActionImport    = "import"
+	ImportActionOverwrite = "overwrite"
+	ImportActionMerge     = "merge"
+	ImportActionSkip      = "skip"
+
+	ImportStatusCreated = "created"
+	ImportStatusUpdated = "updated"
+	ImportStatusSkipped = "skipped"
+	ImportStatusFailed  = "failed"
+)
+
+// KubeconfigImportRequest imports the contexts of one or more kubeconfigs
+type KubeconfigImportRequest struct {
+	Kubeconfigs []string               `json:"kubeconfigs" binding:"required,min=1"`
+	Plan        []KubeconfigImportPlan `json:"plan"`
+	// DefaultAction applies to contexts without a plan entry, import (default) or skip
+	DefaultAction string `json:"defaultAction"`
+	// DryRun validates the plan without saving anything
+	DryRun bool `json:"dryRun"`
+	// SkipValidation saves clusters without checking that they are reachable
+	SkipValidation bool `json:"skipValidation"`
+}
+
+// KubeconfigImportPlan decides what happens to one context. Import creates a
+// cluster named Name (the context name by default), overwrite replaces the
+// kubeconfig of an existing cluster, merge only sets its Prometheus URL.
+type KubeconfigImportPlan struct {
+	Kubeconfig    int    `json:"kubeconfig"`
+	Context       string `json:"context" binding:"required"`
+	Action        string `json:"action"`
+	Name          string `json:"name"`
+	PrometheusURL string `json:"prometheusURL"`
+}
+
+type KubeconfigImportResult struct {
+	Kubeconfig int    `json:"kubeconfig"`
+	Context    string `json:"context"`
+	Name       string `json:"name"`
+	Action     string `json:"action"`
+	Status     string `json:"status"`
+	Version    string `json:"version,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
 type ClusterInfo struct {
-	Name      string `json:"name"`
-	Version   string `json:"version"`
-	IsDefault bool   `json:"isDefault"`
-	Error     string `json:"error,omitempty"`
+	Name      string            `json:"name"`
+	Version   string            `json:"version"`
+	IsDefault bool              `json:"isDefault"`
+	Error     string            `json:"error,omitempty"`
+	Health    *ClusterHealth    `json:"health,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// State is connected, connecting while the cluster warms up, or idle
+	State string `json:"state,omitempty"`
+}
+
+const (
+	ClusterStateConnected  = "connected"
+	ClusterStateConnecting = "connecting"
+	ClusterStateIdle       = "idle"
+)
+
+const (
+	ClusterHealthHealthy     = "healthy"
+	ClusterHealthDegraded    = "degraded"
+	ClusterHealthUnreachable = "unreachable"
+)
+
+// ClusterHealth is the result of the periodic health probe of a cluster
+type ClusterHealth struct {
+	Status string `json:"status"`
+	// Ready is whether /readyz answered ok, ReadyzError holds the reason otherwise
+	Ready           bool     `json:"ready"`
+	ReadyzError     string   `json:"readyzError,omitempty"`
+	LatencyMs       int64    `json:"latencyMs"`
+	DiscoveryErrors []string `json:"discoveryErrors,omitempty"`
+	// CacheSynced is false while watches of the informer cache fail, CacheErrors holds their errors
+	CacheSynced bool       `json:"cacheSynced"`
+	CacheErrors []string   `json:"cacheErrors,omitempty"`
+	LastCheck   time.Time  `json:"lastCheck"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	// ConsecutiveFailures counts the probes in a row that could not reach the API server
+	ConsecutiveFailures int `json:"consecutiveFailures"`
 }
 
 type MetricsCell struct {
@@ -72,3 +152,121 @@ type NodeListWithMetrics struct {
 	// +optional
 	metav1.ListMeta `json:"metadata" protobuf:"bytes,1,opt,name=metadata"`
 }
+
+// MultiClusterItem is an object returned by the multi-cluster list API
+type MultiClusterItem struct {
+	Cluster string                 `json:"cluster"`
+	Object  map[string]interface{} `json:"object"`
+}
+
+// MultiClusterFailure reports a cluster that could not be listed
+type MultiClusterFailure struct {
+	Cluster string `json:"cluster"`
+	Error   string `json:"error"`
+	// WarmingUp is set when the cluster is still connecting, a retry may succeed
+	WarmingUp bool `json:"warmingUp,omitempty"`
+	// Idle is set for idle clusters, which are only listed when named in clusters
+	Idle bool `json:"idle,omitempty"`
+}
+
+type MultiClusterListResponse struct {
+	Items []MultiClusterItem `json:"items"`
+	// Clusters were listed completely, Failures were not
+	Clusters []string              `json:"clusters"`
+	Failures []MultiClusterFailure `json:"failures"`
+}
+
+// ResourceRef selects a live object, or with HistoryID the snapshot of a
+// ResourceHistory entry. Previous selects the object before the recorded operation.
+type ResourceRef struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	// Kind is a resource name such as deployments or a kind such as Deployment
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	HistoryID uint   `json:"historyId"`
+	Previous  bool   `json:"previous"`
+}
+
+type ResourceDiffRequest struct {
+	Left  ResourceRef `json:"left" binding:"required"`
+	Right ResourceRef `json:"right" binding:"required"`
+}
+
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// ResourceDiffChange is a field that differs, Path is e.g. spec.template.spec.containers[name=app].image
+type ResourceDiffChange struct {
+	Path  string      `json:"path"`
+	Type  string      `json:"type"`
+	Left  interface{} `json:"left,omitempty"`
+	Right interface{} `json:"right,omitempty"`
+}
+
+type ResourceDiffResponse struct {
+	Identical bool                 `json:"identical"`
+	Changes   []ResourceDiffChange `json:"changes"`
+	Unified   string               `json:"unified"`
+	// Left and Right are the normalized objects
+	Left  map[string]interface{} `json:"left"`
+	Right map[string]interface{} `json:"right"`
+}
+
+// PromoteLocation is a cluster and namespace resources are promoted from or to
+type PromoteLocation struct {
+	Cluster   string `json:"cluster" binding:"required"`
+	Namespace string `json:"namespace"`
+}
+
+// PromoteResource is a resource given by resource name or kind, e.g.
+// deployments or Deployment
+type PromoteResource struct {
+	Kind string `json:"kind" binding:"required"`
+	Name string `json:"name" binding:"required"`
+}
+
+type PromoteRequest struct {
+	Source    PromoteLocation   `json:"source" binding:"required"`
+	Target    PromoteLocation   `json:"target" binding:"required"`
+	Resources []PromoteResource `json:"resources" binding:"required,min=1,dive"`
+	// IncludeRelated also promotes the ConfigMaps, Secrets and Services of workloads
+	IncludeRelated bool `json:"includeRelated"`
+	// Labels are added to the promoted objects
+	Labels map[string]string `json:"labels"`
+	// Images maps an image, or an image repository to keep the tag, to its replacement
+	Images map[string]string `json:"images"`
+	// Apply applies the plan, otherwise it is only validated with a server dry-run
+	Apply bool `json:"apply"`
+}
+
+const (
+	PromoteCreate    = "create"
+	PromoteUpdate    = "update"
+	PromoteUnchanged = "unchanged"
+	// PromoteSkip is the action of related objects missing in the source
+	PromoteSkip = "skip"
+)
+
+type PromoteItem struct {
+	Kind      string `json:"kind"`
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Related is set for objects included as dependencies of a workload
+	Related bool `json:"related"`
+	// Action is empty for objects that can not be promoted, see Error
+	Action string `json:"action,omitempty"`
+	// Changes are the changes to the object in the target, for updates
+	Changes []ResourceDiffChange `json:"changes,omitempty"`
+	Error   string               `json:"error,omitempty"`
+}
+
+type PromoteResponse struct {
+	// Applied is false for dry-runs and for plans with errors, which are not applied
+	Applied bool          `json:"applied"`
+	Items   []PromoteItem `json:"items"`
+}
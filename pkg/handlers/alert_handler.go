@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zxh326/kite/pkg/alert"
+	"github.com/zxh326/kite/pkg/model"
+)
+
+type AlertRuleRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Description   string   `json:"description"`
+	Enabled       bool     `json:"enabled"`
+	Condition     string   `json:"condition" binding:"required"`
+	Severity      string   `json:"severity"`
+	Clusters      []string `json:"clusters"`
+	Namespaces    []string `json:"namespaces"`
+	ForMinutes    int      `json:"forMinutes"`
+	Threshold     float64  `json:"threshold"`
+	RepeatMinutes int      `json:"repeatMinutes"`
+	TargetIDs     []uint   `json:"targetIds"`
+}
+
+type AlertTargetRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Type    string `json:"type" binding:"required"`
+	URL     string `json:"url"`
+	Enabled bool   `json:"enabled"`
+}
+
+type AlertSilenceRequest struct {
+	RuleID    uint      `json:"ruleId"`
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt" binding:"required"`
+	Comment   string    `json:"comment"`
+}
+
+// alertTargetResponse hides the webhook URL, it usually contains a token
+func alertTargetResponse(t model.AlertTarget) gin.H {
+	return gin.H{
+		"id":        t.ID,
+		"name":      t.Name,
+		"type":      t.Type,
+		"enabled":   t.Enabled,
+		"createdAt": t.CreatedAt,
+		"updatedAt": t.UpdatedAt,
+	}
+}
+
+func ListAlertRules(c *gin.Context) {
+	var rules []model.AlertRule
+	if err := model.DB.Preload("Targets").Order("name").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := make([]gin.H, 0, len(rules))
+	for _, rule := range rules {
+		targets := make([]gin.H, 0, len(rule.Targets))
+		for _, t := range rule.Targets {
+			targets = append(targets, alertTargetResponse(t))
+		}
+		result = append(result, gin.H{
+			"id":            rule.ID,
+			"name":          rule.Name,
+			"description":   rule.Description,
+			"enabled":       rule.Enabled,
+			"condition":     rule.Condition,
+			"severity":      rule.Severity,
+			"clusters":      rule.Clusters,
+			"namespaces":    rule.Namespaces,
+			"forMinutes":    rule.ForMinutes,
+			"threshold":     rule.Threshold,
+			"repeatMinutes": rule.RepeatMinutes,
+			"targets":       targets,
+			"createdAt":     rule.CreatedAt,
+			"updatedAt":     rule.UpdatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// bindAlertRule validates the request and copies it into rule, it writes the error response
+func bindAlertRule(c *gin.Context, rule *model.AlertRule) bool {
+	var req AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if !alert.IsValidCondition(req.Condition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown condition: " + req.Condition})
+		return false
+	}
+	if req.ForMinutes < 0 || req.RepeatMinutes < 0 || req.Threshold < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "forMinutes, repeatMinutes and threshold must not be negative"})
+		return false
+	}
+	var targets []model.AlertTarget
+	if len(req.TargetIDs) > 0 {
+		if err := model.DB.Find(&targets, req.TargetIDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		if len(targets) != len(req.TargetIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "alert target not found"})
+			return false
+		}
+	}
+
+	rule.Name = req.Name
+	rule.Description = req.Description
+	rule.Enabled = req.Enabled
+	rule.Condition = req.Condition
+	rule.Severity = req.Severity
+	rule.Clusters = req.Clusters
+	rule.Namespaces = req.Namespaces
+	rule.ForMinutes = req.ForMinutes
+	rule.Threshold = req.Threshold
+	rule.RepeatMinutes = req.RepeatMinutes
+	rule.Targets = targets
+	return true
+}
+
+func CreateAlertRule(c *gin.Context) {
+	var rule model.AlertRule
+	if !bindAlertRule(c, &rule) {
+		return
+	}
+	if err := model.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": rule.ID, "message": "alert rule created successfully"})
+}
+
+func UpdateAlertRule(c *gin.Context) {
+	var rule model.AlertRule
+	if err := model.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert rule not found"})
+		return
+	}
+	if !bindAlertRule(c, &rule) {
+		return
+	}
+	if err := model.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := model.DB.Model(&rule).Association("Targets").Replace(rule.Targets); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "alert rule updated successfully"})
+}
+
+func DeleteAlertRule(c *gin.Context) {
+	var rule model.AlertRule
+	if err := model.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert rule not found"})
+		return
+	}
+	if err := model.DB.Select("Targets").Delete(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "alert rule deleted"})
+}
+
+func ListAlertTargets(c *gin.Context) {
+	var targets []model.AlertTarget
+	if err := model.DB.Order("name").Find(&targets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := make([]gin.H, 0, len(targets))
+	for _, t := range targets {
+		result = append(result, alertTargetResponse(t))
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func CreateAlertTarget(c *gin.Context) {
+	var req AlertTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !alert.IsValidTargetType(req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of webhook, slack"})
+		return
+	}
+	if req.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+		return
+	}
+	target := model.AlertTarget{
+		Name:    req.Name,
+		Type:    req.Type,
+		URL:     model.SecretString(req.URL),
+		Enabled: req.Enabled,
+	}
+	if err := model.DB.Create(&target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, alertTargetResponse(target))
+}
+
+func UpdateAlertTarget(c *gin.Context) {
+	var target model.AlertTarget
+	if err := model.DB.First(&target, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert target not found"})
+		return
+	}
+	var req AlertTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !alert.IsValidTargetType(req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of webhook, slack"})
+		return
+	}
+	target.Name = req.Name
+	target.Type = req.Type
+	target.Enabled = req.Enabled
+	// An empty URL keeps the current one, it is never returned to the client
+	if req.URL != "" {
+		target.URL = model.SecretString(req.URL)
+	}
+	if err := model.DB.Save(&target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, alertTargetResponse(target))
+}
+
+func DeleteAlertTarget(c *gin.Context) {
+	var target model.AlertTarget
+	if err := model.DB.First(&target, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert target not found"})
+		return
+	}
+	if err := model.DB.Exec("DELETE FROM alert_rule_targets WHERE alert_target_id = ?", target.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := model.DB.Delete(&target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "alert target deleted"})
+}
+
+func TestAlertTarget(c *gin.Context) {
+	var target model.AlertTarget
+	if err := model.DB.First(&target, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert target not found"})
+		return
+	}
+	if err := alert.SendTestNotification(c.Request.Context(), &target); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "test notification sent"})
+}
+
+func ListAlertSilences(c *gin.Context) {
+	query := model.DB.Order("ends_at DESC")
+	if c.Query("active") == "true" {
+		now := time.Now()
+		query = query.Where("starts_at <= ? AND ends_at > ?", now, now)
+	}
+	silences := []model.AlertSilence{}
+	if err := query.Find(&silences).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, silences)
+}
+
+func CreateAlertSilence(c *gin.Context) {
+	var req AlertSilenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.StartsAt.IsZero() {
+		req.StartsAt = time.Now()
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "endsAt must be after startsAt"})
+		return
+	}
+	user := c.MustGet("user").(model.User)
+	silence := model.AlertSilence{
+		RuleID:    req.RuleID,
+		Cluster:   req.Cluster,
+		Namespace: req.Namespace,
+		Name:      req.Name,
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.EndsAt,
+		Comment:   req.Comment,
+		CreatedBy: user.Key(),
+	}
+	if err := model.DB.Create(&silence).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, silence)
+}
+
+// ExpireAlertSilence ends a silence now, the record is kept
+func ExpireAlertSilence(c *gin.Context) {
+	var silence model.AlertSilence
+	if err := model.DB.First(&silence, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert silence not found"})
+		return
+	}
+	if err := model.DB.Model(&silence).Update("ends_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "alert silence expired"})
+}
+
+func ListActiveAlerts(c *gin.Context) {
+	alerts := alert.ActiveAlerts()
+	if alerts == nil {
+		alerts = []alert.Alert{}
+	}
+	c.JSON(http.StatusOK, alerts)
+}
+
+func ListAlertNotifications(c *gin.Context) {
+	page := 1
+	size := 20
+	if p := strings.TrimSpace(c.Query("page")); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page parameter"})
+			return
+		}
+	}
+	if s := strings.TrimSpace(c.Query("size")); s != "" {
+		if parsed, err := strconv.Atoi(s); err == nil && parsed > 0 {
+			size = parsed
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid size parameter"})
+			return
+		}
+	}
+
+	query := model.DB.Model(&model.AlertNotification{})
+	if ruleID := strings.TrimSpace(c.Query("ruleId")); ruleID != "" {
+		query = query.Where("rule_id = ?", ruleID)
+	}
+	if clusterName := strings.TrimSpace(c.Query("cluster")); clusterName != "" {
+		query = query.Where("cluster = ?", clusterName)
+	}
+	if status := strings.TrimSpace(c.Query("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	notifications := []model.AlertNotification{}
+	if err := query.Order("created_at DESC").Offset((page - 1) * size).Limit(size).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":  notifications,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	})
+}
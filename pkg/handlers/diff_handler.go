@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zxh326/kite/pkg/cluster"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/kube"
+	"github.com/zxh326/kite/pkg/model"
+	"github.com/zxh326/kite/pkg/rbac"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/yaml"
+)
+
+type DiffHandler struct {
+	cm *cluster.ClusterManager
+}
+
+func NewDiffHandler(cm *cluster.ClusterManager) *DiffHandler {
+	return &DiffHandler{cm: cm}
+}
+
+// refError is an error of a resource reference with the status to respond with
+type refError struct {
+	status int
+	err    error
+}
+
+func (e *refError) Error() string {
+	return e.err.Error()
+}
+
+// Diff compares two resources, which can be in different clusters and
+// namespaces or be ResourceHistory snapshots. Fields that differ between
+// copies of the same resource, such as status, uid and timestamps, are
+// removed before the comparison.
+func (h *DiffHandler) Diff(c *gin.Context) {
+	var req common.ResourceDiffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(model.User)
+
+	left, leftName, err := h.load(c.Request.Context(), user, &req.Left)
+	if err != nil {
+		respondRefError(c, err)
+		return
+	}
+	right, rightName, err := h.load(c.Request.Context(), user, &req.Right)
+	if err != nil {
+		respondRefError(c, err)
+		return
+	}
+	h.respond(c, left, right, leftName, rightName)
+}
+
+func respondRefError(c *gin.Context, err error) {
+	if errors.Is(err, cluster.ErrClusterWarmingUp) {
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "warmingUp": true})
+		return
+	}
+	status := http.StatusInternalServerError
+	var refErr *refError
+	if errors.As(err, &refErr) {
+		status = refErr.status
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+func (h *DiffHandler) respond(c *gin.Context, left, right map[string]interface{}, leftName, rightName string) {
+	// Snapshots of typed objects have no type meta, they are of the type of the other side
+	for _, field := range []string{"apiVersion", "kind"} {
+		if left[field] == nil {
+			left[field] = right[field]
+		}
+		if right[field] == nil {
+			right[field] = left[field]
+		}
+	}
+	kube.NormalizeForDiff(left)
+	kube.NormalizeForDiff(right)
+	changes, unified, err := kube.DiffObjects(left, right, leftName, rightName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, common.ResourceDiffResponse{
+		Identical: len(changes) == 0,
+		Changes:   changes,
+		Unified:   unified,
+		Left:      left,
+		Right:     right,
+	})
+}
+
+// load returns the object of a reference and a name for the unified diff
+func (h *DiffHandler) load(ctx context.Context, user model.User, ref *common.ResourceRef) (map[string]interface{}, string, error) {
+	if ref.HistoryID != 0 {
+		return loadHistory(user, ref)
+	}
+	if ref.Cluster == "" || ref.Kind == "" || ref.Name == "" {
+		return nil, "", &refError{http.StatusBadRequest, fmt.Errorf("cluster, kind and name are required without a historyId")}
+	}
+	if !rbac.CanAccessCluster(user, ref.Cluster) {
+		return nil, "", &refError{http.StatusNotFound, fmt.Errorf("cluster not found: %s", ref.Cluster)}
+	}
+	cs, release, err := h.cm.AcquireClientSet(ref.Cluster)
+	if err != nil {
+		if errors.Is(err, cluster.ErrClusterWarmingUp) {
+			return nil, "", err
+		}
+		return nil, "", &refError{http.StatusNotFound, err}
+	}
+	defer release()
+
+	mapping, err := resolveResource(cs.K8sClient.Client, ref.Kind)
+	if err != nil {
+		return nil, "", &refError{http.StatusBadRequest, err}
+	}
+	resource := rbacResource(cs.K8sClient.Client, mapping)
+	ns := ref.Namespace
+	if ns == "" {
+		ns = "_all"
+	}
+	if !rbac.CanAccess(user, resource, string(common.VerbGet), ref.Cluster, ns) {
+		return nil, "", &refError{http.StatusForbidden, errors.New(rbac.NoAccess(user.Key(), string(common.VerbGet), resource, ns, ref.Cluster))}
+	}
+	obj, err := getObject(ctx, cs.K8sClient.Client, mapping, ref.Namespace, ref.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, "", &refError{http.StatusNotFound, err}
+		}
+		return nil, "", err
+	}
+	return obj, fmt.Sprintf("%s/%s/%s/%s", ref.Cluster, ref.Namespace, resource, ref.Name), nil
+}
+
+// loadHistory returns the object recorded by a ResourceHistory entry
+func loadHistory(user model.User, ref *common.ResourceRef) (map[string]interface{}, string, error) {
+	var history model.ResourceHistory
+	if err := model.DB.First(&history, ref.HistoryID).Error; err != nil {
+		return nil, "", &refError{http.StatusNotFound, fmt.Errorf("history %d not found", ref.HistoryID)}
+	}
+	ns := history.Namespace
+	if ns == "" {
+		ns = "_all"
+	}
+	if !rbac.CanAccess(user, history.ResourceType, string(common.VerbGet), history.ClusterName, ns) {
+		return nil, "", &refError{http.StatusForbidden, errors.New(rbac.NoAccess(user.Key(), string(common.VerbGet), history.ResourceType, ns, history.ClusterName))}
+	}
+	content, version := history.ResourceYAML, "after"
+	if ref.Previous {
+		content, version = history.PreviousYAML, "before"
+	}
+	if content == "" {
+		return nil, "", &refError{http.StatusBadRequest, fmt.Errorf("history %d has no object %s the %s", ref.HistoryID, version, history.OperationType)}
+	}
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal([]byte(content), &obj); err != nil {
+		return nil, "", fmt.Errorf("failed to parse history %d: %w", ref.HistoryID, err)
+	}
+	if obj == nil {
+		obj = map[string]interface{}{}
+	}
+	// Secrets are redacted by kind, the generic handler records them without one
+	if history.ResourceType == "secrets" && obj["kind"] == nil {
+		obj["apiVersion"], obj["kind"] = "v1", "Secret"
+	}
+	name := fmt.Sprintf("%s/%s/%s/%s@history-%d-%s", history.ClusterName, history.Namespace, history.ResourceType, history.ResourceName, history.ID, version)
+	return obj, name, nil
+}
@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"archive/zip"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zxh326/kite/pkg/cluster"
@@ -11,10 +17,13 @@ import (
 	"github.com/zxh326/kite/pkg/model"
 	"github.com/zxh326/kite/pkg/rbac"
 	"golang.org/x/net/websocket"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -50,45 +59,51 @@ func (h *LogsHandler) HandleLogsWebSocket(c *gin.Context) {
 			return
 		}
 
-		container := c.Query("container")
-		tailLines := c.DefaultQuery("tailLines", "100")
-		timestamps := c.DefaultQuery("timestamps", "true")
-		previous := c.DefaultQuery("previous", "false")
-		sinceSeconds := c.Query("sinceSeconds")
-
-		tail, err := strconv.ParseInt(tailLines, 10, 64)
+		logOptions, filter, resume, err := parseLogStreamOptions(c)
 		if err != nil {
-			_ = sendErrorMessage(ws, "invalid tailLines parameter")
+			_ = sendErrorMessage(ws, err.Error())
 			return
 		}
-		timestampsBool := timestamps == "true"
-		previousBool := previous == "true"
-		tailPtr := &tail
-		if *tailPtr == -1 {
-			tailPtr = nil
-		}
 
-		// Build log options
-		logOptions := &corev1.PodLogOptions{
-			Container:  container,
-			Follow:     true,
-			Timestamps: timestampsBool,
-			TailLines:  tailPtr,
-			Previous:   previousBool,
+		labelSelector := c.Query("labelSelector")
+		bl := kube.NewBatchLogHandler(ws, cs.K8sClient, logOptions)
+		defer bl.Stop()
+		overflow := c.DefaultQuery("overflow", common.LogStreamOverflow)
+		if !kube.IsValidLogOverflowPolicy(overflow) {
+			_ = sendErrorMessage(ws, "invalid overflow parameter, must be one of block, drop, disconnect")
+			return
 		}
+		bl.SetLimits(common.LogStreamMaxStreams, common.LogStreamBufferSize, kube.LogOverflowPolicy(overflow))
+		bl.SetFilter(filter)
+		bl.SetParseJSON(c.Query("parseJSON") == "true")
+		bl.SetResume(resume, c.Query("backfillPrevious") == "true")
 
-		if sinceSeconds != "" {
-			since, err := strconv.ParseInt(sinceSeconds, 10, 64)
+		history, err := useLogHistory(ctx, c, cs, namespace, podName)
+		if err != nil {
+			_ = sendErrorMessage(ws, err.Error())
+			return
+		}
+		if history {
+			pods, podPattern, err := historyPods(ctx, c, cs, namespace, podName)
+			if err != nil {
+				_ = sendErrorMessage(ws, err.Error())
+				return
+			}
+			q, err := parseHistoryQuery(c, namespace, pods, podPattern, logOptions.Container)
 			if err != nil {
-				_ = sendErrorMessage(ws, "invalid sinceSeconds parameter")
+				_ = sendErrorMessage(ws, err.Error())
 				return
 			}
-			logOptions.SinceSeconds = &since
+			lines, err := queryHistoricalLogs(ctx, cs, q)
+			if err != nil {
+				_ = sendErrorMessage(ws, "failed to query historical logs: "+err.Error())
+				return
+			}
+			go bl.ReplayLogs(lines)
+			bl.StreamLogs(ctx)
+			return
 		}
 
-		labelSelector := c.Query("labelSelector")
-		bl := kube.NewBatchLogHandler(ws, cs.K8sClient, logOptions)
-
 		if podName == "_all" && labelSelector != "" {
 			selector, err := metav1.ParseToLabelSelector(labelSelector)
 			if err != nil {
@@ -100,22 +115,9 @@ func (h *LogsHandler) HandleLogsWebSocket(c *gin.Context) {
 				_ = sendErrorMessage(ws, "failed to convert labelSelector: "+err.Error())
 				return
 			}
-
-			podList := &corev1.PodList{}
-			var listOpts []client.ListOption
-			listOpts = append(listOpts, client.InNamespace(namespace))
-			listOpts = append(listOpts, client.MatchingLabelsSelector{Selector: labelSelectorOption})
-			if err := cs.K8sClient.List(ctx, podList, listOpts...); err != nil {
-				_ = sendErrorMessage(ws, "failed to list pods: "+err.Error())
+			if !h.addSelectedPods(ctx, ws, cs, namespace, labelSelectorOption, podLogPhases{}, bl) {
 				return
 			}
-			for _, pod := range podList.Items {
-				if pod.Status.Phase == corev1.PodRunning {
-					bl.AddPod(pod)
-				}
-			}
-
-			go h.watchPods(ctx, cs, namespace, labelSelectorOption, bl)
 		} else {
 			bl.AddPod(corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{
@@ -129,7 +131,477 @@ func (h *LogsHandler) HandleLogsWebSocket(c *gin.Context) {
 	}).ServeHTTP(c.Writer, c.Request)
 }
 
-func (h *LogsHandler) watchPods(ctx context.Context, cs *cluster.ClientSet, namespace string, labelSelector labels.Selector, bl *kube.BatchLogHandler) {
+// HandleWorkloadLogsWebSocket streams the logs of every pod owned by a workload.
+// Pods are followed while the workload rolls, each container is a separate stream
+// prefixed with [pod/container]. Query parameters are the same as
+// HandleLogsWebSocket, plus container (repeatable) and initContainers, which
+// also streams pending pods. The logs of finished Job pods are streamed too.
+func (h *LogsHandler) HandleWorkloadLogsWebSocket(c *gin.Context) {
+	websocket.Handler(func(ws *websocket.Conn) {
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		cs := c.MustGet("cluster").(*cluster.ClientSet)
+		user := c.MustGet("user").(model.User)
+		namespace := c.Param("namespace")
+		kind := c.Param("kind")
+		name := c.Param("name")
+
+		if !rbac.CanAccess(user, kind, string(common.VerbGet), cs.Name, namespace) {
+			_ = sendErrorMessage(ws, rbac.NoAccess(user.Key(), string(common.VerbGet), kind, namespace, cs.Name))
+			return
+		}
+		if !rbac.CanAccess(user, "pods", string(common.VerbLog), cs.Name, namespace) {
+			_ = sendErrorMessage(ws, rbac.NoAccess(user.Key(), string(common.VerbLog), "pods", namespace, cs.Name))
+			return
+		}
+
+		obj, err := newWorkloadObject(kind)
+		if err != nil {
+			_ = sendErrorMessage(ws, err.Error())
+			return
+		}
+		if err := cs.K8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, obj); err != nil {
+			_ = sendErrorMessage(ws, fmt.Sprintf("failed to get %s %s: %v", kind, name, err))
+			return
+		}
+		selector, err := workloadPodSelector(obj)
+		if err != nil {
+			_ = sendErrorMessage(ws, err.Error())
+			return
+		}
+
+		logOptions, filter, resume, err := parseLogStreamOptions(c)
+		if err != nil {
+			_ = sendErrorMessage(ws, err.Error())
+			return
+		}
+		logOptions.Container = ""
+
+		bl := kube.NewBatchLogHandler(ws, cs.K8sClient, logOptions)
+		defer bl.Stop()
+		overflow := c.DefaultQuery("overflow", common.LogStreamOverflow)
+		if !kube.IsValidLogOverflowPolicy(overflow) {
+			_ = sendErrorMessage(ws, "invalid overflow parameter, must be one of block, drop, disconnect")
+			return
+		}
+		bl.SetLimits(common.LogStreamMaxStreams, common.LogStreamBufferSize, kube.LogOverflowPolicy(overflow))
+		bl.SetFilter(filter)
+		bl.SetParseJSON(c.Query("parseJSON") == "true")
+		bl.SetResume(resume, c.Query("backfillPrevious") == "true")
+		includeInit := c.Query("initContainers") == "true"
+		bl.SetContainerSelector(&kube.LogContainerSelector{
+			Containers:            c.QueryArray("container"),
+			IncludeInitContainers: includeInit,
+		})
+		phases := podLogPhases{pending: includeInit, finished: kind == "jobs"}
+		if !h.addSelectedPods(ctx, ws, cs, namespace, selector, phases, bl) {
+			return
+		}
+
+		bl.StreamLogs(ctx)
+	}).ServeHTTP(c.Writer, c.Request)
+}
+
+// parseLogStreamOptions reads the follow log options and filter from the query.
+// resume is the data of the last resume message a reconnecting client received,
+// the timestamp of its last line per pod/container.
+func parseLogStreamOptions(c *gin.Context) (*corev1.PodLogOptions, *kube.LogFilter, map[string]time.Time, error) {
+	container := c.Query("container")
+	tailLines := c.DefaultQuery("tailLines", "100")
+	timestamps := c.DefaultQuery("timestamps", "true")
+	previous := c.DefaultQuery("previous", "false")
+	sinceSeconds := c.Query("sinceSeconds")
+
+	tail, err := strconv.ParseInt(tailLines, 10, 64)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid tailLines parameter")
+	}
+	timestampsBool := timestamps == "true"
+	previousBool := previous == "true"
+	tailPtr := &tail
+	if *tailPtr == -1 {
+		tailPtr = nil
+	}
+
+	// Build log options
+	logOptions := &corev1.PodLogOptions{
+		Container:  container,
+		Follow:     true,
+		Timestamps: timestampsBool,
+		TailLines:  tailPtr,
+		Previous:   previousBool,
+	}
+
+	if sinceSeconds != "" {
+		since, err := strconv.ParseInt(sinceSeconds, 10, 64)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid sinceSeconds parameter")
+		}
+		logOptions.SinceSeconds = &since
+	}
+
+	filter, err := kube.NewLogFilter(kube.LogFilterOptions{
+		Include:       c.Query("include"),
+		Exclude:       c.Query("exclude"),
+		Level:         c.Query("level"),
+		CaseSensitive: c.Query("caseSensitive") == "true",
+		Fields:        c.QueryArray("field"),
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var resume map[string]time.Time
+	if v := c.Query("resume"); v != "" {
+		if err := json.Unmarshal([]byte(v), &resume); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid resume parameter, expected a JSON object of RFC3339 timestamps")
+		}
+	}
+	return logOptions, filter, resume, nil
+}
+
+// podLogPhases selects the pods of a selector whose logs are streamed, running
+// pods are always streamed
+type podLogPhases struct {
+	// pending streams pending pods once their init containers started
+	pending bool
+	// finished streams the logs of succeeded and failed pods, e.g. of Jobs
+	finished bool
+}
+
+func (p podLogPhases) streams(pod *corev1.Pod) bool {
+	switch pod.Status.Phase {
+	case corev1.PodRunning:
+		return true
+	case corev1.PodPending:
+		// Pods without init container statuses have not started on a node yet
+		return p.pending && len(pod.Status.InitContainerStatuses) > 0
+	case corev1.PodSucceeded, corev1.PodFailed:
+		return p.finished
+	}
+	return false
+}
+
+// addSelectedPods adds the pods matching selector and phases and keeps
+// following them, it reports false when the pods could not be listed
+func (h *LogsHandler) addSelectedPods(ctx context.Context, ws *websocket.Conn, cs *cluster.ClientSet, namespace string, selector labels.Selector, phases podLogPhases, bl *kube.BatchLogHandler) bool {
+	podList := &corev1.PodList{}
+	var listOpts []client.ListOption
+	listOpts = append(listOpts, client.InNamespace(namespace))
+	listOpts = append(listOpts, client.MatchingLabelsSelector{Selector: selector})
+	if err := cs.K8sClient.List(ctx, podList, listOpts...); err != nil {
+		_ = sendErrorMessage(ws, "failed to list pods: "+err.Error())
+		return false
+	}
+	for _, pod := range podList.Items {
+		if phases.streams(&pod) {
+			bl.AddPod(pod)
+		}
+	}
+
+	go h.watchPods(ctx, cs, namespace, selector, phases, bl)
+	return true
+}
+
+// newWorkloadObject returns an empty object for a workload kind that owns pods
+func newWorkloadObject(kind string) (client.Object, error) {
+	switch kind {
+	case "deployments":
+		return &appsv1.Deployment{}, nil
+	case "statefulsets":
+		return &appsv1.StatefulSet{}, nil
+	case "daemonsets":
+		return &appsv1.DaemonSet{}, nil
+	case "jobs":
+		return &batchv1.Job{}, nil
+	}
+	return nil, fmt.Errorf("unsupported workload kind: %s", kind)
+}
+
+// workloadPodSelector returns the selector of the pods owned by a workload
+func workloadPodSelector(obj client.Object) (labels.Selector, error) {
+	var selector *metav1.LabelSelector
+	switch w := obj.(type) {
+	case *appsv1.Deployment:
+		selector = w.Spec.Selector
+	case *appsv1.StatefulSet:
+		selector = w.Spec.Selector
+	case *appsv1.DaemonSet:
+		selector = w.Spec.Selector
+	case *batchv1.Job:
+		selector = w.Spec.Selector
+	}
+	if selector == nil {
+		return nil, fmt.Errorf("%s has no pod selector", obj.GetName())
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pod selector: %w", err)
+	}
+	if s.Empty() {
+		return nil, fmt.Errorf("%s has an empty pod selector", obj.GetName())
+	}
+	return s, nil
+}
+
+// logTarget is a single container whose logs are downloaded
+type logTarget struct {
+	pod       string
+	namespace string
+	container string
+}
+
+// DownloadLogs streams logs of a pod, or of all pods matching labelSelector when
+// podName is _all, as a file. Multiple containers are returned as a zip archive
+// with one file per container.
+func (h *LogsHandler) DownloadLogs(c *gin.Context) {
+	cs := c.MustGet("cluster").(*cluster.ClientSet)
+	user := c.MustGet("user").(model.User)
+	namespace := c.Param("namespace")
+	podName := c.Param("podName")
+	if namespace == "" || podName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "namespace and podName are required"})
+		return
+	}
+	if !rbac.CanAccess(user, "pods", string(common.VerbLog), cs.Name, namespace) {
+		c.JSON(http.StatusForbidden, gin.H{"error": rbac.NoAccess(user.Key(), string(common.VerbLog), "pods", namespace, cs.Name)})
+		return
+	}
+
+	logOptions, err := parseLogDownloadOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	history, err := useLogHistory(ctx, c, cs, namespace, podName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if history {
+		h.downloadHistoricalLogs(c, cs, namespace, podName, logOptions)
+		return
+	}
+
+	var pods []corev1.Pod
+	labelSelector := c.Query("labelSelector")
+	if podName == "_all" {
+		if labelSelector == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "labelSelector is required when podName is _all"})
+			return
+		}
+		selector, err := labels.Parse(labelSelector)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid labelSelector parameter: " + err.Error()})
+			return
+		}
+		podList := &corev1.PodList{}
+		if err := cs.K8sClient.List(ctx, podList, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list pods: " + err.Error()})
+			return
+		}
+		pods = podList.Items
+	} else {
+		pod := corev1.Pod{}
+		if err := cs.K8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: podName}, &pod); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "failed to get pod: " + err.Error()})
+			return
+		}
+		pods = []corev1.Pod{pod}
+	}
+
+	targets := logTargets(pods, logOptions.Container, c.Query("allContainers") == "true")
+	if len(targets) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no containers found"})
+		return
+	}
+
+	if len(targets) == 1 {
+		t := targets[0]
+		opts := logOptions.DeepCopy()
+		opts.Container = t.container
+		stream, err := cs.K8sClient.ClientSet.CoreV1().Pods(t.namespace).GetLogs(t.pod, opts).Stream(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get logs for %s/%s: %v", t.pod, t.container, err)})
+			return
+		}
+		defer func() {
+			_ = stream.Close()
+		}()
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%s.log\"", t.pod, t.container))
+		c.DataFromReader(http.StatusOK, -1, "text/plain; charset=utf-8", stream, nil)
+		return
+	}
+
+	archiveName := podName
+	if podName == "_all" {
+		archiveName = namespace + "-logs"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%s.zip\"", archiveName, time.Now().Format("20060102-150405")))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	if err := writeLogArchive(ctx, c.Writer, cs.K8sClient.ClientSet, targets, logOptions); err != nil {
+		klog.Errorf("Failed to write log archive: %v", err)
+	}
+}
+
+// writeLogArchive writes the logs of every target as <pod>/<container>.log to
+// a zip archive. A container whose logs cannot be read gets the error as content.
+func writeLogArchive(ctx context.Context, out io.Writer, clientset kubernetes.Interface, targets []logTarget, logOptions *corev1.PodLogOptions) error {
+	zw := zip.NewWriter(out)
+	for _, t := range targets {
+		w, err := zw.Create(fmt.Sprintf("%s/%s.log", t.pod, t.container))
+		if err != nil {
+			return fmt.Errorf("failed to add %s/%s: %w", t.pod, t.container, err)
+		}
+		opts := logOptions.DeepCopy()
+		opts.Container = t.container
+		if err := copyContainerLogs(ctx, clientset, t, opts, w); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			_, _ = fmt.Fprintf(w, "failed to get logs: %v\n", err)
+		}
+	}
+	return zw.Close()
+}
+
+// downloadHistoricalLogs returns the logs stored in the cluster's log backend as one text file
+func (h *LogsHandler) downloadHistoricalLogs(c *gin.Context, cs *cluster.ClientSet, namespace, podName string, logOptions *corev1.PodLogOptions) {
+	ctx := c.Request.Context()
+	pods, podPattern, err := historyPods(ctx, c, cs, namespace, podName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	q, err := parseHistoryQuery(c, namespace, pods, podPattern, logOptions.Container)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lines, err := queryHistoricalLogs(ctx, cs, q)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to query historical logs: " + err.Error()})
+		return
+	}
+
+	name := podName
+	if podName == "_all" {
+		name = namespace + "-logs"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-history.log\"", name))
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := writeHistoricalLogs(c.Writer, lines, logOptions.Timestamps); err != nil {
+		klog.Errorf("Failed to write historical logs: %v", err)
+	}
+}
+
+func copyContainerLogs(ctx context.Context, clientset kubernetes.Interface, t logTarget, opts *corev1.PodLogOptions, w io.Writer) error {
+	stream, err := clientset.CoreV1().Pods(t.namespace).GetLogs(t.pod, opts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = stream.Close()
+	}()
+	_, err = io.Copy(w, stream)
+	return err
+}
+
+func parseLogDownloadOptions(c *gin.Context) (*corev1.PodLogOptions, error) {
+	opts := &corev1.PodLogOptions{
+		Container:  c.Query("container"),
+		Follow:     false,
+		Timestamps: c.DefaultQuery("timestamps", "false") == "true",
+		Previous:   c.DefaultQuery("previous", "false") == "true",
+	}
+	if v := c.Query("sinceSeconds"); v != "" {
+		since, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || since <= 0 {
+			return nil, fmt.Errorf("invalid sinceSeconds parameter")
+		}
+		opts.SinceSeconds = &since
+	}
+	if v := c.Query("sinceTime"); v != "" {
+		if opts.SinceSeconds != nil {
+			return nil, fmt.Errorf("sinceTime and sinceSeconds are mutually exclusive")
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sinceTime parameter, expected RFC3339")
+		}
+		sinceTime := metav1.NewTime(t)
+		opts.SinceTime = &sinceTime
+	}
+	if v := c.Query("limitBytes"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limitBytes parameter")
+		}
+		opts.LimitBytes = &limit
+	}
+	if v := c.Query("tailLines"); v != "" {
+		tail, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tailLines parameter")
+		}
+		if tail >= 0 {
+			opts.TailLines = &tail
+		}
+	}
+	return opts, nil
+}
+
+// logTargets resolves the containers to download. An explicit container wins,
+// allContainers includes init containers, otherwise the pod's default container is used.
+func logTargets(pods []corev1.Pod, container string, allContainers bool) []logTarget {
+	var targets []logTarget
+	for _, pod := range pods {
+		add := func(name string) {
+			targets = append(targets, logTarget{pod: pod.Name, namespace: pod.Namespace, container: name})
+		}
+		switch {
+		case container != "":
+			if hasContainer(pod, container) {
+				add(container)
+			}
+		case allContainers:
+			for _, ct := range pod.Spec.InitContainers {
+				add(ct.Name)
+			}
+			for _, ct := range pod.Spec.Containers {
+				add(ct.Name)
+			}
+		default:
+			if name := pod.Annotations["kubectl.kubernetes.io/default-container"]; name != "" && hasContainer(pod, name) {
+				add(name)
+			} else if len(pod.Spec.Containers) > 0 {
+				add(pod.Spec.Containers[0].Name)
+			}
+		}
+	}
+	return targets
+}
+
+func hasContainer(pod corev1.Pod, name string) bool {
+	for _, ct := range pod.Spec.InitContainers {
+		if ct.Name == name {
+			return true
+		}
+	}
+	for _, ct := range pod.Spec.Containers {
+		if ct.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *LogsHandler) watchPods(ctx context.Context, cs *cluster.ClientSet, namespace string, labelSelector labels.Selector, phases podLogPhases, bl *kube.BatchLogHandler) {
 	listOptions := metav1.ListOptions{
 		LabelSelector: labelSelector.String(),
 	}
@@ -158,7 +630,7 @@ func (h *LogsHandler) watchPods(ctx context.Context, cs *cluster.ClientSet, name
 
 			switch event.Type {
 			case watch.Added, watch.Modified:
-				if pod.Status.Phase == corev1.PodRunning {
+				if phases.streams(pod) {
 					bl.AddPod(*pod)
 				} else {
 					bl.RemovePod(*pod)
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newQueryContext(query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/logs?"+query, nil)
+	return c
+}
+
+func TestParseLogStreamResume(t *testing.T) {
+	c := newQueryContext(`timestamps=false&resume={"web-0/app":"2024-01-02T15:04:05.5Z","web-1/app":"2024-01-02T15:04:06Z"}`)
+	opts, _, resume, err := parseLogStreamOptions(c)
+	if err != nil {
+		t.Fatalf("parseLogStreamOptions() error = %v", err)
+	}
+	if opts.Timestamps || opts.SinceTime != nil || opts.TailLines == nil {
+		t.Errorf("resume must not change the shared options: %+v", opts)
+	}
+	want := time.Date(2024, 1, 2, 15, 4, 5, 5e8, time.UTC)
+	if len(resume) != 2 || !resume["web-0/app"].Equal(want) {
+		t.Errorf("resume = %v", resume)
+	}
+
+	if _, _, _, err := parseLogStreamOptions(newQueryContext(`resume=2024-01-02T15:04:05Z`)); err == nil {
+		t.Error("expected an error for a resume parameter that is not an object")
+	}
+}
+
+func TestParseLogDownloadOptions(t *testing.T) {
+	since := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		query   string
+		check   func(*corev1.PodLogOptions) bool
+		wantErr bool
+	}{
+		{name: "defaults", query: "", check: func(o *corev1.PodLogOptions) bool {
+			return !o.Follow && !o.Timestamps && !o.Previous && o.TailLines == nil && o.SinceSeconds == nil && o.SinceTime == nil
+		}},
+		{name: "previous and timestamps", query: "previous=true&timestamps=true&container=app", check: func(o *corev1.PodLogOptions) bool {
+			return o.Previous && o.Timestamps && o.Container == "app"
+		}},
+		{name: "sinceSeconds", query: "sinceSeconds=300", check: func(o *corev1.PodLogOptions) bool {
+			return o.SinceSeconds != nil && *o.SinceSeconds == 300
+		}},
+		{name: "sinceTime", query: "sinceTime=2024-01-02T15:04:05Z", check: func(o *corev1.PodLogOptions) bool {
+			return o.SinceTime != nil && o.SinceTime.Time.Equal(since)
+		}},
+		{name: "tailLines", query: "tailLines=50&limitBytes=1024", check: func(o *corev1.PodLogOptions) bool {
+			return o.TailLines != nil && *o.TailLines == 50 && o.LimitBytes != nil && *o.LimitBytes == 1024
+		}},
+		{name: "negative tailLines returns everything", query: "tailLines=-1", check: func(o *corev1.PodLogOptions) bool {
+			return o.TailLines == nil
+		}},
+		{name: "sinceTime and sinceSeconds", query: "sinceSeconds=300&sinceTime=2024-01-02T15:04:05Z", wantErr: true},
+		{name: "invalid sinceSeconds", query: "sinceSeconds=0", wantErr: true},
+		{name: "invalid sinceTime", query: "sinceTime=yesterday", wantErr: true},
+		{name: "invalid tailLines", query: "tailLines=all", wantErr: true},
+		{name: "invalid limitBytes", query: "limitBytes=-5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseLogDownloadOptions(newQueryContext(tt.query))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLogDownloadOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !tt.check(opts) {
+				t.Errorf("parseLogDownloadOptions() = %+v", opts)
+			}
+		})
+	}
+}
+
+func TestLogTargets(t *testing.T) {
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "init"}},
+				Containers:     []corev1.Container{{Name: "app"}, {Name: "sidecar"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", Annotations: map[string]string{"kubectl.kubernetes.io/default-container": "sidecar"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "sidecar"}}},
+		},
+	}
+	tests := []struct {
+		name          string
+		container     string
+		allContainers bool
+		want          []string
+	}{
+		{name: "default container", want: []string{"web-0/app", "web-1/sidecar"}},
+		{name: "explicit container", container: "init", want: []string{"web-0/init"}},
+		{name: "explicit container wins over allContainers", container: "app", allContainers: true, want: []string{"web-0/app", "web-1/app"}},
+		{name: "all containers", allContainers: true, want: []string{"web-0/init", "web-0/app", "web-0/sidecar", "web-1/app", "web-1/sidecar"}},
+		{name: "unknown container", container: "db", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, target := range logTargets(pods, tt.container, tt.allContainers) {
+				got = append(got, target.pod+"/"+target.container)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("logTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteLogArchive(t *testing.T) {
+	targets := []logTarget{
+		{pod: "web-0", namespace: "default", container: "app"},
+		{pod: "web-1", namespace: "default", container: "sidecar"},
+	}
+	var out bytes.Buffer
+	if err := writeLogArchive(context.Background(), &out, fake.NewClientset(), targets, &corev1.PodLogOptions{}); err != nil {
+		t.Fatalf("writeLogArchive() error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip archive: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		// The fake clientset returns the same logs for every container
+		if string(content) != "fake logs" {
+			t.Errorf("%s = %q, want the container logs", f.Name, content)
+		}
+	}
+	if want := []string{"web-0/app.log", "web-1/sidecar.log"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("archive files = %v, want %v", names, want)
+	}
+}
+
+func TestPodLogPhases(t *testing.T) {
+	pod := func(phase corev1.PodPhase, initStarted bool) *corev1.Pod {
+		p := &corev1.Pod{Status: corev1.PodStatus{Phase: phase}}
+		if initStarted {
+			p.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+				Name:  "migrate",
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			}}
+		}
+		return p
+	}
+	tests := []struct {
+		name   string
+		phases podLogPhases
+		pod    *corev1.Pod
+		want   bool
+	}{
+		{name: "running", pod: pod(corev1.PodRunning, false), want: true},
+		{name: "pending without init containers", pod: pod(corev1.PodPending, true), want: false},
+		{name: "pending with init containers", phases: podLogPhases{pending: true}, pod: pod(corev1.PodPending, true), want: true},
+		{name: "pending before init containers started", phases: podLogPhases{pending: true}, pod: pod(corev1.PodPending, false), want: false},
+		{name: "succeeded", pod: pod(corev1.PodSucceeded, false), want: false},
+		{name: "succeeded job pod", phases: podLogPhases{finished: true}, pod: pod(corev1.PodSucceeded, false), want: true},
+		{name: "failed job pod", phases: podLogPhases{finished: true}, pod: pod(corev1.PodFailed, false), want: true},
+		{name: "unknown", phases: podLogPhases{pending: true, finished: true}, pod: pod(corev1.PodUnknown, false), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.phases.streams(tt.pod); got != tt.want {
+				t.Errorf("streams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
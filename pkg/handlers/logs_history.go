@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zxh326/kite/pkg/cluster"
+	"github.com/zxh326/kite/pkg/kube"
+	"github.com/zxh326/kite/pkg/loki"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultHistoryRange = time.Hour
+	defaultHistoryLimit = 5000
+	maxHistoryLimit     = 50000
+)
+
+// historyQuery is a time range query against the cluster's log backend
+type historyQuery struct {
+	namespace string
+	pods      []string
+	// podPattern matches the pods by name instead of pods, see historyPods
+	podPattern string
+	container  string
+	start      time.Time
+	end        time.Time
+	limit      int
+}
+
+// useLogHistory reports whether logs are read from the log backend, either
+// because source=history was requested or the pod no longer exists
+func useLogHistory(ctx context.Context, c *gin.Context, cs *cluster.ClientSet, namespace, podName string) (bool, error) {
+	switch c.Query("source") {
+	case "history":
+		if cs.LokiClient == nil {
+			return false, fmt.Errorf("no log backend is configured for cluster %s", cs.Name)
+		}
+		return true, nil
+	case "live":
+		return false, nil
+	}
+	if cs.LokiClient == nil || podName == "_all" {
+		return false, nil
+	}
+	pod := corev1.Pod{}
+	err := cs.K8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: podName}, &pod)
+	return apierrors.IsNotFound(err), nil
+}
+
+// parseHistoryQuery reads start, end (RFC3339) and limit, sinceSeconds is
+// accepted as an alternative to start
+func parseHistoryQuery(c *gin.Context, namespace string, pods []string, podPattern, container string) (*historyQuery, error) {
+	q := &historyQuery{
+		namespace:  namespace,
+		pods:       pods,
+		podPattern: podPattern,
+		container:  container,
+		end:        time.Now(),
+		limit:      defaultHistoryLimit,
+	}
+	if v := c.Query("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end parameter, expected RFC3339")
+		}
+		q.end = t
+	}
+	q.start = q.end.Add(-defaultHistoryRange)
+	if v := c.Query("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start parameter, expected RFC3339")
+		}
+		q.start = t
+	} else if v := c.Query("sinceSeconds"); v != "" {
+		since, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || since <= 0 {
+			return nil, fmt.Errorf("invalid sinceSeconds parameter")
+		}
+		q.start = q.end.Add(-time.Duration(since) * time.Second)
+	}
+	if !q.start.Before(q.end) {
+		return nil, fmt.Errorf("start must be before end")
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limit parameter")
+		}
+		q.limit = min(limit, maxHistoryLimit)
+	}
+	return q, nil
+}
+
+// historyPods returns the pods to query. With _all the pods of a workload are
+// matched by name, as Loki does not index Kubernetes pod labels and the pods
+// whose logs are wanted may be gone: the workload is either given as
+// workload=<kind>/<name>, or found from the owners of the pods currently
+// matching labelSelector. Pods without a workload owner are matched exactly.
+func historyPods(ctx context.Context, c *gin.Context, cs *cluster.ClientSet, namespace, podName string) ([]string, string, error) {
+	if podName != "_all" {
+		return []string{podName}, "", nil
+	}
+	if v := c.Query("workload"); v != "" {
+		kind, name, _ := strings.Cut(v, "/")
+		pattern, err := workloadPodPattern(kind, name)
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, pattern, nil
+	}
+	labelSelector := c.Query("labelSelector")
+	if labelSelector == "" {
+		return nil, "", nil
+	}
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid labelSelector parameter: %w", err)
+	}
+	podList := &corev1.PodList{}
+	if err := cs.K8sClient.List(ctx, podList, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, "", fmt.Errorf("failed to list pods: %w", err)
+	}
+	if len(podList.Items) == 0 {
+		return nil, "", errors.New("no pods match labelSelector, set the workload parameter to read the logs of deleted pods")
+	}
+	var patterns []string
+	for _, pod := range podList.Items {
+		pattern := regexp.QuoteMeta(pod.Name)
+		if kind, name := podWorkload(ctx, cs, &pod); kind != "" {
+			pattern, _ = workloadPodPattern(kind, name)
+		}
+		if !slices.Contains(patterns, pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return nil, strings.Join(patterns, "|"), nil
+}
+
+// workloadPodPattern returns the regular expression matching the names of the
+// pods a workload creates, including those of previous revisions
+func workloadPodPattern(kind, name string) (string, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid workload parameter, expected <kind>/<name>")
+	}
+	var suffix string
+	switch kind {
+	case "deployments":
+		// <deployment>-<pod-template-hash>-<random>
+		suffix = `-[a-z0-9]{1,10}-[a-z0-9]{5}`
+	case "statefulsets":
+		suffix = `-[0-9]+`
+	case "daemonsets", "jobs":
+		suffix = `-[a-z0-9]{5}`
+	case "cronjobs":
+		// <cronjob>-<scheduled time>-<random>
+		suffix = `-[0-9]+-[a-z0-9]{5}`
+	default:
+		return "", fmt.Errorf("unsupported workload kind: %s", kind)
+	}
+	return regexp.QuoteMeta(name) + suffix, nil
+}
+
+// podWorkload returns the kind and name of the workload owning a pod, an empty
+// kind when it has none
+func podWorkload(ctx context.Context, cs *cluster.ClientSet, pod *corev1.Pod) (string, string) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "", ""
+	}
+	switch owner.Kind {
+	case "ReplicaSet":
+		rs := &appsv1.ReplicaSet{}
+		if err := cs.K8sClient.Get(ctx, client.ObjectKey{Namespace: pod.Namespace, Name: owner.Name}, rs); err != nil {
+			return "", ""
+		}
+		if ref := metav1.GetControllerOf(rs); ref != nil && ref.Kind == "Deployment" {
+			return "deployments", ref.Name
+		}
+	case "StatefulSet":
+		return "statefulsets", owner.Name
+	case "DaemonSet":
+		return "daemonsets", owner.Name
+	case "Job":
+		return "jobs", owner.Name
+	}
+	return "", ""
+}
+
+func queryHistoricalLogs(ctx context.Context, cs *cluster.ClientSet, q *historyQuery) ([]kube.HistoricalLogLine, error) {
+	query := loki.PodLogQuery(q.namespace, q.pods, q.container)
+	if q.podPattern != "" {
+		query = loki.PodPatternLogQuery(q.namespace, q.podPattern, q.container)
+	}
+	entries, err := cs.LokiClient.QueryRange(ctx, query, q.start, q.end, q.limit)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]kube.HistoricalLogLine, 0, len(entries))
+	for _, e := range entries {
+		lines = append(lines, kube.HistoricalLogLine{
+			Pod:       e.Labels[loki.PodLabel],
+			Container: e.Labels[loki.ContainerLabel],
+			Timestamp: e.Timestamp,
+			Line:      e.Line,
+		})
+	}
+	return lines, nil
+}
+
+// writeHistoricalLogs writes lines as plain text, prefixed with the timestamp
+// when timestamps is set and with [pod/container] when several are included
+func writeHistoricalLogs(w io.Writer, lines []kube.HistoricalLogLine, timestamps bool) error {
+	sources := map[string]struct{}{}
+	for _, line := range lines {
+		sources[line.Pod+"/"+line.Container] = struct{}{}
+	}
+	for _, line := range lines {
+		text := line.Line
+		if len(sources) > 1 {
+			text = fmt.Sprintf("[%s/%s]: %s", line.Pod, line.Container, text)
+		}
+		if timestamps {
+			text = line.Timestamp.UTC().Format(time.RFC3339Nano) + " " + text
+		}
+		if _, err := io.WriteString(w, text+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/zxh326/kite/pkg/cluster"
+	"github.com/zxh326/kite/pkg/kube"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHistoryPods(t *testing.T) {
+	controller := func(kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: ptr.To(true)}}
+	}
+	objects := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "web-7d4b9c-abcde", Namespace: "default", Labels: map[string]string{"app": "web"}, OwnerReferences: controller("ReplicaSet", "web-7d4b9c")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "default", Labels: map[string]string{"app": "db"}, OwnerReferences: controller("StatefulSet", "db")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "default", Labels: map[string]string{"app": "db"}}},
+	}
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "web-7d4b9c", Namespace: "default", OwnerReferences: controller("Deployment", "web")}}
+	builder := fake.NewClientBuilder().WithScheme(kube.GetScheme()).WithObjects(rs)
+	for i := range objects {
+		builder = builder.WithObjects(&objects[i])
+	}
+	cs := &cluster.ClientSet{Name: "c1", K8sClient: &kube.K8sClient{Client: builder.Build()}}
+	ctx := context.Background()
+
+	tests := []struct {
+		name, podName, query string
+		wantPods             []string
+		wantPattern          string
+		wantErr              bool
+	}{
+		{name: "single pod", podName: "web-0", wantPods: []string{"web-0"}},
+		{name: "workload", podName: "_all", query: "workload=deployments/web", wantPattern: `web-[a-z0-9]{1,10}-[a-z0-9]{5}`},
+		{name: "unsupported workload", podName: "_all", query: "workload=services/web", wantErr: true},
+		{name: "deployment from labelSelector", podName: "_all", query: "labelSelector=app=web", wantPattern: `web-[a-z0-9]{1,10}-[a-z0-9]{5}`},
+		{name: "pods without a workload are matched exactly", podName: "_all", query: "labelSelector=app=db", wantPattern: `db-[0-9]+|debug`},
+		{name: "no matching pods", podName: "_all", query: "labelSelector=app=gone", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pods, pattern, err := historyPods(ctx, newQueryContext(tt.query), cs, "default", tt.podName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("historyPods() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(pods) != len(tt.wantPods) || (len(pods) > 0 && pods[0] != tt.wantPods[0]) || pattern != tt.wantPattern {
+				t.Errorf("historyPods() = %v, %q, want %v, %q", pods, pattern, tt.wantPods, tt.wantPattern)
+			}
+		})
+	}
+
+	// Pods of previous revisions match, pods of other deployments do not
+	_, pattern, _ := historyPods(ctx, newQueryContext("workload=deployments/web"), cs, "default", "_all")
+	re := regexp.MustCompile("^(?:" + pattern + ")$")
+	for name, want := range map[string]bool{"web-5f6b7d8c9-xyz12": true, "web-api-5f6b7d8c9-xyz12": false, "web-0": false} {
+		if re.MatchString(name) != want {
+			t.Errorf("pattern %s matching %s = %v, want %v", pattern, name, !want, want)
+		}
+	}
+}
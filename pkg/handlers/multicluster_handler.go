@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zxh326/kite/pkg/cluster"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/model"
+	"github.com/zxh326/kite/pkg/rbac"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultMultiClusterTimeout = 10 * time.Second
+	maxMultiClusterTimeout     = time.Minute
+	// multiClusterConcurrency limits the clusters listed at the same time
+	multiClusterConcurrency = 10
+)
+
+type MultiClusterHandler struct {
+	cm *cluster.ClusterManager
+}
+
+func NewMultiClusterHandler(cm *cluster.ClusterManager) *MultiClusterHandler {
+	return &MultiClusterHandler{cm: cm}
+}
+
+// multiClusterQuery is the filter applied in every cluster
+type multiClusterQuery struct {
+	resource  string
+	namespace string
+	selector  labels.Selector
+	name      string
+	limit     int64
+}
+
+// List lists a resource in every connected cluster the user can access, or
+// in the clusters given by the clusters query parameter. Clusters are listed
+// concurrently, a cluster that fails or times out is reported in failures
+// while the items of the other clusters are returned. limit applies to the
+// objects matching name, so with name the resource is listed in full and
+// filtered before the limit is applied.
+func (h *MultiClusterHandler) List(c *gin.Context) {
+	user := c.MustGet("user").(model.User)
+	query := multiClusterQuery{
+		resource:  c.Param("resource"),
+		namespace: c.Query("namespace"),
+		name:      strings.ToLower(c.Query("name")),
+	}
+	var err error
+	if query.selector, err = labels.Parse(c.Query("labelSelector")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid labelSelector parameter: " + err.Error()})
+		return
+	}
+	if v := c.Query("limit"); v != "" {
+		if query.limit, err = strconv.ParseInt(v, 10, 64); err != nil || query.limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit parameter"})
+			return
+		}
+	}
+	timeout := defaultMultiClusterTimeout
+	if v := c.Query("timeout"); v != "" {
+		if timeout, err = time.ParseDuration(v); err != nil || timeout <= 0 || timeout > maxMultiClusterTimeout {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("timeout must be a duration up to %s", maxMultiClusterTimeout)})
+			return
+		}
+	}
+
+	response := common.MultiClusterListResponse{
+		Items:    []common.MultiClusterItem{},
+		Clusters: []string{},
+		Failures: []common.MultiClusterFailure{},
+	}
+	var candidates []string
+	if v := c.Query("clusters"); v != "" {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if !rbac.CanAccessCluster(user, name) {
+				response.Failures = append(response.Failures, common.MultiClusterFailure{Cluster: name, Error: "cluster not found: " + name})
+				continue
+			}
+			candidates = append(candidates, name)
+		}
+	} else {
+		for _, name := range h.cm.ClusterNames() {
+			if !rbac.CanAccessCluster(user, name) {
+				continue
+			}
+			// Listing every cluster must not connect all idle ones
+			if !h.cm.IsConnected(name) {
+				response.Failures = append(response.Failures, common.MultiClusterFailure{
+					Cluster: name,
+					Error:   "cluster is idle, name it in the clusters parameter to connect it",
+					Idle:    true,
+				})
+				continue
+			}
+			candidates = append(candidates, name)
+		}
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, multiClusterConcurrency)
+	for _, name := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			items, failure := h.listCluster(c.Request.Context(), user, name, &query, timeout)
+			mu.Lock()
+			defer mu.Unlock()
+			if failure != nil {
+				response.Failures = append(response.Failures, *failure)
+				return
+			}
+			response.Clusters = append(response.Clusters, name)
+			response.Items = append(response.Items, items...)
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(response.Clusters)
+	sort.Slice(response.Failures, func(i, j int) bool {
+		return response.Failures[i].Cluster < response.Failures[j].Cluster
+	})
+	sort.SliceStable(response.Items, func(i, j int) bool {
+		a, b := response.Items[i], response.Items[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		return itemKey(a.Object) < itemKey(b.Object)
+	})
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *MultiClusterHandler) listCluster(ctx context.Context, user model.User, name string, query *multiClusterQuery, timeout time.Duration) ([]common.MultiClusterItem, *common.MultiClusterFailure) {
+	cs, release, err := h.cm.AcquireClientSet(name)
+	if err != nil {
+		return nil, &common.MultiClusterFailure{Cluster: name, Error: err.Error(), WarmingUp: errors.Is(err, cluster.ErrClusterWarmingUp)}
+	}
+	defer release()
+	mapping, err := resolveResource(cs.K8sClient.Client, query.resource)
+	if err != nil {
+		return nil, &common.MultiClusterFailure{Cluster: name, Error: err.Error()}
+	}
+	// The resource is given by any name the cluster resolves, e.g. secret or
+	// Secret, so access is checked with the name RBAC rules use
+	if err := checkListAccess(user, name, cs.K8sClient.Client, mapping, query.namespace); err != nil {
+		return nil, &common.MultiClusterFailure{Cluster: name, Error: err.Error()}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	objects, err := listResource(ctx, cs.K8sClient.Client, mapping, query)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		return nil, &common.MultiClusterFailure{Cluster: name, Error: err.Error()}
+	}
+	items := make([]common.MultiClusterItem, 0, len(objects))
+	for _, obj := range objects {
+		items = append(items, common.MultiClusterItem{Cluster: name, Object: obj})
+	}
+	return items, nil
+}
+
+// checkListAccess checks the user can list the mapped resource in a cluster
+func checkListAccess(user model.User, clusterName string, c client.Client, mapping *meta.RESTMapping, namespace string) error {
+	resource := rbacResource(c, mapping)
+	ns := namespace
+	if ns == "" || mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		ns = "_all"
+	}
+	if !rbac.CanAccess(user, resource, string(common.VerbGet), clusterName, ns) {
+		return errors.New(rbac.NoAccess(user.Key(), string(common.VerbGet), resource, ns, clusterName))
+	}
+	return nil
+}
+
+// listResource lists the objects of a resource matching query. Built-in types
+// are listed with their typed list so they are served from the informer
+// cache, other resources such as custom resources are listed unstructured.
+func listResource(ctx context.Context, c client.Client, mapping *meta.RESTMapping, query *multiClusterQuery) ([]map[string]interface{}, error) {
+	gvk := mapping.GroupVersionKind
+	listGVK := gvk.GroupVersion().WithKind(gvk.Kind + "List")
+	var list client.ObjectList
+	if obj, err := c.Scheme().New(listGVK); err == nil {
+		list = obj.(client.ObjectList)
+	} else {
+		u := &unstructured.UnstructuredList{}
+		u.SetGroupVersionKind(listGVK)
+		list = u
+	}
+	var opts []client.ListOption
+	if query.namespace != "" && mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		opts = append(opts, client.InNamespace(query.namespace))
+	}
+	if !query.selector.Empty() {
+		opts = append(opts, client.MatchingLabelsSelector{Selector: query.selector})
+	}
+	// The name filter runs after listing, a server side limit would only
+	// search the first objects
+	if query.limit > 0 && query.name == "" {
+		opts = append(opts, client.Limit(query.limit))
+	}
+	if err := c.List(ctx, list, opts...); err != nil {
+		return nil, err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if query.limit > 0 && int64(len(objects)) >= query.limit {
+			break
+		}
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return nil, err
+		}
+		if query.name != "" && !strings.Contains(strings.ToLower(accessor.GetName()), query.name) {
+			continue
+		}
+		obj, err := toUnstructured(item, gvk)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// itemKey orders the items of a cluster by namespace and name
+func itemKey(obj map[string]interface{}) string {
+	u := unstructured.Unstructured{Object: obj}
+	return u.GetNamespace() + "/" + u.GetName()
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestListResource(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+	pod := func(ns, name, app string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name, Labels: map[string]string{"app": app}}}
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRESTMapper(testrestmapper.TestOnlyStaticRESTMapper(scheme)).
+		WithObjects(
+			pod("shop", "checkout-1", "checkout"),
+			pod("shop", "cart-1", "cart"),
+			pod("staging", "checkout-2", "checkout"),
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+			&apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.com"}},
+		).Build()
+	ctx := context.Background()
+	list := func(query *multiClusterQuery) ([]map[string]interface{}, error) {
+		mapping, err := resolveResource(c, query.resource)
+		if err != nil {
+			return nil, err
+		}
+		return listResource(ctx, c, mapping, query)
+	}
+	names := func(objects []map[string]interface{}) []string {
+		var result []string
+		for _, obj := range objects {
+			result = append(result, itemKey(obj))
+		}
+		return result
+	}
+
+	objects, err := list(&multiClusterQuery{resource: "pods", selector: labels.Everything()})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"shop/checkout-1", "shop/cart-1", "staging/checkout-2"}, names(objects))
+	assert.Equal(t, "v1", objects[0]["apiVersion"])
+	assert.Equal(t, "Pod", objects[0]["kind"])
+
+	objects, err = list(&multiClusterQuery{resource: "pods", namespace: "shop", selector: labels.SelectorFromSet(labels.Set{"app": "checkout"})})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shop/checkout-1"}, names(objects))
+
+	objects, err = list(&multiClusterQuery{resource: "pods", name: "checkout", selector: labels.Everything()})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"shop/checkout-1", "staging/checkout-2"}, names(objects))
+
+	// The namespace does not apply to cluster scoped resources
+	objects, err = list(&multiClusterQuery{resource: "nodes", namespace: "shop", selector: labels.Everything()})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/node-1"}, names(objects))
+
+	objects, err = list(&multiClusterQuery{resource: "crds", selector: labels.Everything()})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/widgets.example.com"}, names(objects))
+
+	_, err = list(&multiClusterQuery{resource: "widgets.example.com", selector: labels.Everything()})
+	assert.ErrorContains(t, err, "resource widgets.example.com is not served by the cluster")
+}
+
+func TestListResourceLimit(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	var objects []client.Object
+	for _, name := range []string{"a-1", "a-2", "a-3", "checkout-1", "checkout-2", "checkout-3"} {
+		objects = append(objects, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name}})
+	}
+	// The fake client ignores limits, apply them like the API server does
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRESTMapper(testrestmapper.TestOnlyStaticRESTMapper(scheme)).
+		WithObjects(objects...).
+		WithInterceptorFuncs(interceptor.Funcs{List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if err := c.List(ctx, list, opts...); err != nil {
+				return err
+			}
+			listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+			items, _ := meta.ExtractList(list)
+			if listOpts.Limit > 0 && int64(len(items)) > listOpts.Limit {
+				return meta.SetList(list, items[:listOpts.Limit])
+			}
+			return nil
+		}}).Build()
+	mapping, err := resolveResource(c, "pods")
+	require.NoError(t, err)
+	names := func(objects []map[string]interface{}) []string {
+		var result []string
+		for _, obj := range objects {
+			result = append(result, itemKey(obj))
+		}
+		return result
+	}
+
+	result, err := listResource(context.Background(), c, mapping, &multiClusterQuery{resource: "pods", selector: labels.Everything(), limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shop/a-1", "shop/a-2"}, names(result))
+
+	// The limit applies to the objects matching name, not to the listed objects
+	result, err = listResource(context.Background(), c, mapping, &multiClusterQuery{resource: "pods", selector: labels.Everything(), name: "checkout", limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shop/checkout-1", "shop/checkout-2"}, names(result))
+}
+
+func TestCheckListAccess(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRESTMapper(testrestmapper.TestOnlyStaticRESTMapper(scheme)).
+		Build()
+	user := model.User{Username: "dev", Roles: []common.Role{{
+		Name:       "no-secrets",
+		Clusters:   []string{"*"},
+		Namespaces: []string{"*"},
+		Resources:  []string{"!secrets", "*"},
+		Verbs:      []string{"get"},
+	}}}
+
+	// A denied resource stays denied by any name that resolves to it
+	for _, resource := range []string{"secrets", "secret", "Secret", "secrets.", "SECRETS"} {
+		mapping, err := resolveResource(c, resource)
+		require.NoError(t, err, resource)
+		assert.Error(t, checkListAccess(user, "prod", c, mapping, ""), resource)
+		assert.Error(t, checkListAccess(user, "prod", c, mapping, "shop"), resource)
+	}
+	for _, resource := range []string{"pods", "pod", "Pod"} {
+		mapping, err := resolveResource(c, resource)
+		require.NoError(t, err, resource)
+		assert.NoError(t, checkListAccess(user, "prod", c, mapping, "shop"), resource)
+	}
+}
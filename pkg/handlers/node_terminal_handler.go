@@ -85,6 +85,18 @@ func (h *NodeTerminalHandler) HandleNodeTerminalWebSocket(c *gin.Context) {
 		}
 
 		session := kube.NewTerminalSession(cs.K8sClient, conn, "kube-system", nodeAgentName, common.NodeTerminalPodName)
+		recording := startTerminalRecording(user, model.TerminalRecording{
+			ClusterName: cs.Name,
+			SessionType: model.TerminalSessionTypeNode,
+			Namespace:   "kube-system",
+			PodName:     nodeAgentName,
+			Container:   common.NodeTerminalPodName,
+			NodeName:    nodeName,
+		})
+		if recording != nil {
+			session.SetRecorder(recording.recorder)
+			defer recording.Finish()
+		}
 		if err := session.Start(ctx, "attach"); err != nil {
 			klog.Errorf("Terminal session error: %v", err)
 		}
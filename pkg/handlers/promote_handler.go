@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zxh326/kite/pkg/cluster"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/handlers/resources"
+	"github.com/zxh326/kite/pkg/kube"
+	"github.com/zxh326/kite/pkg/model"
+	"github.com/zxh326/kite/pkg/rbac"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// promoteRelatedResources are the dependencies of workloads promoted with them
+var promoteRelatedResources = map[string]bool{
+	"configmaps": true,
+	"secrets":    true,
+	"services":   true,
+}
+
+type PromoteHandler struct {
+	cm *cluster.ClusterManager
+}
+
+func NewPromoteHandler(cm *cluster.ClusterManager) *PromoteHandler {
+	return &PromoteHandler{cm: cm}
+}
+
+// promoteObject is an object of a promotion plan
+type promoteObject struct {
+	item common.PromoteItem
+	// obj is the object to write to the target
+	obj      *unstructured.Unstructured
+	existing map[string]interface{}
+}
+
+// failed reports whether the object can not be promoted, failed objects have no action
+func (o *promoteObject) failed() bool {
+	return o.item.Action == ""
+}
+
+// Promote copies resources, optionally with the ConfigMaps, Secrets and
+// Services of workloads, from a cluster and namespace to another. The objects
+// are sanitized and their namespace, labels and images rewritten. Without
+// apply the plan is only validated with a server dry-run; with apply it is
+// applied unless an object of the plan failed, and a ResourceHistory is
+// recorded in the target cluster for every object written.
+func (h *PromoteHandler) Promote(c *gin.Context) {
+	var req common.PromoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Target.Namespace == "" {
+		req.Target.Namespace = req.Source.Namespace
+	}
+	if req.Source == req.Target {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source and target must differ in cluster or namespace"})
+		return
+	}
+	if err := validatePromoteLabels(req.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(model.User)
+	ctx := c.Request.Context()
+
+	source, releaseSource, err := h.acquire(user, req.Source.Cluster)
+	if err != nil {
+		respondRefError(c, err)
+		return
+	}
+	defer releaseSource()
+	target, releaseTarget, err := h.acquire(user, req.Target.Cluster)
+	if err != nil {
+		respondRefError(c, err)
+		return
+	}
+	defer releaseTarget()
+
+	objects, err := collectPromoteObjects(ctx, user, source, &req)
+	if err != nil {
+		respondRefError(c, err)
+		return
+	}
+	failed := false
+	for _, o := range objects {
+		planPromoteObject(ctx, user, target, o)
+		failed = failed || o.failed()
+	}
+
+	response := common.PromoteResponse{Items: make([]common.PromoteItem, 0, len(objects))}
+	if req.Apply && !failed {
+		for _, o := range objects {
+			applyPromoteObject(ctx, user, target, o)
+		}
+		response.Applied = true
+	}
+	for _, o := range objects {
+		response.Items = append(response.Items, o.item)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *PromoteHandler) acquire(user model.User, name string) (*cluster.ClientSet, func(), error) {
+	if !rbac.CanAccessCluster(user, name) {
+		return nil, nil, &refError{http.StatusNotFound, fmt.Errorf("cluster not found: %s", name)}
+	}
+	cs, release, err := h.cm.AcquireClientSet(name)
+	if err != nil {
+		if errors.Is(err, cluster.ErrClusterWarmingUp) {
+			return nil, nil, err
+		}
+		return nil, nil, &refError{http.StatusNotFound, err}
+	}
+	return cs, release, nil
+}
+
+func validatePromoteLabels(promoteLabels map[string]string) error {
+	for key, value := range promoteLabels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid value of label %s: %s", key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// collectPromoteObjects reads the requested objects, and the dependencies of
+// workloads with includeRelated, from the source and rewrites them for the
+// target. Dependencies come first so workloads find them when created.
+func collectPromoteObjects(ctx context.Context, user model.User, source *cluster.ClientSet, req *common.PromoteRequest) ([]*promoteObject, error) {
+	c := source.K8sClient.Client
+	seen := map[string]bool{}
+	var requested, related []*promoteObject
+	var workloads []client.Object
+	for _, r := range req.Resources {
+		mapping, err := resolveResource(c, r.Kind)
+		if err != nil {
+			return nil, &refError{http.StatusBadRequest, err}
+		}
+		obj, err := readSourceObject(ctx, user, source, mapping, req.Source.Namespace, r.Name)
+		if err != nil {
+			return nil, err
+		}
+		resource := rbacResource(c, mapping)
+		if key := resource + "/" + r.Name; !seen[key] {
+			seen[key] = true
+			o, err := newPromoteObject(obj, mapping, resource, false, req)
+			if err != nil {
+				return nil, err
+			}
+			requested = append(requested, o)
+			workloads = append(workloads, obj)
+		}
+	}
+	if !req.IncludeRelated {
+		return requested, nil
+	}
+
+	for _, workload := range workloads {
+		dependencies, err := resources.WorkloadDependencies(ctx, source.K8sClient, workload)
+		if err != nil {
+			return nil, err
+		}
+		for _, dependency := range dependencies {
+			key := dependency.Type + "/" + dependency.Name
+			if !promoteRelatedResources[dependency.Type] || seen[key] {
+				continue
+			}
+			seen[key] = true
+			mapping, err := resolveResource(c, dependency.Type)
+			if err != nil {
+				return nil, err
+			}
+			obj, err := readSourceObject(ctx, user, source, mapping, dependency.Namespace, dependency.Name)
+			var refErr *refError
+			if errors.As(err, &refErr) && refErr.status == http.StatusNotFound {
+				// References can be optional, they are reported but do not fail the plan
+				related = append(related, &promoteObject{item: common.PromoteItem{
+					Kind:      mapping.GroupVersionKind.Kind,
+					Resource:  dependency.Type,
+					Namespace: req.Target.Namespace,
+					Name:      dependency.Name,
+					Related:   true,
+					Action:    common.PromoteSkip,
+					Error:     "not found in the source",
+				}})
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			o, err := newPromoteObject(obj, mapping, dependency.Type, true, req)
+			if err != nil {
+				return nil, err
+			}
+			related = append(related, o)
+		}
+	}
+	return append(related, requested...), nil
+}
+
+func readSourceObject(ctx context.Context, user model.User, source *cluster.ClientSet, mapping *meta.RESTMapping, namespace, name string) (client.Object, error) {
+	resource := rbacResource(source.K8sClient.Client, mapping)
+	ns := namespace
+	if ns == "" || mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		ns = "_all"
+	}
+	if !rbac.CanAccess(user, resource, string(common.VerbGet), source.Name, ns) {
+		return nil, &refError{http.StatusForbidden, errors.New(rbac.NoAccess(user.Key(), string(common.VerbGet), resource, ns, source.Name))}
+	}
+	obj, err := readObject(ctx, source.K8sClient.Client, mapping, namespace, name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, &refError{http.StatusNotFound, err}
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+// newPromoteObject sanitizes a source object and rewrites it for the target
+func newPromoteObject(obj client.Object, mapping *meta.RESTMapping, resource string, related bool, req *common.PromoteRequest) (*promoteObject, error) {
+	m, err := toUnstructured(obj, mapping.GroupVersionKind)
+	if err != nil {
+		return nil, err
+	}
+	m = runtime.DeepCopyJSON(m)
+	kube.SanitizeObject(m)
+	u := &unstructured.Unstructured{Object: m}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		u.SetNamespace(req.Target.Namespace)
+	} else {
+		u.SetNamespace("")
+	}
+	if len(req.Labels) > 0 {
+		objLabels := u.GetLabels()
+		if objLabels == nil {
+			objLabels = map[string]string{}
+		}
+		for key, value := range req.Labels {
+			objLabels[key] = value
+		}
+		u.SetLabels(objLabels)
+	}
+	kube.RewriteImages(m, req.Images)
+	return &promoteObject{
+		item: common.PromoteItem{
+			Kind:      u.GetKind(),
+			Resource:  resource,
+			Namespace: u.GetNamespace(),
+			Name:      u.GetName(),
+			Related:   related,
+		},
+		obj: u,
+	}, nil
+}
+
+// planPromoteObject sets the action of an object in the target and validates
+// it with a server dry-run
+func planPromoteObject(ctx context.Context, user model.User, target *cluster.ClientSet, o *promoteObject) {
+	if o.obj == nil {
+		return
+	}
+	c := target.K8sClient.Client
+	gvk := o.obj.GroupVersionKind()
+	mapping, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		o.item.Error = fmt.Sprintf("%s is not served by the target cluster: %v", gvk, err)
+		return
+	}
+	o.item.Resource = rbacResource(c, mapping)
+	ns := o.obj.GetNamespace()
+	if ns == "" {
+		ns = "_all"
+	}
+
+	verb := common.VerbCreate
+	existing, err := readObject(ctx, c, mapping, o.obj.GetNamespace(), o.obj.GetName())
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		o.item.Error = err.Error()
+		return
+	default:
+		verb = common.VerbUpdate
+		if o.existing, err = toUnstructured(existing, gvk); err != nil {
+			o.item.Error = err.Error()
+			return
+		}
+	}
+	if !rbac.CanAccess(user, o.item.Resource, string(verb), target.Name, ns) {
+		o.item.Error = rbac.NoAccess(user.Key(), string(verb), o.item.Resource, ns, target.Name)
+		return
+	}
+
+	if o.existing == nil {
+		if err := c.Create(ctx, o.obj.DeepCopy(), client.DryRunAll); err != nil {
+			o.item.Error = err.Error()
+			return
+		}
+		o.item.Action = common.PromoteCreate
+		return
+	}
+	left, right := runtime.DeepCopyJSON(o.existing), runtime.DeepCopyJSON(o.obj.Object)
+	kube.NormalizeForDiff(left)
+	kube.NormalizeForDiff(right)
+	changes, _, err := kube.DiffObjects(left, right, "", "")
+	if err != nil {
+		o.item.Error = err.Error()
+		return
+	}
+	if len(changes) == 0 {
+		o.item.Action = common.PromoteUnchanged
+		return
+	}
+	o.obj.SetResourceVersion(existing.GetResourceVersion())
+	if err := c.Update(ctx, o.obj.DeepCopy(), client.DryRunAll); err != nil {
+		o.item.Error = err.Error()
+		return
+	}
+	o.item.Action = common.PromoteUpdate
+	o.item.Changes = changes
+}
+
+// applyPromoteObject writes a planned object to the target and records it
+func applyPromoteObject(ctx context.Context, user model.User, target *cluster.ClientSet, o *promoteObject) {
+	var err error
+	switch o.item.Action {
+	case common.PromoteCreate:
+		err = target.K8sClient.Create(ctx, o.obj)
+	case common.PromoteUpdate:
+		err = target.K8sClient.Update(ctx, o.obj)
+	default:
+		return
+	}
+	if err != nil {
+		o.item.Error = err.Error()
+	}
+
+	o.obj.SetManagedFields(nil)
+	resourceYAML, _ := yaml.Marshal(o.obj.Object)
+	var previousYAML []byte
+	if o.existing != nil {
+		unstructured.RemoveNestedField(o.existing, "metadata", "managedFields")
+		previousYAML, _ = yaml.Marshal(o.existing)
+	}
+	history := model.ResourceHistory{
+		ClusterName:   target.Name,
+		ResourceType:  o.item.Resource,
+		ResourceName:  o.obj.GetName(),
+		Namespace:     o.obj.GetNamespace(),
+		OperationType: "promote",
+		ResourceYAML:  string(resourceYAML),
+		PreviousYAML:  string(previousYAML),
+		Success:       err == nil,
+		ErrorMessage:  o.item.Error,
+		OperatorID:    user.ID,
+	}
+	if err := model.DB.Create(&history).Error; err != nil {
+		klog.Errorf("Failed to create resource history: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zxh326/kite/pkg/cluster"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/kube"
+	"github.com/zxh326/kite/pkg/model"
+	"gorm.io/gorm"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPromote(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.ResourceHistory{}))
+	prev := model.DB
+	model.DB = db
+	t.Cleanup(func() { model.DB = prev })
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	newClientSet := func(name string, objects ...client.Object) *cluster.ClientSet {
+		c := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithRESTMapper(testrestmapper.TestOnlyStaticRESTMapper(scheme)).
+			WithObjects(objects...).
+			Build()
+		return &cluster.ClientSet{Name: name, K8sClient: &kube.K8sClient{Client: c}}
+	}
+	labels := map[string]string{"app": "web"}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web", UID: "uid-1", ResourceVersion: "7"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:    "web",
+						Image:   "registry.dev/web:1.2",
+						EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "web-config"}}}},
+						Env: []corev1.EnvVar{{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{
+							SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "web-token"}, Key: "token"},
+						}}},
+					}},
+				},
+			},
+		},
+		Status: appsv1.DeploymentStatus{ReadyReplicas: 1},
+	}
+	source := newClientSet("dev", deployment,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-config"}, Data: map[string]string{"mode": "dev"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web"}, Spec: corev1.ServiceSpec{Selector: labels, ClusterIP: "10.0.0.1"}},
+	)
+	target := newClientSet("prod",
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "store", Name: "web-config"}, Data: map[string]string{"mode": "prod"}},
+	)
+	user := model.User{Model: model.Model{ID: 1}, Username: "alice", Roles: []common.Role{{
+		Name: "admin", Clusters: []string{"*"}, Namespaces: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"},
+	}}}
+	req := &common.PromoteRequest{
+		Source:         common.PromoteLocation{Cluster: "dev", Namespace: "shop"},
+		Target:         common.PromoteLocation{Cluster: "prod", Namespace: "store"},
+		Resources:      []common.PromoteResource{{Kind: "deployments.apps", Name: "web"}},
+		IncludeRelated: true,
+		Labels:         map[string]string{"promoted-from": "dev"},
+		Images:         map[string]string{"registry.dev/web": "registry.prod/web"},
+	}
+	ctx := context.Background()
+
+	objects, err := collectPromoteObjects(ctx, user, source, req)
+	require.NoError(t, err)
+	for _, o := range objects {
+		planPromoteObject(ctx, user, target, o)
+	}
+	items := map[string]common.PromoteItem{}
+	for _, o := range objects {
+		items[o.item.Resource+"/"+o.item.Name] = o.item
+	}
+	require.Len(t, items, 4)
+	assert.Equal(t, common.PromoteCreate, items["deployments/web"].Action)
+	assert.False(t, items["deployments/web"].Related)
+	assert.Equal(t, common.PromoteCreate, items["services/web"].Action)
+	assert.True(t, items["services/web"].Related)
+	assert.Equal(t, common.PromoteUpdate, items["configmaps/web-config"].Action)
+	assert.Equal(t, []common.ResourceDiffChange{
+		{Path: "data.mode", Type: common.DiffChanged, Left: "prod", Right: "dev"},
+		{Path: "metadata.labels", Type: common.DiffAdded, Right: map[string]interface{}{"promoted-from": "dev"}},
+	}, items["configmaps/web-config"].Changes)
+	assert.Equal(t, common.PromoteSkip, items["secrets/web-token"].Action)
+	// Dependencies come before the workload
+	assert.Equal(t, "deployments", objects[len(objects)-1].item.Resource)
+
+	// Nothing is written by the plan
+	var deployments appsv1.DeploymentList
+	require.NoError(t, target.K8sClient.List(ctx, &deployments))
+	assert.Empty(t, deployments.Items)
+
+	for _, o := range objects {
+		applyPromoteObject(ctx, user, target, o)
+	}
+	var promoted appsv1.Deployment
+	require.NoError(t, target.K8sClient.Get(ctx, client.ObjectKey{Namespace: "store", Name: "web"}, &promoted))
+	assert.Equal(t, "registry.prod/web:1.2", promoted.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, map[string]string{"promoted-from": "dev"}, promoted.Labels)
+	assert.NotEqual(t, deployment.UID, promoted.UID)
+	assert.Zero(t, promoted.Status.ReadyReplicas)
+
+	var config corev1.ConfigMap
+	require.NoError(t, target.K8sClient.Get(ctx, client.ObjectKey{Namespace: "store", Name: "web-config"}, &config))
+	assert.Equal(t, "dev", config.Data["mode"])
+
+	var history []model.ResourceHistory
+	require.NoError(t, db.Order("id").Find(&history).Error)
+	require.Len(t, history, 3)
+	byResource := map[string]model.ResourceHistory{}
+	for _, h := range history {
+		assert.Equal(t, "prod", h.ClusterName)
+		assert.Equal(t, "store", h.Namespace)
+		assert.Equal(t, "promote", h.OperationType)
+		assert.True(t, h.Success, h.ErrorMessage)
+		byResource[h.ResourceType] = h
+	}
+	assert.Contains(t, byResource["configmaps"].PreviousYAML, "mode: prod")
+	assert.Contains(t, byResource["configmaps"].ResourceYAML, "mode: dev")
+	assert.Empty(t, byResource["deployments"].PreviousYAML)
+	assert.Equal(t, "deployments", history[2].ResourceType)
+}
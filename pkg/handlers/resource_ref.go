@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// resourceAliases maps the resource names of the API routes that differ from
+// the Kubernetes resource names
+var resourceAliases = map[string]string{
+	"crds": "customresourcedefinitions.apiextensions.k8s.io",
+}
+
+// resolveResource returns the mapping of a resource given by the resource name
+// of the API routes (deployments, widgets.example.com) or by kind (Deployment)
+func resolveResource(c client.Client, resource string) (*meta.RESTMapping, error) {
+	name := resource
+	if alias, ok := resourceAliases[name]; ok {
+		name = alias
+	}
+	// Kinds are matched as singular resource names
+	gvk, err := c.RESTMapper().KindFor(schema.ParseGroupResource(strings.ToLower(name)).WithVersion(""))
+	if err != nil {
+		return nil, fmt.Errorf("resource %s is not served by the cluster: %w", resource, err)
+	}
+	return c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+// rbacResource returns the name RBAC rules use for a resource: the plural for
+// built-in types and plural.group, the CRD name, for custom resources
+func rbacResource(c client.Client, mapping *meta.RESTMapping) string {
+	gr := mapping.Resource.GroupResource()
+	for alias, name := range resourceAliases {
+		if name == gr.String() {
+			return alias
+		}
+	}
+	if c.Scheme().Recognizes(mapping.GroupVersionKind) {
+		return gr.Resource
+	}
+	return gr.String()
+}
+
+// newObject returns a typed object for types known to the scheme, so reads are
+// served from the informer cache, and an unstructured object otherwise
+func newObject(c client.Client, gvk schema.GroupVersionKind) client.Object {
+	if obj, err := c.Scheme().New(gvk); err == nil {
+		if o, ok := obj.(client.Object); ok {
+			return o
+		}
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	return u
+}
+
+// readObject reads an object of the mapped resource, the namespace is ignored
+// for cluster scoped resources
+func readObject(ctx context.Context, c client.Client, mapping *meta.RESTMapping, namespace, name string) (client.Object, error) {
+	obj := newObject(c, mapping.GroupVersionKind)
+	key := client.ObjectKey{Name: name}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		key.Namespace = namespace
+	}
+	if err := c.Get(ctx, key, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// getObject reads an object of the mapped resource as a map
+func getObject(ctx context.Context, c client.Client, mapping *meta.RESTMapping, namespace, name string) (map[string]interface{}, error) {
+	obj, err := readObject(ctx, c, mapping, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return toUnstructured(obj, mapping.GroupVersionKind)
+}
+
+// toUnstructured converts an object to a map with its apiVersion and kind,
+// typed objects read from the cache have no type meta
+func toUnstructured(obj runtime.Object, gvk schema.GroupVersionKind) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		m = u.Object
+	} else {
+		var err error
+		if m, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj); err != nil {
+			return nil, err
+		}
+	}
+	m["apiVersion"], m["kind"] = gvk.GroupVersion().String(), gvk.Kind
+	return m, nil
+}
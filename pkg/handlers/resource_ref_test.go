@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResolveResource(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRESTMapper(testrestmapper.TestOnlyStaticRESTMapper(scheme)).
+		WithObjects(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web"}}).
+		Build()
+
+	for _, resource := range []string{"deployments", "Deployment", "deployments.apps"} {
+		mapping, err := resolveResource(c, resource)
+		require.NoError(t, err, resource)
+		assert.Equal(t, "Deployment", mapping.GroupVersionKind.Kind)
+		assert.Equal(t, "deployments", rbacResource(c, mapping))
+	}
+	mapping, err := resolveResource(c, "crds")
+	require.NoError(t, err)
+	assert.Equal(t, "crds", rbacResource(c, mapping))
+
+	mapping, err = resolveResource(c, "deployments.apps")
+	require.NoError(t, err)
+	obj, err := getObject(context.Background(), c, mapping, "shop", "web")
+	require.NoError(t, err)
+	assert.Equal(t, "apps/v1", obj["apiVersion"])
+	assert.Equal(t, "Deployment", obj["kind"])
+
+	_, err = resolveResource(c, "Widget")
+	assert.ErrorContains(t, err, "resource Widget is not served by the cluster")
+}
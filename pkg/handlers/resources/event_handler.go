@@ -1,13 +1,28 @@
 package resources
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zxh326/kite/pkg/cluster"
+	"github.com/zxh326/kite/pkg/model"
+	"github.com/zxh326/kite/pkg/rbac"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ArchivedEventAnnotation marks events read from the event archive instead of the cluster
+	ArchivedEventAnnotation = "kite.io/archived"
+
+	defaultArchivedEventLimit = 1000
 )
 
 type EventHandler struct {
@@ -41,6 +56,12 @@ func (h *EventHandler) ListResourceEvents(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to access object type info: " + err.Error()})
 		return
 	}
+	timeRange, err := parseEventTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	obj := target.(metav1.Object)
 	events, err := cs.K8sClient.ClientSet.CoreV1().Events(obj.GetNamespace()).List(c.Request.Context(), metav1.ListOptions{
 		FieldSelector: "involvedObject.kind=" + objType.GetKind() +
@@ -52,9 +73,182 @@ func (h *EventHandler) ListResourceEvents(c *gin.Context) {
 		return
 	}
 
+	archived, err := model.ListArchivedEvents(model.ArchivedEventQuery{
+		ClusterName:  cs.Name,
+		Namespace:    obj.GetNamespace(),
+		InvolvedKind: objType.GetKind(),
+		InvolvedName: name,
+		Since:        timeRange.since,
+		Until:        timeRange.until,
+		Limit:        defaultArchivedEventLimit,
+	})
+	if err != nil {
+		klog.Warningf("Failed to list archived events of %s/%s in cluster %s: %v", obj.GetNamespace(), name, cs.Name, err)
+	}
+	events.Items = mergeArchivedEvents(events.Items, archived, timeRange)
+
+	c.JSON(http.StatusOK, events)
+}
+
+// List lists live events merged with archived events of the cluster. since and
+// until (RFC3339) limit both to a time range, archived=false returns live events only.
+// Archived events cannot be paginated or selected, so they are left out in that case.
+func (h *EventHandler) List(c *gin.Context) {
+	if c.Query("archived") == "false" || c.Query("continue") != "" ||
+		c.Query("labelSelector") != "" || c.Query("fieldSelector") != "" {
+		h.GenericResourceHandler.List(c)
+		return
+	}
+	timeRange, err := parseEventTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := defaultArchivedEventLimit
+	if v := c.Query("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	events, err := h.list(c)
+	if err != nil {
+		return
+	}
+
+	cs := c.MustGet("cluster").(*cluster.ClientSet)
+	user := c.MustGet("user").(model.User)
+	namespace := c.Param("namespace")
+	if namespace == "_all" {
+		namespace = ""
+	}
+	archived, err := model.ListArchivedEvents(model.ArchivedEventQuery{
+		ClusterName: cs.Name,
+		Namespace:   namespace,
+		Since:       timeRange.since,
+		Until:       timeRange.until,
+		Limit:       limit,
+	})
+	if err != nil {
+		klog.Warningf("Failed to list archived events in cluster %s: %v", cs.Name, err)
+	}
+	archived = slices.DeleteFunc(archived, func(e model.ArchivedEvent) bool {
+		return !rbac.CanAccessNamespace(user, cs.Name, e.Namespace)
+	})
+	events.Items = mergeArchivedEvents(events.Items, archived, timeRange)
+
 	c.JSON(http.StatusOK, events)
 }
 
+// eventTimeRange limits events to those seen between since and until, zero values are open ends
+type eventTimeRange struct {
+	since time.Time
+	until time.Time
+}
+
+func parseEventTimeRange(c *gin.Context) (eventTimeRange, error) {
+	var r eventTimeRange
+	var err error
+	if v := c.Query("since"); v != "" {
+		if r.since, err = time.Parse(time.RFC3339, v); err != nil {
+			return r, fmt.Errorf("invalid since parameter, expected RFC3339: %w", err)
+		}
+	}
+	if v := c.Query("until"); v != "" {
+		if r.until, err = time.Parse(time.RFC3339, v); err != nil {
+			return r, fmt.Errorf("invalid until parameter, expected RFC3339: %w", err)
+		}
+	}
+	if !r.since.IsZero() && !r.until.IsZero() && r.until.Before(r.since) {
+		return r, fmt.Errorf("until must not be before since")
+	}
+	return r, nil
+}
+
+// contains reports whether the event was seen at some point in the range
+func (r eventTimeRange) contains(e *corev1.Event) bool {
+	first, last := eventFirstSeen(e), eventLastSeen(e)
+	if !r.since.IsZero() && last.Before(r.since) {
+		return false
+	}
+	if !r.until.IsZero() && first.After(r.until) {
+		return false
+	}
+	return true
+}
+
+func eventFirstSeen(e *corev1.Event) time.Time {
+	switch {
+	case !e.FirstTimestamp.IsZero():
+		return e.FirstTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+func eventLastSeen(e *corev1.Event) time.Time {
+	last := e.LastTimestamp.Time
+	if e.Series != nil && e.Series.LastObservedTime.After(last) {
+		last = e.Series.LastObservedTime.Time
+	}
+	if last.IsZero() {
+		return eventFirstSeen(e)
+	}
+	return last
+}
+
+func archivedToEvent(a model.ArchivedEvent) corev1.Event {
+	return corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              fmt.Sprintf("%s.archived-%d", a.InvolvedName, a.ID),
+			Namespace:         a.Namespace,
+			UID:               types.UID(fmt.Sprintf("archived-%d", a.ID)),
+			CreationTimestamp: metav1.NewTime(a.FirstTimestamp),
+			Annotations:       map[string]string{ArchivedEventAnnotation: "true"},
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:      a.InvolvedKind,
+			Namespace: a.Namespace,
+			Name:      a.InvolvedName,
+			UID:       types.UID(a.InvolvedUID),
+		},
+		Reason:         a.Reason,
+		Message:        a.Message,
+		Type:           a.Type,
+		Count:          a.Count,
+		Source:         corev1.EventSource{Component: a.Source},
+		FirstTimestamp: metav1.NewTime(a.FirstTimestamp),
+		LastTimestamp:  metav1.NewTime(a.LastTimestamp),
+	}
+}
+
+// mergeArchivedEvents adds the archived events that are no longer live and
+// drops events outside the range, the result is sorted by last seen, newest first
+func mergeArchivedEvents(live []corev1.Event, archived []model.ArchivedEvent, r eventTimeRange) []corev1.Event {
+	liveUIDs := make(map[types.UID]bool, len(live))
+	items := make([]corev1.Event, 0, len(live)+len(archived))
+	for i := range live {
+		liveUIDs[live[i].UID] = true
+		if r.contains(&live[i]) {
+			items = append(items, live[i])
+		}
+	}
+	for _, a := range archived {
+		if liveUIDs[types.UID(a.LastEventUID)] {
+			continue
+		}
+		e := archivedToEvent(a)
+		if r.contains(&e) {
+			items = append(items, e)
+		}
+	}
+	slices.SortStableFunc(items, func(a, b corev1.Event) int {
+		return eventLastSeen(&b).Compare(eventLastSeen(&a))
+	})
+	return items
+}
+
 func (h *EventHandler) registerCustomRoutes(group *gin.RouterGroup) {
 	group.GET("/resources", h.ListResourceEvents)
 }
@@ -0,0 +1,36 @@
+package resources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zxh326/kite/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMergeArchivedEvents(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	live := []corev1.Event{{
+		ObjectMeta:     metav1.ObjectMeta{Name: "web.1", UID: "live-1"},
+		Reason:         "BackOff",
+		FirstTimestamp: metav1.NewTime(base.Add(time.Hour)),
+		LastTimestamp:  metav1.NewTime(base.Add(2 * time.Hour)),
+	}}
+	archived := []model.ArchivedEvent{
+		{Model: model.Model{ID: 1}, Reason: "BackOff", LastEventUID: "live-1", FirstTimestamp: base, LastTimestamp: base.Add(2 * time.Hour)},
+		{Model: model.Model{ID: 2}, Reason: "Unhealthy", LastEventUID: "gone", FirstTimestamp: base, LastTimestamp: base.Add(30 * time.Minute)},
+		{Model: model.Model{ID: 3}, Reason: "Failed", LastEventUID: "old", FirstTimestamp: base.Add(-48 * time.Hour), LastTimestamp: base.Add(-47 * time.Hour)},
+	}
+
+	items := mergeArchivedEvents(live, archived, eventTimeRange{since: base.Add(-time.Hour)})
+	if len(items) != 2 {
+		t.Fatalf("mergeArchivedEvents() returned %d events, want 2", len(items))
+	}
+	if items[0].UID != "live-1" || items[1].Reason != "Unhealthy" {
+		t.Errorf("unexpected order: %s, %s", items[0].UID, items[1].Reason)
+	}
+	if items[1].Annotations[ArchivedEventAnnotation] != "true" {
+		t.Errorf("archived event is not annotated")
+	}
+}
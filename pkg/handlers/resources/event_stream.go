@@ -0,0 +1,396 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zxh326/kite/pkg/cluster"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/model"
+	"github.com/zxh326/kite/pkg/rbac"
+	eventsv1 "k8s.io/api/events/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// eventSeriesFlushInterval is how often coalesced series count updates are sent
+const eventSeriesFlushInterval = 5 * time.Second
+
+// EventStreamFilter selects the events sent by StreamClusterEvents
+type EventStreamFilter struct {
+	Types   []string
+	Reasons []string
+	Kind    string
+	Name    string
+	Message *regexp.Regexp
+}
+
+func parseEventStreamFilter(c *gin.Context) (*EventStreamFilter, error) {
+	f := &EventStreamFilter{
+		Types:   splitQueryList(c.QueryArray("type")),
+		Reasons: splitQueryList(c.QueryArray("reason")),
+		Kind:    c.Query("kind"),
+		Name:    c.Query("name"),
+	}
+	if pattern := c.Query("message"); pattern != "" {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message pattern: %w", err)
+		}
+		f.Message = re
+	}
+	return f, nil
+}
+
+// splitQueryList accepts both repeated parameters and comma separated values
+func splitQueryList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// Match reports whether the event passes the filter, kinds and types are
+// compared case insensitively
+func (f *EventStreamFilter) Match(e *eventsv1.Event) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Types) > 0 && !slices.ContainsFunc(f.Types, func(t string) bool { return strings.EqualFold(t, e.Type) }) {
+		return false
+	}
+	if len(f.Reasons) > 0 && !slices.Contains(f.Reasons, e.Reason) {
+		return false
+	}
+	if f.Kind != "" && !strings.EqualFold(f.Kind, e.Regarding.Kind) {
+		return false
+	}
+	if f.Name != "" && f.Name != e.Regarding.Name {
+		return false
+	}
+	if f.Message != nil && !f.Message.MatchString(e.Note) {
+		return false
+	}
+	return true
+}
+
+// eventCount returns how often the event was observed
+func eventCount(e *eventsv1.Event) int32 {
+	if e.Series != nil {
+		return e.Series.Count
+	}
+	if e.DeprecatedCount > 0 {
+		return e.DeprecatedCount
+	}
+	return 1
+}
+
+func eventLastObserved(e *eventsv1.Event) time.Time {
+	if e.Series != nil && !e.Series.LastObservedTime.IsZero() {
+		return e.Series.LastObservedTime.Time
+	}
+	if !e.DeprecatedLastTimestamp.IsZero() {
+		return e.DeprecatedLastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// EventSeriesUpdate is sent instead of the whole event when only the
+// occurrence count of an already sent event changed
+type EventSeriesUpdate struct {
+	UID              types.UID `json:"uid"`
+	Namespace        string    `json:"namespace"`
+	Name             string    `json:"name"`
+	Count            int32     `json:"count"`
+	LastObservedTime time.Time `json:"lastObservedTime"`
+}
+
+type trackedEvent struct {
+	event   *eventsv1.Event
+	pending bool
+}
+
+// eventSeriesTracker remembers the sent events so that repeated occurrences,
+// which only bump the series count, are coalesced into one update per flush
+type eventSeriesTracker struct {
+	events map[types.UID]*trackedEvent
+}
+
+func newEventSeriesTracker() *eventSeriesTracker {
+	return &eventSeriesTracker{events: map[types.UID]*trackedEvent{}}
+}
+
+// Observe records a watch event and returns the SSE event type and payload
+// to send immediately, an empty type means nothing has to be sent now
+func (t *eventSeriesTracker) Observe(eventType watch.EventType, e *eventsv1.Event) (string, any) {
+	switch eventType {
+	case watch.Deleted:
+		delete(t.events, e.UID)
+		return "deleted", e
+	case watch.Added, watch.Modified:
+		prev, ok := t.events[e.UID]
+		t.events[e.UID] = &trackedEvent{event: e}
+		if !ok {
+			return "added", e
+		}
+		if sameEventOccurrence(prev.event, e) {
+			if eventCount(e) != eventCount(prev.event) || !eventLastObserved(e).Equal(eventLastObserved(prev.event)) {
+				t.events[e.UID].pending = true
+			} else {
+				t.events[e.UID].pending = prev.pending
+			}
+			return "", nil
+		}
+		return "modified", e
+	}
+	return "", nil
+}
+
+// Flush returns the coalesced series updates since the last flush
+func (t *eventSeriesTracker) Flush() []EventSeriesUpdate {
+	var updates []EventSeriesUpdate
+	for _, tracked := range t.events {
+		if !tracked.pending {
+			continue
+		}
+		tracked.pending = false
+		e := tracked.event
+		updates = append(updates, EventSeriesUpdate{
+			UID:              e.UID,
+			Namespace:        e.Namespace,
+			Name:             e.Name,
+			Count:            eventCount(e),
+			LastObservedTime: eventLastObserved(e),
+		})
+	}
+	slices.SortFunc(updates, func(a, b EventSeriesUpdate) int {
+		return a.LastObservedTime.Compare(b.LastObservedTime)
+	})
+	return updates
+}
+
+// sameEventOccurrence reports whether b is a repetition of a, i.e. only the
+// series or the deprecated count and timestamps differ
+func sameEventOccurrence(a, b *eventsv1.Event) bool {
+	return a.Type == b.Type &&
+		a.Reason == b.Reason &&
+		a.Action == b.Action &&
+		a.Note == b.Note &&
+		a.Regarding == b.Regarding
+}
+
+// eventWatchResult is a watch event or the error that ended a namespace watch
+type eventWatchResult struct {
+	event watch.Event
+	err   error
+}
+
+// streamableEventNamespaces returns the namespaces to watch, nil means all
+// namespaces with a single watch
+func streamableEventNamespaces(ctx context.Context, cs *cluster.ClientSet, user model.User) ([]string, error) {
+	if rbac.CanAccess(user, "events", string(common.VerbGet), cs.Name, "_all") {
+		return nil, nil
+	}
+	nsList, err := cs.K8sClient.ClientSet.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var namespaces []string
+	for _, ns := range nsList.Items {
+		if rbac.CanAccess(user, "events", string(common.VerbGet), cs.Name, ns.Name) {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+	return namespaces, nil
+}
+
+// watchEvents watches the events of a namespace and re-establishes the watch
+// when the API server closes it, until ctx is done
+func watchEvents(ctx context.Context, client kubernetes.Interface, namespace string, initial bool, out chan<- eventWatchResult) {
+	resourceVersion := ""
+	if !initial {
+		list, err := client.EventsV1().Events(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+		if err != nil {
+			select {
+			case out <- eventWatchResult{err: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		resourceVersion = list.ResourceVersion
+	}
+	for ctx.Err() == nil {
+		w, err := client.EventsV1().Events(namespace).Watch(ctx, metav1.ListOptions{
+			ResourceVersion:     resourceVersion,
+			AllowWatchBookmarks: true,
+		})
+		if err != nil {
+			select {
+			case out <- eventWatchResult{err: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		for ev := range w.ResultChan() {
+			switch ev.Type {
+			case watch.Error:
+				// The resource version is too old, start over without replaying old events
+				if status := apierrors.FromObject(ev.Object); apierrors.IsResourceExpired(status) || apierrors.IsGone(status) {
+					resourceVersion = ""
+					if list, err := client.EventsV1().Events(namespace).List(ctx, metav1.ListOptions{Limit: 1}); err == nil {
+						resourceVersion = list.ResourceVersion
+					}
+				}
+				continue
+			case watch.Bookmark:
+				if e, ok := ev.Object.(*eventsv1.Event); ok {
+					resourceVersion = e.ResourceVersion
+				}
+				continue
+			}
+			e, ok := ev.Object.(*eventsv1.Event)
+			if !ok {
+				continue
+			}
+			resourceVersion = e.ResourceVersion
+			select {
+			case out <- eventWatchResult{event: ev}:
+			case <-ctx.Done():
+				w.Stop()
+				return
+			}
+		}
+		w.Stop()
+	}
+}
+
+// StreamClusterEvents streams events.k8s.io/v1 events of all namespaces the
+// user may read as server-sent events. Query parameters:
+// type, reason (repeatable or comma separated), kind and name of the involved
+// object, message (case insensitive regex) and initial=false to skip existing events.
+func (h *EventHandler) StreamClusterEvents(c *gin.Context) {
+	cs := c.MustGet("cluster").(*cluster.ClientSet)
+	user := c.MustGet("user").(model.User)
+
+	filter, err := parseEventStreamFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	initial := c.DefaultQuery("initial", "true") != "false"
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	namespaces, err := streamableEventNamespaces(ctx, cs, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list namespaces: " + err.Error()})
+		return
+	}
+	allNamespaces := namespaces == nil
+	if !allNamespaces && len(namespaces) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": rbac.NoAccess(user.Key(), string(common.VerbGet), "events", "_all", cs.Name)})
+		return
+	}
+	if allNamespaces {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	results := make(chan eventWatchResult, 100)
+	var wg sync.WaitGroup
+	for _, ns := range namespaces {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watchEvents(ctx, cs.K8sClient.ClientSet, ns, initial, results)
+		}()
+	}
+	defer wg.Wait()
+	defer cancel()
+
+	// A cluster wide role may still exclude namespaces, e.g. "!kube-system"
+	namespaceAllowed := map[string]bool{}
+	canRead := func(ns string) bool {
+		if !allNamespaces {
+			return true
+		}
+		allowed, ok := namespaceAllowed[ns]
+		if !ok {
+			allowed = rbac.CanAccess(user, "events", string(common.VerbGet), cs.Name, ns)
+			namespaceAllowed[ns] = allowed
+		}
+		return allowed
+	}
+
+	tracker := newEventSeriesTracker()
+	pingTicker := time.NewTicker(15 * time.Second)
+	defer pingTicker.Stop()
+	flushTicker := time.NewTicker(eventSeriesFlushInterval)
+	defer flushTicker.Stop()
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming unsupported"})
+		return
+	}
+	if allNamespaces {
+		_ = writeSSE(c, "ready", gin.H{"namespaces": []string{"_all"}})
+	} else {
+		_ = writeSSE(c, "ready", gin.H{"namespaces": namespaces})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cs.Retired():
+			// The cluster was updated or removed, the client reconnects to the new one
+			_ = writeSSE(c, "close", gin.H{"message": "cluster configuration changed"})
+			return
+		case <-pingTicker.C:
+			_, _ = fmt.Fprintf(c.Writer, ": ping\n\n")
+			flusher.Flush()
+		case <-flushTicker.C:
+			for _, update := range tracker.Flush() {
+				if err := writeSSE(c, "series", update); err != nil {
+					return
+				}
+			}
+		case res := <-results:
+			if res.err != nil {
+				klog.Warningf("Event watch failed in cluster %s: %v", cs.Name, res.err)
+				_ = writeSSE(c, "error", gin.H{"error": fmt.Sprintf("failed to watch events: %v", res.err)})
+				continue
+			}
+			e := res.event.Object.(*eventsv1.Event)
+			if !canRead(e.Namespace) || !filter.Match(e) {
+				continue
+			}
+			eventType, payload := tracker.Observe(res.event.Type, e)
+			if eventType == "" {
+				continue
+			}
+			if err := writeSSE(c, eventType, payload); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package resources
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func newTestEvent(count int32, note string) *eventsv1.Event {
+	return &eventsv1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "web.1", Namespace: "default", UID: "uid-1"},
+		Type:       corev1.EventTypeWarning,
+		Reason:     "BackOff",
+		Note:       note,
+		Regarding:  corev1.ObjectReference{Kind: "Pod", Name: "web-0", Namespace: "default"},
+		Series: &eventsv1.EventSeries{
+			Count:            count,
+			LastObservedTime: metav1.NewMicroTime(time.Unix(int64(count), 0)),
+		},
+	}
+}
+
+func TestEventStreamFilter(t *testing.T) {
+	e := newTestEvent(1, "Back-off restarting failed container")
+	tests := []struct {
+		name   string
+		filter *EventStreamFilter
+		want   bool
+	}{
+		{"nil", nil, true},
+		{"type", &EventStreamFilter{Types: []string{"warning"}}, true},
+		{"other type", &EventStreamFilter{Types: []string{"Normal"}}, false},
+		{"reason", &EventStreamFilter{Reasons: []string{"Pulled", "BackOff"}}, true},
+		{"kind and name", &EventStreamFilter{Kind: "pod", Name: "web-0"}, true},
+		{"other name", &EventStreamFilter{Kind: "Pod", Name: "web-1"}, false},
+		{"message", &EventStreamFilter{Message: regexp.MustCompile("(?i)back-off")}, true},
+		{"message miss", &EventStreamFilter{Message: regexp.MustCompile("OOMKilled")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(e); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventSeriesTracker(t *testing.T) {
+	tracker := newEventSeriesTracker()
+
+	if typ, _ := tracker.Observe(watch.Added, newTestEvent(1, "back-off")); typ != "added" {
+		t.Fatalf("first occurrence = %q, want added", typ)
+	}
+	// Series count bumps are coalesced until the next flush
+	for i := int32(2); i <= 4; i++ {
+		if typ, _ := tracker.Observe(watch.Modified, newTestEvent(i, "back-off")); typ != "" {
+			t.Fatalf("series update %d = %q, want nothing", i, typ)
+		}
+	}
+	updates := tracker.Flush()
+	if len(updates) != 1 || updates[0].Count != 4 {
+		t.Fatalf("Flush() = %+v, want one update with count 4", updates)
+	}
+	if updates := tracker.Flush(); len(updates) != 0 {
+		t.Fatalf("second Flush() = %+v, want none", updates)
+	}
+	// A replayed event after a watch restart is not sent again
+	if typ, _ := tracker.Observe(watch.Added, newTestEvent(4, "back-off")); typ != "" {
+		t.Fatalf("replayed event = %q, want nothing", typ)
+	}
+	if typ, _ := tracker.Observe(watch.Modified, newTestEvent(5, "image pull failed")); typ != "modified" {
+		t.Fatalf("changed note = %q, want modified", typ)
+	}
+	if typ, _ := tracker.Observe(watch.Deleted, newTestEvent(5, "image pull failed")); typ != "deleted" {
+		t.Fatalf("delete = %q, want deleted", typ)
+	}
+	if typ, _ := tracker.Observe(watch.Added, newTestEvent(1, "back-off")); typ != "added" {
+		t.Fatalf("event after delete = %q, want added", typ)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"mime"
 	"net/http"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -27,6 +28,7 @@ import (
 	"k8s.io/klog/v2"
 	metricsv1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
 )
 
 type PodHandler struct {
@@ -271,6 +273,11 @@ func (h *PodHandler) registerCustomRoutes(group *gin.RouterGroup) {
 	filesGroup.GET("/preview", h.PreviewFile)
 	filesGroup.GET("/download", h.DownloadFile)
 	filesGroup.PUT("/upload", h.UploadFile)
+	filesGroup.PUT("/save", h.SaveFile)
+	filesGroup.DELETE("", h.DeleteFile)
+	filesGroup.POST("/rename", h.RenameFile)
+	filesGroup.POST("/mkdir", h.CreateDirectory)
+	filesGroup.POST("/chmod", h.ChmodFile)
 }
 
 type FileInfo struct {
@@ -281,6 +288,8 @@ type FileInfo struct {
 	Mode    string `json:"mode"`
 	UID     string `json:"uid,omitempty"`
 	GID     string `json:"gid,omitempty"`
+	// LinkTarget is the target of a symbolic link, Name is the link itself
+	LinkTarget string `json:"linkTarget,omitempty"`
 }
 
 func (h *PodHandler) ListFiles(c *gin.Context) {
@@ -335,14 +344,21 @@ func parseLsOutput(output string) []FileInfo {
 		if name == "." || name == ".." {
 			continue
 		}
+		var linkTarget string
+		if strings.HasPrefix(mode, "l") {
+			if link, target, ok := strings.Cut(name, " -> "); ok {
+				name, linkTarget = link, target
+			}
+		}
 		files = append(files, FileInfo{
-			Name:    name,
-			IsDir:   isDir,
-			Size:    size,
-			ModTime: modTime,
-			Mode:    mode,
-			UID:     uid,
-			GID:     gid,
+			Name:       name,
+			IsDir:      isDir,
+			Size:       size,
+			ModTime:    modTime,
+			Mode:       mode,
+			UID:        uid,
+			GID:        gid,
+			LinkTarget: linkTarget,
 		})
 	}
 	sort.Slice(files, func(i, j int) bool {
@@ -368,9 +384,6 @@ func (h *PodHandler) PreviewFile(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
 		return
 	}
-	if strings.Contains(path, "->") {
-		path = strings.TrimSpace(strings.SplitN(path, "->", 2)[0])
-	}
 
 	cmd := []string{"cat", path}
 
@@ -408,9 +421,6 @@ func (h *PodHandler) DownloadFile(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
 		return
 	}
-	if strings.Contains(path, "->") {
-		path = strings.TrimSpace(strings.SplitN(path, "->", 2)[0])
-	}
 	_, _, err := cs.K8sClient.ExecCommandBuffered(c.Request.Context(), namespace, podName, container, []string{"test", "-d", path})
 	isDir := err == nil
 
@@ -469,7 +479,7 @@ func (h *PodHandler) UploadFile(c *gin.Context) {
 	}
 
 	destPath := filepath.Join(path, header.Filename)
-	cmd := []string{"tee", destPath}
+	cmd := []string{"tee", "--", destPath}
 
 	err = cs.K8sClient.ExecCommand(c.Request.Context(), kube.ExecOptions{
 		Namespace:     namespace,
@@ -481,6 +491,7 @@ func (h *PodHandler) UploadFile(c *gin.Context) {
 		Stderr:        nil,
 		TTY:           false,
 	})
+	h.recordFileOperation(c, "file_upload", map[string]string{"path": destPath}, err)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to upload file: %v", err)})
@@ -490,6 +501,205 @@ func (h *PodHandler) UploadFile(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "file uploaded successfully"})
 }
 
+// SaveFile overwrites the file at path with the raw request body
+func (h *PodHandler) SaveFile(c *gin.Context) {
+	namespace := c.Param("namespace")
+	podName := c.Param("name")
+	container := c.Query("container")
+	cs := c.MustGet("cluster").(*cluster.ClientSet)
+	path, err := cleanFilePath(c.Query("path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var stderr strings.Builder
+	err = cs.K8sClient.ExecCommand(c.Request.Context(), kube.ExecOptions{
+		Namespace:     namespace,
+		PodName:       podName,
+		ContainerName: container,
+		Command:       []string{"tee", "--", path},
+		Stdin:         c.Request.Body,
+		Stdout:        nil,
+		Stderr:        &stderr,
+		TTY:           false,
+	})
+	err = execError(err, stderr.String())
+	h.recordFileOperation(c, "file_save", map[string]string{"path": path}, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to save file: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "file saved successfully"})
+}
+
+// DeleteFile removes a file, or a directory when recursive=true
+func (h *PodHandler) DeleteFile(c *gin.Context) {
+	path, err := cleanFilePath(c.Query("path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if path == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refusing to delete /"})
+		return
+	}
+
+	cmd := []string{"rm", "-f", "--", path}
+	if c.Query("recursive") == "true" {
+		cmd = []string{"rm", "-rf", "--", path}
+	}
+	err = h.execFileCommand(c, cmd)
+	h.recordFileOperation(c, "file_delete", map[string]string{"path": path, "recursive": c.DefaultQuery("recursive", "false")}, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to delete %s: %v", path, err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted successfully"})
+}
+
+// RenameFile moves path to newPath
+func (h *PodHandler) RenameFile(c *gin.Context) {
+	path, err := cleanFilePath(c.Query("path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	newPath, err := cleanFilePath(c.Query("newPath"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "newPath: " + err.Error()})
+		return
+	}
+	if path == "/" || newPath == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot rename /"})
+		return
+	}
+
+	err = h.execFileCommand(c, []string{"mv", "--", path, newPath})
+	h.recordFileOperation(c, "file_rename", map[string]string{"path": path, "newPath": newPath}, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to rename %s: %v", path, err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "renamed successfully"})
+}
+
+// CreateDirectory creates path, including missing parents
+func (h *PodHandler) CreateDirectory(c *gin.Context) {
+	path, err := cleanFilePath(c.Query("path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.execFileCommand(c, []string{"mkdir", "-p", "--", path})
+	h.recordFileOperation(c, "file_mkdir", map[string]string{"path": path}, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to create directory %s: %v", path, err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "directory created successfully"})
+}
+
+// ChmodFile changes the permission bits of path to an octal mode
+func (h *PodHandler) ChmodFile(c *gin.Context) {
+	path, err := cleanFilePath(c.Query("path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	mode := c.Query("mode")
+	if !fileModePattern.MatchString(mode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be an octal permission such as 644 or 0755"})
+		return
+	}
+
+	cmd := []string{"chmod", mode, "--", path}
+	if c.Query("recursive") == "true" {
+		cmd = []string{"chmod", "-R", mode, "--", path}
+	}
+	err = h.execFileCommand(c, cmd)
+	h.recordFileOperation(c, "file_chmod", map[string]string{"path": path, "mode": mode, "recursive": c.DefaultQuery("recursive", "false")}, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to chmod %s: %v", path, err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "permissions changed successfully"})
+}
+
+var fileModePattern = regexp.MustCompile(`^[0-7]{3,4}$`)
+
+// cleanFilePath validates a user supplied container path. Commands are always
+// executed with an argv (never through string interpolation) and paths are
+// passed after "--", so only absolute, cleaned paths are accepted here.
+// Symbolic link listings ("link -> target") are rejected rather than cut, the
+// cut path could name another file.
+func cleanFilePath(path string) (string, error) {
+	if strings.Contains(path, " -> ") {
+		return "", errors.New("path must not be a symbolic link listing (\"link -> target\")")
+	}
+	if path == "" {
+		return "", errors.New("path is required")
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", errors.New("path must be absolute")
+	}
+	if strings.ContainsRune(path, 0) {
+		return "", errors.New("path contains invalid characters")
+	}
+	return filepath.Clean(path), nil
+}
+
+func (h *PodHandler) execFileCommand(c *gin.Context, cmd []string) error {
+	cs := c.MustGet("cluster").(*cluster.ClientSet)
+	_, stderr, err := cs.K8sClient.ExecCommandBuffered(c.Request.Context(), c.Param("namespace"), c.Param("name"), c.Query("container"), cmd)
+	return execError(err, stderr)
+}
+
+// execError prefers the command's stderr over the generic exit status error
+func execError(err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return errors.New(msg)
+	}
+	return err
+}
+
+// recordFileOperation stores a file browser write operation in the audit log
+func (h *PodHandler) recordFileOperation(c *gin.Context, opType string, details map[string]string, opErr error) {
+	cs := c.MustGet("cluster").(*cluster.ClientSet)
+	user := c.MustGet("user").(model.User)
+
+	details["container"] = c.Query("container")
+	detailYAML, err := yaml.Marshal(details)
+	if err != nil {
+		klog.Errorf("Failed to marshal file operation details: %v", err)
+	}
+	history := model.ResourceHistory{
+		ClusterName:   cs.Name,
+		ResourceType:  h.name,
+		ResourceName:  c.Param("name"),
+		Namespace:     c.Param("namespace"),
+		OperationType: opType,
+		ResourceYAML:  string(detailYAML),
+		Success:       opErr == nil,
+		OperatorID:    user.ID,
+	}
+	if opErr != nil {
+		history.ErrorMessage = opErr.Error()
+	}
+	if err := model.DB.Create(&history).Error; err != nil {
+		klog.Errorf("Failed to create resource history: %v", err)
+	}
+}
+
 func writeSSE(c *gin.Context, event string, payload any) error {
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	c.Writer.Header().Set("Cache-Control", "no-cache, no-transform")
@@ -565,6 +775,9 @@ func (h *PodHandler) Watch(c *gin.Context) {
 		case <-c.Request.Context().Done():
 			_ = writeSSE(c, "close", gin.H{"message": "connection closed"})
 			return
+		case <-cs.Retired():
+			_ = writeSSE(c, "close", gin.H{"message": "cluster configuration changed"})
+			return
 		case <-ticker.C:
 			metricsMap, _ = h.ListMetrics(c)
 			for _, metrics := range metricsMap {
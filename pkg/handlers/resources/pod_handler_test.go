@@ -54,3 +54,66 @@ drwxr-xr-x    1 root     root        4.0K 2025-05-30 12:13:44 +0000 var
 		t.Errorf("expected 'var' gid to be 'root', got '%s'", varFile.GID)
 	}
 }
+
+func TestLsSymlinkParsing(t *testing.T) {
+	output := `lrwxrwxrwx    1 root     root          12 2025-10-02 12:23:51 +0000 sh -> /bin/busybox
+-rw-r--r--    1 root     root           3 2025-10-02 12:23:51 +0000 a -> b`
+	files := parseLsOutput(output)
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	// Only symbolic links are split, a regular file may be named "a -> b"
+	if files[0].Name != "a -> b" || files[0].LinkTarget != "" {
+		t.Errorf("expected regular file 'a -> b', got %+v", files[0])
+	}
+	if files[1].Name != "sh" || files[1].LinkTarget != "/bin/busybox" {
+		t.Errorf("expected link 'sh' to '/bin/busybox', got %+v", files[1])
+	}
+}
+
+func TestCleanFilePath(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "/etc/nginx/nginx.conf", want: "/etc/nginx/nginx.conf"},
+		{input: "/var/log/../tmp/", want: "/var/tmp"},
+		{input: "/usr/bin/sh -> /bin/busybox", wantErr: true},
+		{input: "/tmp/a->b", want: "/tmp/a->b"},
+		{input: "/", want: "/"},
+		{input: "", wantErr: true},
+		{input: "relative/path", wantErr: true},
+		{input: "-rf", wantErr: true},
+		{input: "/tmp/a\x00b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := cleanFilePath(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("cleanFilePath(%q) expected error, got %q", tt.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("cleanFilePath(%q) unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("cleanFilePath(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFileModePattern(t *testing.T) {
+	for _, mode := range []string{"644", "0755", "4755"} {
+		if !fileModePattern.MatchString(mode) {
+			t.Errorf("expected mode %q to be valid", mode)
+		}
+	}
+	for _, mode := range []string{"", "u+x", "999", "75", "07555", "644; rm -rf /"} {
+		if fileModePattern.MatchString(mode) {
+			t.Errorf("expected mode %q to be invalid", mode)
+		}
+	}
+}
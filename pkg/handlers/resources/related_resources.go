@@ -257,6 +257,50 @@ func discoverPodsByService(ctx context.Context, k8sClient *kube.K8sClient, servi
 	return relatedPods
 }
 
+// workloadPodTemplate returns the pod template and the pod selector of
+// workloads, for pods their spec and labels
+func workloadPodTemplate(resource interface{}) (*corev1.PodTemplateSpec, *metav1.LabelSelector) {
+	switch res := resource.(type) {
+	case *corev1.Pod:
+		podSpec := &corev1.PodTemplateSpec{
+			Spec: res.Spec,
+		}
+		// For pods, use the labels as selector
+		if res.Labels == nil {
+			return podSpec, nil
+		}
+		return podSpec, &metav1.LabelSelector{
+			MatchLabels: res.Labels,
+		}
+	case *appsv1.Deployment:
+		return &res.Spec.Template, res.Spec.Selector
+	case *appsv1.StatefulSet:
+		return &res.Spec.Template, res.Spec.Selector
+	case *appsv1.DaemonSet:
+		return &res.Spec.Template, res.Spec.Selector
+	}
+	return nil, nil
+}
+
+// WorkloadDependencies returns the Services selecting the pods of a workload
+// and the ConfigMaps, Secrets and PersistentVolumeClaims its pods use. It
+// returns nothing for other resources.
+func WorkloadDependencies(ctx context.Context, k8sClient *kube.K8sClient, resource interface{}) ([]common.RelatedResource, error) {
+	podSpec, selector := workloadPodTemplate(resource)
+	if podSpec == nil || selector == nil {
+		return nil, nil
+	}
+	obj, ok := resource.(client.Object)
+	if !ok {
+		return nil, nil
+	}
+	relatedServices, err := discoverServices(ctx, k8sClient, obj.GetNamespace(), selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover services: %w", err)
+	}
+	return append(relatedServices, discoverConfigs(obj.GetNamespace(), podSpec)...), nil
+}
+
 func GetRelatedResources(c *gin.Context) {
 	cs := c.MustGet("cluster").(*cluster.ClientSet)
 	namespace := c.Param("namespace")
@@ -269,30 +313,9 @@ func GetRelatedResources(c *gin.Context) {
 		return
 	}
 	ctx := c.Request.Context()
-	var podSpec *corev1.PodTemplateSpec
-	var selector *metav1.LabelSelector
 	result := make([]common.RelatedResource, 0)
 
 	switch res := resource.(type) {
-	case *corev1.Pod:
-		podSpec = &corev1.PodTemplateSpec{
-			Spec: res.Spec,
-		}
-		// For pods, use the labels as selector
-		if res.Labels != nil {
-			selector = &metav1.LabelSelector{
-				MatchLabels: res.Labels,
-			}
-		}
-	case *appsv1.Deployment:
-		podSpec = &res.Spec.Template
-		selector = res.Spec.Selector
-	case *appsv1.StatefulSet:
-		podSpec = &res.Spec.Template
-		selector = res.Spec.Selector
-	case *appsv1.DaemonSet:
-		podSpec = &res.Spec.Template
-		selector = res.Spec.Selector
 	case *corev1.Service:
 		relatedPods := discoverPodsByService(ctx, cs.K8sClient, res)
 		result = append(result, relatedPods...)
@@ -318,17 +341,12 @@ func GetRelatedResources(c *gin.Context) {
 		result = append(result, services...)
 	}
 
-	if podSpec != nil && selector != nil {
-		relatedServices, err := discoverServices(ctx, cs.K8sClient, namespace, selector)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discover services: " + err.Error()})
-			return
-		}
-		related := discoverConfigs(namespace, podSpec)
-
-		result = append(result, relatedServices...)
-		result = append(result, related...)
+	dependencies, err := WorkloadDependencies(ctx, cs.K8sClient, resource)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	result = append(result, dependencies...)
 
 	if v, ok := resource.(client.Object); ok {
 		for _, owner := range v.GetOwnerReferences() {
@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zxh326/kite/pkg/cluster"
@@ -14,6 +17,10 @@ import (
 	"k8s.io/klog/v2"
 )
 
+// allowedShells can be selected without being listed in a role's commands,
+// they grant nothing beyond the default shell
+var allowedShells = []string{"sh", "bash", "zsh", "ash"}
+
 type TerminalHandler struct {
 }
 
@@ -30,11 +37,32 @@ func (h *TerminalHandler) HandleTerminalWebSocket(c *gin.Context) {
 	namespace := c.Param("namespace")
 	podName := c.Param("podName")
 	container := c.Query("container")
+	mode := c.DefaultQuery("mode", "exec")
+	command := c.QueryArray("command")
+	shell := c.Query("shell")
 
 	if namespace == "" || podName == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "namespace and podName are required"})
 		return
 	}
+	if mode != "exec" && mode != "attach" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be exec or attach"})
+		return
+	}
+	if mode == "attach" && (len(command) > 0 || shell != "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "command and shell cannot be used in attach mode"})
+		return
+	}
+	if shell != "" {
+		if len(command) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "command and shell are mutually exclusive"})
+			return
+		}
+		if !slices.Contains(allowedShells, shell) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported shell %s", shell)})
+			return
+		}
+	}
 
 	user := c.MustGet("user").(model.User)
 
@@ -51,13 +79,55 @@ func (h *TerminalHandler) HandleTerminalWebSocket(c *gin.Context) {
 			)
 			return
 		}
+		if mode == "attach" && !rbac.CanAccess(user, "pods", string(common.VerbAttach), cs.Name, namespace) {
+			h.sendErrorMessage(
+				ws,
+				rbac.NoAccess(user.Key(), string(common.VerbAttach), "pods", namespace, cs.Name),
+			)
+			return
+		}
+		if len(command) > 0 {
+			if !rbac.CanExecCommand(user, cs.Name, namespace, command) {
+				h.sendErrorMessage(ws, fmt.Sprintf("user %s is not allowed to run command %s in namespace %s on cluster %s",
+					user.Key(), command[0], namespace, cs.Name))
+				return
+			}
+			session.SetCommand(command)
+		} else if shell != "" {
+			session.SetCommand([]string{shell})
+		}
 
-		if err := session.Start(ctx, "exec"); err != nil {
+		recording := startTerminalRecording(user, model.TerminalRecording{
+			ClusterName: cs.Name,
+			SessionType: model.TerminalSessionTypePod,
+			Namespace:   namespace,
+			PodName:     podName,
+			Container:   container,
+			Command:     terminalCommandString(mode, shell, command),
+		})
+		if recording != nil {
+			session.SetRecorder(recording.recorder)
+			defer recording.Finish()
+		}
+
+		if err := session.Start(ctx, mode); err != nil {
 			klog.Errorf("Terminal session error: %v", err)
 		}
 	}).ServeHTTP(c.Writer, c.Request)
 }
 
+func terminalCommandString(mode, shell string, command []string) string {
+	switch {
+	case mode == "attach":
+		return "attach"
+	case len(command) > 0:
+		return strings.Join(command, " ")
+	case shell != "":
+		return shell
+	}
+	return strings.Join(kube.DefaultShellCommand, " ")
+}
+
 // sendErrorMessage sends an error message through WebSocket
 func (h *TerminalHandler) sendErrorMessage(conn *websocket.Conn, message string) {
 	msg := map[string]interface{}{
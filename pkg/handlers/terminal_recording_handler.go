@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/kube"
+	"github.com/zxh326/kite/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// terminalRecording ties a SessionRecorder to its storage and DB record. With
+// DB storage the session is spooled to a temporary file and stored when it ends.
+type terminalRecording struct {
+	record   *model.TerminalRecording
+	recorder *kube.SessionRecorder
+	file     *os.File
+}
+
+// startTerminalRecording begins recording a terminal session, it returns nil
+// when recording is disabled or could not be started.
+func startTerminalRecording(user model.User, record model.TerminalRecording) *terminalRecording {
+	if !common.EnableTerminalRecording {
+		return nil
+	}
+	record.OperatorID = &user.ID
+	record.OperatorName = user.Key()
+	record.StartedAt = time.Now()
+	record.Storage = common.TerminalRecordingStorage
+
+	rec := &terminalRecording{record: &record}
+	if record.Storage == model.RecordingStorageFile {
+		dir := filepath.Join(common.TerminalRecordingDir, record.ClusterName, record.StartedAt.Format("2006-01-02"))
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			klog.Errorf("Failed to create terminal recording dir %s: %v", dir, err)
+			return nil
+		}
+		f, err := os.CreateTemp(dir, fmt.Sprintf("%s-%s-*.cast", record.SessionType, sanitizeFileName(record.PodName)))
+		if err != nil {
+			klog.Errorf("Failed to create terminal recording file: %v", err)
+			return nil
+		}
+		rec.file = f
+		record.FilePath = f.Name()
+	} else {
+		f, err := os.CreateTemp("", "kite-recording-*.cast")
+		if err != nil {
+			klog.Errorf("Failed to create terminal recording spool file: %v", err)
+			return nil
+		}
+		rec.file = f
+	}
+
+	title := fmt.Sprintf("%s %s/%s/%s", user.Key(), record.ClusterName, record.Namespace, record.PodName)
+	if record.SessionType == model.TerminalSessionTypeNode {
+		title = fmt.Sprintf("%s %s/node/%s", user.Key(), record.ClusterName, record.NodeName)
+	}
+	// The size is replaced by the client's terminal size when it reports one
+	rec.recorder = kube.NewSessionRecorder(rec.file, title, 80, 24, common.TerminalRecordingMaxSize)
+	if err := model.DB.Create(rec.record).Error; err != nil {
+		klog.Errorf("Failed to create terminal recording: %v", err)
+		rec.cleanup()
+		return nil
+	}
+	return rec
+}
+
+// Finish flushes the recording and stores its final state
+func (r *terminalRecording) Finish() {
+	if r == nil {
+		return
+	}
+	if err := r.recorder.Close(); err != nil {
+		klog.Errorf("Terminal recording %d write error: %v", r.record.ID, err)
+	}
+	now := time.Now()
+	updates := map[string]interface{}{
+		"ended_at":  &now,
+		"size":      r.recorder.Size(),
+		"truncated": r.recorder.Truncated(),
+	}
+	if r.record.Storage != model.RecordingStorageFile {
+		// The spool file is bounded by TERMINAL_RECORDING_MAX_SIZE
+		data, err := os.ReadFile(r.file.Name())
+		if err != nil {
+			klog.Errorf("Failed to read terminal recording spool file %s: %v", r.file.Name(), err)
+		}
+		updates["data"] = string(data)
+		defer r.cleanup()
+	} else if err := r.file.Close(); err != nil {
+		klog.Errorf("Failed to close terminal recording file %s: %v", r.file.Name(), err)
+	}
+	if err := model.DB.Model(r.record).Updates(updates).Error; err != nil {
+		klog.Errorf("Failed to save terminal recording %d: %v", r.record.ID, err)
+	}
+}
+
+func (r *terminalRecording) cleanup() {
+	_ = r.file.Close()
+	_ = os.Remove(r.file.Name())
+}
+
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// InitTerminalRecording starts the background retention cleanup
+func InitTerminalRecording() {
+	if !common.EnableTerminalRecording || common.TerminalRecordingRetentionDays <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for {
+			purgeExpiredTerminalRecordings()
+			<-ticker.C
+		}
+	}()
+}
+
+func purgeExpiredTerminalRecordings() {
+	before := time.Now().AddDate(0, 0, -common.TerminalRecordingRetentionDays)
+	recordings, err := model.ListExpiredTerminalRecordings(before)
+	if err != nil {
+		klog.Errorf("Failed to list expired terminal recordings: %v", err)
+		return
+	}
+	for i := range recordings {
+		if err := removeTerminalRecording(&recordings[i]); err != nil {
+			klog.Errorf("Failed to delete terminal recording %d: %v", recordings[i].ID, err)
+		}
+	}
+	if len(recordings) > 0 {
+		klog.Infof("Deleted %d expired terminal recordings", len(recordings))
+	}
+}
+
+func removeTerminalRecording(recording *model.TerminalRecording) error {
+	if recording.Storage == model.RecordingStorageFile && recording.FilePath != "" {
+		if err := os.Remove(recording.FilePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return model.DeleteTerminalRecording(recording)
+}
+
+func ListTerminalRecordings(c *gin.Context) {
+	page := 1
+	size := 20
+
+	if p := strings.TrimSpace(c.Query("page")); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page parameter"})
+			return
+		}
+	}
+	if s := strings.TrimSpace(c.Query("size")); s != "" {
+		if parsed, err := strconv.Atoi(s); err == nil && parsed > 0 {
+			size = parsed
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid size parameter"})
+			return
+		}
+	}
+
+	query := model.DB.Model(&model.TerminalRecording{})
+	if op := strings.TrimSpace(c.Query("operatorId")); op != "" {
+		operatorID, err := strconv.ParseUint(op, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid operatorId parameter"})
+			return
+		}
+		query = query.Where("operator_id = ?", operatorID)
+	}
+	if v := strings.TrimSpace(c.Query("cluster")); v != "" {
+		query = query.Where("cluster_name = ?", v)
+	}
+	if v := strings.TrimSpace(c.Query("sessionType")); v != "" {
+		query = query.Where("session_type = ?", v)
+	}
+	if v := strings.TrimSpace(c.Query("namespace")); v != "" {
+		query = query.Where("namespace = ?", v)
+	}
+	if v := strings.TrimSpace(c.Query("podName")); v != "" {
+		query = query.Where("pod_name LIKE ?", "%"+v+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordings := []model.TerminalRecording{}
+	if err := query.Omit("data").Preload("Operator").Order("started_at DESC").Offset((page - 1) * size).Limit(size).Find(&recordings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  recordings,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	})
+}
+
+func getTerminalRecording(c *gin.Context) (*model.TerminalRecording, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recording id"})
+		return nil, false
+	}
+	recording, err := model.GetTerminalRecordingByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "recording not found"})
+		return nil, false
+	}
+	return recording, true
+}
+
+func GetTerminalRecording(c *gin.Context) {
+	recording, ok := getTerminalRecording(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, recording)
+}
+
+// GetTerminalRecordingCast returns the asciicast content, used by the player
+// for replay or as a file download when download=true
+func GetTerminalRecordingCast(c *gin.Context) {
+	recording, ok := getTerminalRecording(c)
+	if !ok {
+		return
+	}
+	disposition := "inline"
+	if c.Query("download") == "true" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=\"recording-%d.cast\"", disposition, recording.ID))
+
+	if recording.Storage == model.RecordingStorageFile {
+		f, err := os.Open(recording.FilePath)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "recording file not found"})
+			return
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		c.DataFromReader(http.StatusOK, -1, "application/x-asciicast", f, nil)
+		return
+	}
+	c.Data(http.StatusOK, "application/x-asciicast", []byte(recording.Data))
+}
+
+func DeleteTerminalRecording(c *gin.Context) {
+	recording, ok := getTerminalRecording(c)
+	if !ok {
+		return
+	}
+	if err := removeTerminalRecording(recording); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "recording deleted"})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/zxh326/kite/pkg/common"
+	"github.com/zxh326/kite/pkg/model"
+	"gorm.io/gorm"
+)
+
+func TestTerminalRecordingLifecycle(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.ResourceHistory{}, &model.TerminalRecording{}); err != nil {
+		t.Fatal(err)
+	}
+	prevDB, prevEnabled, prevStorage := model.DB, common.EnableTerminalRecording, common.TerminalRecordingStorage
+	model.DB, common.EnableTerminalRecording, common.TerminalRecordingStorage = db, true, model.RecordingStorageDB
+	t.Cleanup(func() {
+		model.DB, common.EnableTerminalRecording, common.TerminalRecordingStorage = prevDB, prevEnabled, prevStorage
+	})
+
+	user := model.User{Username: "alice"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	rec := startTerminalRecording(user, model.TerminalRecording{ClusterName: "c1", SessionType: model.TerminalSessionTypePod, PodName: "web-0"})
+	if rec == nil {
+		t.Fatal("startTerminalRecording() = nil")
+	}
+	spool := rec.file.Name()
+	rec.recorder.Resize(132, 43)
+	rec.recorder.Output([]byte("$ "))
+	rec.Finish()
+
+	// DB recordings are spooled to a temporary file until the session ends
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("spool file %s was not removed: %v", filepath.Base(spool), err)
+	}
+	stored, err := model.GetTerminalRecordingByID(rec.record.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header struct{ Width, Height int }
+	if err := json.Unmarshal([]byte(strings.SplitN(stored.Data, "\n", 2)[0]), &header); err != nil || header.Width != 132 || header.Height != 43 {
+		t.Errorf("header of %q = %+v, %v, want the terminal size", stored.Data, header, err)
+	}
+	if stored.OperatorName != "alice" || stored.Size != int64(len(stored.Data)) {
+		t.Errorf("recording = %+v", stored)
+	}
+
+	// Recordings are kept when their operator is deleted
+	if err := model.DeleteUserByID(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = model.GetTerminalRecordingByID(rec.record.ID)
+	if err != nil {
+		t.Fatalf("recording deleted with its operator: %v", err)
+	}
+	if stored.OperatorID != nil || stored.OperatorName != "alice" {
+		t.Errorf("recording of a deleted user = %+v, want no operator id and the operator name", stored)
+	}
+}
@@ -0,0 +1,217 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/zxh326/kite/pkg/common"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// StrippedAnnotationsAnnotation lists the annotations the cache transform
+// removed from an object, such objects are read live by Get
+const StrippedAnnotationsAnnotation = "kite.io/stripped-annotations"
+
+// CacheScope limits what the informer cache of a cluster holds. Everything
+// outside the scope is read from the API server.
+type CacheScope struct {
+	// Namespaces limits the cache to these namespaces, empty caches all namespaces
+	Namespaces []string
+	// Uncached lists resources that are always read live, e.g. "secrets" or
+	// "deployments.apps"
+	Uncached []string
+	// StripManagedFields removes managedFields and the last applied
+	// configuration from cached objects
+	StripManagedFields bool
+	// MaxAnnotationSize removes annotations with longer values from cached objects, 0 keeps them
+	MaxAnnotationSize int
+}
+
+// Equal reports whether both scopes result in the same cache
+func (s *CacheScope) Equal(o *CacheScope) bool {
+	if s == nil || o == nil {
+		return s.IsZero() && o.IsZero()
+	}
+	return slices.Equal(s.Namespaces, o.Namespaces) && slices.Equal(s.Uncached, o.Uncached) &&
+		s.StripManagedFields == o.StripManagedFields && s.MaxAnnotationSize == o.MaxAnnotationSize
+}
+
+// IsZero reports whether the scope caches everything unchanged
+func (s *CacheScope) IsZero() bool {
+	return s == nil || (len(s.Namespaces) == 0 && len(s.Uncached) == 0 && !s.StripManagedFields && s.MaxAnnotationSize == 0)
+}
+
+// uncachedObjects returns the objects of the Uncached resources
+func (s *CacheScope) uncachedObjects() ([]client.Object, error) {
+	if s == nil {
+		return nil, nil
+	}
+	var objects []client.Object
+	for _, resource := range s.Uncached {
+		objs, err := objectsForResource(resource)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, objs...)
+	}
+	return objects, nil
+}
+
+// ValidateCacheScope checks that the uncached resources are known types
+func ValidateCacheScope(s *CacheScope) error {
+	_, err := s.uncachedObjects()
+	return err
+}
+
+// objectsForResource returns a typed object for every version of a resource
+// such as "configmaps" or "deployments.apps"
+func objectsForResource(resource string) ([]client.Object, error) {
+	gr := schema.ParseGroupResource(strings.ToLower(resource))
+	var objects []client.Object
+	for gvk := range runtimeScheme.AllKnownTypes() {
+		if gvk.Group != gr.Group || gvk.Version == runtime.APIVersionInternal || strings.HasSuffix(gvk.Kind, "List") {
+			continue
+		}
+		if plural, _ := meta.UnsafeGuessKindToResource(gvk); plural.Resource != gr.Resource {
+			continue
+		}
+		obj, err := runtimeScheme.New(gvk)
+		if err != nil {
+			return nil, err
+		}
+		if cobj, ok := obj.(client.Object); ok {
+			objects = append(objects, cobj)
+		}
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("unknown resource %q", resource)
+	}
+	return objects, nil
+}
+
+// cacheOptions applies the scope to the cache options of the manager
+func (s *CacheScope) cacheOptions(opts *cache.Options) {
+	if s == nil {
+		return
+	}
+	if len(s.Namespaces) > 0 {
+		opts.DefaultNamespaces = make(map[string]cache.Config, len(s.Namespaces))
+		for _, ns := range s.Namespaces {
+			opts.DefaultNamespaces[ns] = cache.Config{}
+		}
+	}
+	if s.StripManagedFields || s.MaxAnnotationSize > 0 {
+		opts.DefaultTransform = s.transform
+	}
+}
+
+// transform strips managedFields and large annotations before objects are
+// stored in the cache
+func (s *CacheScope) transform(obj any) (any, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		// e.g. DeletedFinalStateUnknown tombstones
+		return obj, nil
+	}
+	if s.StripManagedFields {
+		accessor.SetManagedFields(nil)
+	}
+	annotations := accessor.GetAnnotations()
+	if len(annotations) == 0 {
+		return obj, nil
+	}
+	var stripped []string
+	for k, v := range annotations {
+		if s.StripManagedFields && k == common.KubectlAnnotation {
+			// Hidden by the API anyway, no need to read the object live
+			delete(annotations, k)
+			continue
+		}
+		if s.MaxAnnotationSize > 0 && len(v) > s.MaxAnnotationSize {
+			stripped = append(stripped, k)
+			delete(annotations, k)
+		}
+	}
+	if len(stripped) > 0 {
+		sort.Strings(stripped)
+		annotations[StrippedAnnotationsAnnotation] = strings.Join(stripped, ",")
+	}
+	accessor.SetAnnotations(annotations)
+	return obj, nil
+}
+
+// scopedClient reads from the cache inside the cache scope and from the
+// API server outside of it
+type scopedClient struct {
+	client.Client
+	live       client.Reader
+	namespaces map[string]bool
+}
+
+func newScopedClient(c client.Client, live client.Reader, scope *CacheScope) client.Client {
+	if scope.IsZero() {
+		return c
+	}
+	sc := &scopedClient{Client: c, live: live}
+	if len(scope.Namespaces) > 0 {
+		sc.namespaces = make(map[string]bool, len(scope.Namespaces))
+		for _, ns := range scope.Namespaces {
+			sc.namespaces[ns] = true
+		}
+	}
+	return sc
+}
+
+func (c *scopedClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if !c.cached(obj, key.Namespace) {
+		return c.live.Get(ctx, key, obj, opts...)
+	}
+	cached := obj.DeepCopyObject().(client.Object)
+	if err := c.Client.Get(ctx, key, cached, opts...); err != nil {
+		return err
+	}
+	if _, ok := cached.GetAnnotations()[StrippedAnnotationsAnnotation]; ok {
+		return c.live.Get(ctx, key, obj, opts...)
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(cached).Elem())
+	return nil
+}
+
+func (c *scopedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if !c.cached(list, listOpts.Namespace) {
+		return c.live.List(ctx, list, opts...)
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+// cached reports whether a read of obj in namespace ns is served by the cache
+func (c *scopedClient) cached(obj runtime.Object, ns string) bool {
+	if c.namespaces == nil {
+		return true
+	}
+	if ns != "" {
+		return c.namespaces[ns]
+	}
+	// All namespaces, only cluster scoped types are complete in the cache.
+	// Unknown types are read live, which is always correct.
+	gvk, err := c.GroupVersionKindFor(obj)
+	if err != nil {
+		return false
+	}
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	mapping, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return false
+	}
+	return mapping.Scope.Name() != meta.RESTScopeNameNamespace
+}
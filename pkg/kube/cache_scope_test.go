@@ -0,0 +1,115 @@
+package kube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCacheScopeTransform(t *testing.T) {
+	scope := &CacheScope{StripManagedFields: true, MaxAnnotationSize: 10}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:          "p",
+		ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+		Annotations: map[string]string{
+			"small": "ok",
+			"large": strings.Repeat("x", 11),
+			"kubectl.kubernetes.io/last-applied-configuration": "{}",
+		},
+	}}
+	out, err := scope.transform(pod)
+	require.NoError(t, err)
+	p := out.(*corev1.Pod)
+	assert.Nil(t, p.ManagedFields)
+	assert.Equal(t, map[string]string{"small": "ok", StrippedAnnotationsAnnotation: "large"}, p.Annotations)
+
+	// Objects without metadata pass through
+	out, err = scope.transform("tombstone")
+	require.NoError(t, err)
+	assert.Equal(t, "tombstone", out)
+}
+
+func TestObjectsForResource(t *testing.T) {
+	objs, err := objectsForResource("configmaps")
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+	assert.IsType(t, &corev1.ConfigMap{}, objs[0])
+
+	objs, err = objectsForResource("horizontalpodautoscalers.autoscaling")
+	require.NoError(t, err)
+	assert.Greater(t, len(objs), 1, "every served version is uncached")
+
+	_, err = objectsForResource("deployments")
+	assert.EqualError(t, err, `unknown resource "deployments"`, "deployments are in the apps group")
+	assert.NoError(t, ValidateCacheScope(&CacheScope{Uncached: []string{"Deployments.apps"}}))
+
+	// Secrets are only read live when the scope asks for it
+	objs, err = (*CacheScope)(nil).uncachedObjects()
+	require.NoError(t, err)
+	assert.Empty(t, objs)
+	objs, err = (&CacheScope{Uncached: []string{"secrets"}}).uncachedObjects()
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+	assert.IsType(t, &corev1.Secret{}, objs[0])
+}
+
+func TestCacheScopeEqual(t *testing.T) {
+	var none *CacheScope
+	assert.True(t, none.Equal(&CacheScope{}))
+	assert.True(t, (&CacheScope{Namespaces: []string{"a"}}).Equal(&CacheScope{Namespaces: []string{"a"}}))
+	assert.False(t, none.Equal(&CacheScope{StripManagedFields: true}))
+	assert.False(t, (&CacheScope{Uncached: []string{"configmaps"}}).Equal(&CacheScope{}))
+}
+
+func testPod(ns, name, source string, annotations map[string]string) *corev1.Pod {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations["source"] = source
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name, Annotations: annotations}}
+}
+
+func TestScopedClient(t *testing.T) {
+	mapper := testrestmapper.TestOnlyStaticRESTMapper(runtimeScheme)
+	cached := fake.NewClientBuilder().WithScheme(runtimeScheme).WithRESTMapper(mapper).WithObjects(
+		testPod("a", "p", "cache", nil),
+		testPod("a", "big", "cache", map[string]string{StrippedAnnotationsAnnotation: "large"}),
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n", Annotations: map[string]string{"source": "cache"}}},
+	).Build()
+	live := fake.NewClientBuilder().WithScheme(runtimeScheme).WithObjects(
+		testPod("a", "p", "live", nil),
+		testPod("a", "big", "live", map[string]string{"large": "value"}),
+		testPod("b", "p", "live", nil),
+	).Build()
+	c := newScopedClient(cached, live, &CacheScope{Namespaces: []string{"a"}})
+	ctx := context.Background()
+
+	get := func(obj client.Object, ns, name string) string {
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: ns, Name: name}, obj))
+		return obj.GetAnnotations()["source"]
+	}
+	assert.Equal(t, "cache", get(&corev1.Pod{}, "a", "p"))
+	assert.Equal(t, "live", get(&corev1.Pod{}, "b", "p"), "namespaces outside the scope are read live")
+	assert.Equal(t, "cache", get(&corev1.Node{}, "", "n"), "cluster scoped objects are cached")
+
+	big := &corev1.Pod{}
+	assert.Equal(t, "live", get(big, "a", "big"), "objects with stripped annotations are read live")
+	assert.Equal(t, "value", big.Annotations["large"])
+
+	var pods corev1.PodList
+	require.NoError(t, c.List(ctx, &pods))
+	assert.Len(t, pods.Items, 3, "lists across namespaces are read live")
+	require.NoError(t, c.List(ctx, &pods, client.InNamespace("a")))
+	assert.Len(t, pods.Items, 2)
+	assert.Equal(t, "cache", pods.Items[0].Annotations["source"])
+
+	assert.Same(t, cached, newScopedClient(cached, live, nil), "an empty scope uses the cache directly")
+}
@@ -14,7 +14,6 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
-	toolscache "k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 
@@ -43,12 +42,28 @@ type K8sClient struct {
 	ClientSet     *kubernetes.Clientset
 	Configuration *rest.Config
 	MetricsClient *metricsclient.Clientset
+	// ExecProtocol selects the streaming protocol for exec and attach, see ExecProtocolAuto
+	ExecProtocol string
+	// Cache is the informer cache backing Client, nil when DISABLE_CACHE is set
+	Cache cache.Cache
 
-	cancel context.CancelFunc
+	cancel      context.CancelFunc
+	watchErrors *watchErrors
 }
 
 // NewClient creates a K8sClient from a rest.Config
 func NewClient(config *rest.Config) (*K8sClient, error) {
+	return NewClientWithCacheScope(config, nil)
+}
+
+// NewClientWithCacheScope creates a K8sClient whose informer cache is limited
+// to scope, a nil scope caches everything
+func NewClientWithCacheScope(config *rest.Config, scope *CacheScope) (*K8sClient, error) {
+	uncached, err := scope.uncachedObjects()
+	if err != nil {
+		return nil, err
+	}
+
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, err
@@ -62,6 +77,8 @@ func NewClient(config *rest.Config) (*K8sClient, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	var c client.Client
+	var informerCache cache.Cache
+	watchErrs := &watchErrors{}
 	if os.Getenv("DISABLE_CACHE") == "true" {
 		c, err = client.New(config, client.Options{
 			Scheme: runtimeScheme,
@@ -71,15 +88,19 @@ func NewClient(config *rest.Config) (*K8sClient, error) {
 			return nil, fmt.Errorf("failed to create client: %w", err)
 		}
 	} else {
+		cacheOpts := cache.Options{
+			DefaultWatchErrorHandler: watchErrs.handle,
+		}
+		scope.cacheOptions(&cacheOpts)
 		mgr, err := manager.New(config, manager.Options{
 			Scheme:         runtimeScheme,
 			LeaderElection: false,
 			Metrics: metricsserver.Options{
 				BindAddress: "0", // Disable metrics server
 			},
-			Cache: cache.Options{
-				DefaultWatchErrorHandler: func(ctx context.Context, r *toolscache.Reflector, err error) {
-				},
+			Cache: cacheOpts,
+			Client: client.Options{
+				Cache: &client.CacheOptions{DisableFor: uncached},
 			},
 		})
 		if err != nil {
@@ -107,7 +128,8 @@ func NewClient(config *rest.Config) (*K8sClient, error) {
 			cancel()
 			return nil, fmt.Errorf("failed to wait for cache sync")
 		}
-		c = mgr.GetClient()
+		c = newScopedClient(mgr.GetClient(), mgr.GetAPIReader(), scope)
+		informerCache = mgr.GetCache()
 	}
 
 	return &K8sClient{
@@ -115,13 +137,27 @@ func NewClient(config *rest.Config) (*K8sClient, error) {
 		ClientSet:     clientset,
 		Configuration: config,
 		MetricsClient: metricsClient,
+		Cache:         informerCache,
 		cancel:        cancel,
+		watchErrors:   watchErrs,
 	}, nil
 }
 
+// CacheErrors returns the watches of the informer cache that failed in the
+// last minutes as "<type>: <error>", the cache may serve stale objects of
+// those types. It is empty when the cache is in sync or disabled.
+func (c *K8sClient) CacheErrors() []string {
+	if c.Cache == nil || c.watchErrors == nil {
+		return nil
+	}
+	return c.watchErrors.recent(time.Now())
+}
+
 func (c *K8sClient) Stop(name string) {
 	klog.Infof("Stopping K8s client for %s", name)
-	c.cancel()
+	if c.cancel != nil {
+		c.cancel()
+	}
 }
 
 // GetScheme returns the runtime scheme used by the client
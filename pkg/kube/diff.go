@@ -0,0 +1,232 @@
+package kube
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/zxh326/kite/pkg/common"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// volatileAnnotations are written by controllers and clients, they differ
+// between copies of the same resource
+var volatileAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"kubectl.kubernetes.io/restartedAt",
+	"deployment.kubernetes.io/revision",
+	"deprecated.daemonset.template.generation",
+	StrippedAnnotationsAnnotation,
+}
+
+// generatedLabels hold hashes generated by workload controllers
+var generatedLabels = []string{
+	"pod-template-hash",
+	"controller-revision-hash",
+	"pod-template-generation",
+}
+
+// SanitizeObject removes the fields set by the API server and controllers, so
+// the object can be compared with or created as a copy of another object
+func SanitizeObject(obj map[string]interface{}) {
+	delete(obj, "status")
+	for _, field := range []string{"uid", "resourceVersion", "managedFields", "creationTimestamp",
+		"deletionTimestamp", "deletionGracePeriodSeconds", "generation", "selfLink", "ownerReferences", "generateName"} {
+		unstructured.RemoveNestedField(obj, "metadata", field)
+	}
+	u := unstructured.Unstructured{Object: obj}
+	if annotations := u.GetAnnotations(); annotations != nil {
+		for _, key := range volatileAnnotations {
+			delete(annotations, key)
+		}
+		setOrRemove(obj, annotations, "metadata", "annotations")
+	}
+	// Allocated by the API server
+	if u.GetKind() == "Service" {
+		unstructured.RemoveNestedField(obj, "spec", "clusterIP")
+		unstructured.RemoveNestedField(obj, "spec", "clusterIPs")
+	}
+	unstructured.RemoveNestedField(obj, "spec", "template", "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(obj, "spec", "jobTemplate", "metadata", "creationTimestamp")
+}
+
+// NormalizeForDiff sanitizes obj and also removes the namespace, generated
+// hash labels and the values of Secrets, which are replaced by their hash
+func NormalizeForDiff(obj map[string]interface{}) {
+	SanitizeObject(obj)
+	unstructured.RemoveNestedField(obj, "metadata", "namespace")
+	for _, path := range [][]string{
+		{"metadata", "labels"},
+		{"spec", "selector", "matchLabels"},
+		{"spec", "template", "metadata", "labels"},
+	} {
+		labels, found, _ := unstructured.NestedStringMap(obj, path...)
+		if !found {
+			continue
+		}
+		for _, key := range generatedLabels {
+			delete(labels, key)
+		}
+		setOrRemove(obj, labels, path...)
+	}
+	if kind, _, _ := unstructured.NestedString(obj, "kind"); kind == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			values, found, _ := unstructured.NestedMap(obj, field)
+			if !found {
+				continue
+			}
+			for key, value := range values {
+				sum := sha256.Sum256([]byte(fmt.Sprint(value)))
+				values[key] = "sha256:" + hex.EncodeToString(sum[:8])
+			}
+			_ = unstructured.SetNestedMap(obj, values, field)
+		}
+	}
+}
+
+func setOrRemove(obj map[string]interface{}, values map[string]string, path ...string) {
+	if len(values) == 0 {
+		unstructured.RemoveNestedField(obj, path...)
+		return
+	}
+	_ = unstructured.SetNestedStringMap(obj, values, path...)
+}
+
+// DiffObjects compares two normalized objects, it returns the changed fields
+// and a unified diff of their YAML
+func DiffObjects(left, right map[string]interface{}, leftName, rightName string) ([]common.ResourceDiffChange, string, error) {
+	changes := []common.ResourceDiffChange{}
+	diffValues("", left, right, &changes)
+
+	leftYAML, err := yaml.Marshal(left)
+	if err != nil {
+		return nil, "", err
+	}
+	rightYAML, err := yaml.Marshal(right)
+	if err != nil {
+		return nil, "", err
+	}
+	unified, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(leftYAML)),
+		B:        difflib.SplitLines(string(rightYAML)),
+		FromFile: leftName,
+		ToFile:   rightName,
+		Context:  3,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return changes, unified, nil
+}
+
+func diffValues(path string, left, right interface{}, changes *[]common.ResourceDiffChange) {
+	switch {
+	case left == nil && right == nil:
+		return
+	case left == nil:
+		*changes = append(*changes, common.ResourceDiffChange{Path: path, Type: common.DiffAdded, Right: right})
+		return
+	case right == nil:
+		*changes = append(*changes, common.ResourceDiffChange{Path: path, Type: common.DiffRemoved, Left: left})
+		return
+	}
+	switch l := left.(type) {
+	case map[string]interface{}:
+		r, ok := right.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := map[string]bool{}
+		for k := range l {
+			keys[k] = true
+		}
+		for k := range r {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffValues(joinPath(path, k), l[k], r[k], changes)
+		}
+		return
+	case []interface{}:
+		r, ok := right.([]interface{})
+		if !ok {
+			break
+		}
+		diffLists(path, l, r, changes)
+		return
+	}
+	if !reflect.DeepEqual(left, right) {
+		*changes = append(*changes, common.ResourceDiffChange{Path: path, Type: common.DiffChanged, Left: left, Right: right})
+	}
+}
+
+// diffLists matches list items by name when every item has one, e.g.
+// containers and env vars, and by index otherwise
+func diffLists(path string, left, right []interface{}, changes *[]common.ResourceDiffChange) {
+	leftNames, lok := itemNames(left)
+	rightNames, rok := itemNames(right)
+	if !lok || !rok {
+		for i := 0; i < len(left) || i < len(right); i++ {
+			var l, r interface{}
+			if i < len(left) {
+				l = left[i]
+			}
+			if i < len(right) {
+				r = right[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), l, r, changes)
+		}
+		return
+	}
+	byName := make(map[string]interface{}, len(right))
+	for i, name := range rightNames {
+		byName[name] = right[i]
+	}
+	for i, name := range leftNames {
+		diffValues(fmt.Sprintf("%s[name=%s]", path, name), left[i], byName[name], changes)
+		delete(byName, name)
+	}
+	for i, name := range rightNames {
+		if _, added := byName[name]; added {
+			diffValues(fmt.Sprintf("%s[name=%s]", path, name), nil, right[i], changes)
+		}
+	}
+}
+
+func itemNames(items []interface{}) ([]string, bool) {
+	names := make([]string, 0, len(items))
+	seen := map[string]bool{}
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok || seen[name] {
+			return nil, false
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, true
+}
+
+func joinPath(path, key string) string {
+	if strings.ContainsAny(key, "./[]") {
+		return path + "[" + key + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,97 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zxh326/kite/pkg/common"
+)
+
+func deploymentObject(namespace, image string) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":              "web",
+			"namespace":         namespace,
+			"uid":               namespace + "-uid",
+			"resourceVersion":   "42",
+			"generation":        int64(3),
+			"creationTimestamp": "2024-01-01T00:00:00Z",
+			"managedFields":     []interface{}{map[string]interface{}{"manager": "kubectl"}},
+			"labels":            map[string]interface{}{"app": "web", "pod-template-hash": namespace},
+			"annotations": map[string]interface{}{
+				"deployment.kubernetes.io/revision": "7",
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"creationTimestamp": nil,
+					"labels":            map[string]interface{}{"app": "web"},
+				},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "sidecar", "image": "proxy:1"},
+						map[string]interface{}{"name": "web", "image": image},
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{"readyReplicas": int64(2)},
+	}
+}
+
+func TestNormalizeForDiff(t *testing.T) {
+	obj := deploymentObject("prod", "web:1")
+	NormalizeForDiff(obj)
+
+	metadata := obj["metadata"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"name":   "web",
+		"labels": map[string]interface{}{"app": "web"},
+	}, metadata)
+	assert.NotContains(t, obj, "status")
+	template := obj["spec"].(map[string]interface{})["template"].(map[string]interface{})
+	assert.NotContains(t, template["metadata"], "creationTimestamp")
+
+	secret := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "db"},
+		"data":       map[string]interface{}{"password": "c2VjcmV0"},
+	}
+	NormalizeForDiff(secret)
+	value := secret["data"].(map[string]interface{})["password"].(string)
+	assert.Regexp(t, "^sha256:[0-9a-f]{16}$", value)
+}
+
+func TestDiffObjects(t *testing.T) {
+	left, right := deploymentObject("prod", "web:1"), deploymentObject("staging", "web:1")
+	NormalizeForDiff(left)
+	NormalizeForDiff(right)
+	changes, unified, err := DiffObjects(left, right, "a", "b")
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Empty(t, unified)
+
+	right = deploymentObject("staging", "web:2")
+	// Containers are matched by name, not by index
+	containers := right["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	items := containers["containers"].([]interface{})
+	containers["containers"] = []interface{}{items[1], items[0], map[string]interface{}{"name": "debug", "image": "busybox"}}
+	right["metadata"].(map[string]interface{})["annotations"] = map[string]interface{}{"team": "shop"}
+	NormalizeForDiff(right)
+
+	changes, unified, err = DiffObjects(left, right, "prod/web", "staging/web")
+	require.NoError(t, err)
+	assert.Equal(t, []common.ResourceDiffChange{
+		{Path: "metadata.annotations", Type: common.DiffAdded, Right: map[string]interface{}{"team": "shop"}},
+		{Path: "spec.template.spec.containers[name=web].image", Type: common.DiffChanged, Left: "web:1", Right: "web:2"},
+		{Path: "spec.template.spec.containers[name=debug]", Type: common.DiffAdded, Right: map[string]interface{}{"name": "debug", "image": "busybox"}},
+	}, changes)
+	assert.Contains(t, unified, "--- prod/web\n+++ staging/web\n")
+	assert.Contains(t, unified, "+      - image: busybox\n")
+}
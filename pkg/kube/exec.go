@@ -5,12 +5,53 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/remotecommand"
 )
 
+const (
+	// ExecProtocolAuto uses the WebSocket executor and falls back to SPDY
+	// when the API server (or a proxy in front of it) does not support it
+	ExecProtocolAuto      = "auto"
+	ExecProtocolWebSocket = "websocket"
+	ExecProtocolSPDY      = "spdy"
+)
+
+// IsValidExecProtocol reports whether protocol is a supported exec protocol, empty means auto
+func IsValidExecProtocol(protocol string) bool {
+	switch protocol {
+	case "", ExecProtocolAuto, ExecProtocolWebSocket, ExecProtocolSPDY:
+		return true
+	}
+	return false
+}
+
+// NewExecutor creates a remotecommand executor for an exec or attach request
+// according to the client's ExecProtocol
+func (c *K8sClient) NewExecutor(u *url.URL) (remotecommand.Executor, error) {
+	if c.ExecProtocol == ExecProtocolSPDY {
+		return remotecommand.NewSPDYExecutor(c.Configuration, "POST", u)
+	}
+	websocketExec, err := remotecommand.NewWebSocketExecutor(c.Configuration, "GET", u.String())
+	if err != nil {
+		return nil, err
+	}
+	if c.ExecProtocol == ExecProtocolWebSocket {
+		return websocketExec, nil
+	}
+	spdyExec, err := remotecommand.NewSPDYExecutor(c.Configuration, "POST", u)
+	if err != nil {
+		return nil, err
+	}
+	return remotecommand.NewFallbackExecutor(websocketExec, spdyExec, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+}
+
 // ExecOptions holds parameters for ExecCommand
 type ExecOptions struct {
 	Namespace     string
@@ -40,7 +81,7 @@ func (c *K8sClient) ExecCommand(ctx context.Context, opts ExecOptions) error {
 		TTY:       opts.TTY,
 	}, scheme.ParameterCodec)
 
-	exec, err := remotecommand.NewSPDYExecutor(c.Configuration, "POST", req.URL())
+	exec, err := c.NewExecutor(req.URL())
 	if err != nil {
 		return fmt.Errorf("failed to create executor: %w", err)
 	}
@@ -0,0 +1,70 @@
+package kube
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+func TestNewExecutor(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		// dropWebSocket closes WebSocket connections instead of rejecting
+		// the upgrade, which is not an upgrade failure
+		dropWebSocket bool
+		want          []string
+	}{
+		{name: "auto falls back to spdy", protocol: ExecProtocolAuto, want: []string{"GET", "POST"}},
+		{name: "empty means auto", protocol: "", want: []string{"GET", "POST"}},
+		{name: "no fallback on other errors", protocol: ExecProtocolAuto, dropWebSocket: true, want: []string{"GET"}},
+		{name: "websocket only", protocol: ExecProtocolWebSocket, want: []string{"GET"}},
+		{name: "spdy only", protocol: ExecProtocolSPDY, want: []string{"POST"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var methods []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				methods = append(methods, r.Method)
+				mu.Unlock()
+				if tc.dropWebSocket && r.Method == http.MethodGet {
+					conn, _, err := w.(http.Hijacker).Hijack()
+					if err == nil {
+						_ = conn.Close()
+					}
+					return
+				}
+				// Neither protocol is supported, so every upgrade fails
+				http.Error(w, "upgrade not supported", http.StatusBadRequest)
+			}))
+			defer server.Close()
+
+			c := &K8sClient{Configuration: &rest.Config{Host: server.URL}, ExecProtocol: tc.protocol}
+			u, _ := url.Parse(server.URL + "/api/v1/namespaces/default/pods/web/exec?command=sh&stdout=true")
+			exec, err := c.NewExecutor(u)
+			if err != nil {
+				t.Fatalf("NewExecutor() error = %v", err)
+			}
+			if err := exec.StreamWithContext(context.Background(), remotecommand.StreamOptions{Stdout: io.Discard}); err == nil {
+				t.Fatal("StreamWithContext() succeeded, want an error")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(methods, tc.want) {
+				t.Errorf("requests = %v, want %v", methods, tc.want)
+			}
+		})
+	}
+}
@@ -1,45 +1,146 @@
 package kube
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/websocket"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 )
 
 type PodLogStream struct {
-	Pod    corev1.Pod
-	Cancel context.CancelFunc
-	Done   chan struct{}
+	Pod       corev1.Pod
+	Container string // empty uses the container from the handler's log options
+	Cancel    context.CancelFunc
+	Done      chan struct{}
+
+	buf     *logBuffer
+	removed atomic.Bool
+}
+
+// LogContainerSelector selects the containers streamed for each pod. When set
+// every container gets its own stream and lines are prefixed with [pod/container].
+type LogContainerSelector struct {
+	// Containers to stream, empty means all regular containers
+	Containers            []string
+	IncludeInitContainers bool
+}
+
+func (s *LogContainerSelector) containerNames(pod corev1.Pod) []string {
+	selected := func(name string) bool {
+		return len(s.Containers) == 0 || slices.Contains(s.Containers, name)
+	}
+	var names []string
+	if s.IncludeInitContainers {
+		for _, c := range pod.Spec.InitContainers {
+			if selected(c.Name) {
+				names = append(names, c.Name)
+			}
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		if selected(c.Name) {
+			names = append(names, c.Name)
+		}
+	}
+	return names
 }
 
+// BatchLogHandler multiplexes the logs of several pods onto one WebSocket.
+// Every stream is read by its own goroutine into a bounded buffer, a single
+// writer goroutine drains the buffers in turn and owns the connection.
 type BatchLogHandler struct {
 	conn      *websocket.Conn
-	pods      map[string]*PodLogStream // key: namespace/name
-	k8sClient *K8sClient
+	clientset kubernetes.Interface
 	opts      *corev1.PodLogOptions
 	ctx       context.Context
 	cancel    context.CancelFunc
+	filter    atomic.Pointer[LogFilter]
+
+	mu      sync.Mutex
+	pods    map[string]*PodLogStream // key: namespace/name or namespace/name/container
+	buffers []*logBuffer             // buffers still drained by the writer
+	limited bool                     // the stream limit was reported to the client
+
+	control    chan LogsMessage
+	notify     chan struct{}
+	writerDone chan struct{}
+	failure    atomic.Pointer[string]
+
+	maxStreams   int
+	bufferSize   int
+	overflow     LogOverflowPolicy
+	writeTimeout time.Duration
+
+	containers *LogContainerSelector
+	parseJSON  bool
+
+	// resume holds the timestamp of the last line the client received per
+	// stream before reconnecting, keyed by pod/container
+	resume           map[string]time.Time
+	backfillPrevious bool
+
+	// cursors are the timestamps of the last lines written per stream, they
+	// are owned by the writer goroutine
+	cursors        map[string]time.Time
+	cursorsChanged bool
 }
 
 func NewBatchLogHandler(conn *websocket.Conn, client *K8sClient, opts *corev1.PodLogOptions) *BatchLogHandler {
+	return newBatchLogHandler(conn, client.ClientSet, opts)
+}
+
+func newBatchLogHandler(conn *websocket.Conn, clientset kubernetes.Interface, opts *corev1.PodLogOptions) *BatchLogHandler {
 	ctx, cancel := context.WithCancel(context.Background())
 	l := &BatchLogHandler{
-		conn:      conn,
-		pods:      make(map[string]*PodLogStream),
-		k8sClient: client,
-		opts:      opts,
-		ctx:       ctx,
-		cancel:    cancel,
+		conn:       conn,
+		clientset:  clientset,
+		pods:       make(map[string]*PodLogStream),
+		opts:       opts,
+		ctx:        ctx,
+		cancel:     cancel,
+		control:    make(chan LogsMessage, 64),
+		notify:     make(chan struct{}, 1),
+		writerDone: make(chan struct{}),
+		cursors:    make(map[string]time.Time),
+		maxStreams: DefaultLogMaxStreams,
+		bufferSize: DefaultLogBufferSize,
+		overflow:   LogOverflowBlock,
+
+		writeTimeout: DefaultLogWriteTimeout,
 	}
+	go l.writeLoop()
 	return l
 }
 
+// SetLimits configures the maximum number of concurrent streams, the number of
+// lines buffered per stream and what happens when a buffer is full. It must be
+// called before pods are added, zero values keep the defaults.
+func (l *BatchLogHandler) SetLimits(maxStreams, bufferSize int, overflow LogOverflowPolicy) {
+	if maxStreams > 0 {
+		l.maxStreams = maxStreams
+	}
+	if bufferSize > 0 {
+		l.bufferSize = bufferSize
+	}
+	if overflow != "" {
+		l.overflow = overflow
+	}
+}
+
 func (l *BatchLogHandler) StreamLogs(ctx context.Context) {
 	// Start heartbeat handler
 	go l.heartbeat(ctx)
@@ -55,50 +156,194 @@ func (l *BatchLogHandler) StreamLogs(ctx context.Context) {
 	l.Stop()
 }
 
-func (l *BatchLogHandler) startPodLogStream(podStream *PodLogStream) {
+func (l *BatchLogHandler) startPodLogStream(podCtx context.Context, podStream *PodLogStream) {
 	pod := podStream.Pod
-	podCtx, cancel := context.WithCancel(l.ctx)
-	podStream.Cancel = cancel
+	defer close(podStream.Done)
 
-	defer func() {
-		close(podStream.Done)
-	}()
+	// Timestamps are always requested so the stream can be resumed, they are
+	// stripped again if the client did not ask for them
+	opts := l.opts.DeepCopy()
+	opts.Timestamps = true
+	prefix := pod.Name
+	if podStream.Container != "" {
+		opts.Container = podStream.Container
+		prefix = pod.Name + "/" + podStream.Container
+	}
 
-	req := l.k8sClient.ClientSet.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, l.opts)
-	podLogs, err := req.Stream(podCtx)
+	state := &logStreamState{
+		podStream: podStream,
+		prefix:    prefix,
+		cursor:    pod.Name,
+		lastLevel: LogLevelUnknown,
+	}
+	resumable := opts.Follow && !opts.Previous
+	var instance string
+	if resumable {
+		var container string
+		instance, container = l.containerInstance(podCtx, pod, opts.Container)
+		if container != "" {
+			state.cursor = pod.Name + "/" + container
+		}
+		if after, ok := l.resume[state.cursor]; ok {
+			// Continue after the last line the client received from this stream
+			since := metav1.NewTime(after)
+			opts.SinceTime = &since
+			opts.SinceSeconds = nil
+			opts.TailLines = nil
+			state.lastTime = after
+			state.resumeAfter = after
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		received, err := l.streamContainerLogs(podCtx, pod, opts, state)
+		if podCtx.Err() != nil {
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			if !resumable || attempt >= maxLogStreamRetries {
+				_ = l.enqueue(l.ctx, podStream.buf, LogsMessage{Type: "error", Data: fmt.Sprintf("Failed to stream pod logs for %s: %v", prefix, err)})
+				break
+			}
+			klog.V(1).Infof("Log stream for %s interrupted, resuming: %v", prefix, err)
+		}
+		if !resumable {
+			break
+		}
+		if received {
+			attempt = 0
+		}
+
+		next, ok := l.waitForContainer(podCtx, pod, opts.Container, instance, attempt)
+		if !ok {
+			break
+		}
+		if instance == "" {
+			instance = next.instance
+		}
+		if next.instance != instance {
+			// The container restarted, switch to the new instance from its first line
+			_ = l.enqueue(podCtx, podStream.buf, LogsMessage{Type: "container_restarted", Data: fmt.Sprintf("{\"pod\":\"%s\",\"container\":\"%s\",\"restartCount\":%d}",
+				pod.Name, next.container, next.restartCount)})
+			if l.backfillPrevious {
+				l.backfillPreviousLogs(podCtx, pod, opts, state)
+			}
+			instance = next.instance
+			opts.SinceTime = nil
+			opts.SinceSeconds = nil
+			opts.TailLines = nil
+			state.resumeAfter = time.Time{}
+			continue
+		}
+		// Same instance, the connection was dropped: continue after the last line
+		if !state.lastTime.IsZero() {
+			since := metav1.NewTime(state.lastTime)
+			opts.SinceTime = &since
+			opts.SinceSeconds = nil
+			opts.TailLines = nil
+			state.resumeAfter = state.lastTime
+		}
+	}
+
+	msgs := []LogsMessage{{Type: "close", Data: fmt.Sprintf("{\"status\":\"closed\",\"pod\":\"%s\",\"container\":\"%s\"}", pod.Name, podStream.Container)}}
+	if podStream.removed.Load() {
+		msgs = append(msgs, LogsMessage{Type: "pod_removed", Data: fmt.Sprintf("{\"pod\":\"%s\",\"namespace\":\"%s\",\"container\":\"%s\"}",
+			pod.Name, pod.Namespace, podStream.Container)})
+	}
+	l.finish(podStream.buf, msgs...)
+}
+
+// logStreamState is the per stream state kept across reconnects
+type logStreamState struct {
+	podStream *PodLogStream
+	prefix    string
+	// cursor is the pod/container key of the stream in resume messages, empty
+	// for streams that cannot be resumed
+	cursor string
+	// lines without a detectable level (e.g. stack traces) inherit the level of the previous line
+	lastLevel LogLevel
+	// lastTime is the timestamp of the last line read
+	lastTime time.Time
+	// lines at or before resumeAfter were already sent
+	resumeAfter time.Time
+}
+
+// streamContainerLogs sends the log lines of one request, it reports whether any line was read
+func (l *BatchLogHandler) streamContainerLogs(ctx context.Context, pod corev1.Pod, opts *corev1.PodLogOptions, state *logStreamState) (bool, error) {
+	req := l.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts)
+	podLogs, err := req.Stream(ctx)
 	if err != nil {
-		_ = sendErrorMessage(l.conn, fmt.Sprintf("Failed to get pod logs for %s: %v", pod.Name, err))
-		return
+		return false, err
 	}
 	defer func() {
 		_ = podLogs.Close()
 	}()
 
-	lw := writerFunc(func(p []byte) (int, error) {
-		logString := string(p)
-		logLines := strings.SplitSeq(logString, "\n")
-		for line := range logLines {
-			if line == "" {
-				continue
-			}
-			if len(l.pods) > 1 {
-				line = fmt.Sprintf("[%s]: %s", pod.Name, line)
-			}
-			err := sendMessage(l.conn, "log", line)
-			if err != nil {
-				return 0, err
+	received := false
+	reader := bufio.NewReader(podLogs)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			received = true
+			if sendErr := l.sendLogLine(ctx, state, line); sendErr != nil {
+				return received, sendErr
 			}
 		}
+		if err != nil {
+			return received, err
+		}
+	}
+}
 
-		return len(p), nil
-	})
-
-	_, err = io.Copy(lw, podLogs)
-	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, context.Canceled) {
-		_ = sendErrorMessage(l.conn, fmt.Sprintf("Failed to stream pod logs for %s: %v", pod.Name, err))
+func (l *BatchLogHandler) sendLogLine(ctx context.Context, state *logStreamState, line string) error {
+	var at time.Time
+	if ts, rest, ok := splitLogTimestamp(line); ok {
+		at = ts
+		if !state.resumeAfter.IsZero() {
+			if !ts.After(state.resumeAfter) {
+				return nil
+			}
+			state.resumeAfter = time.Time{}
+		}
+		state.lastTime = ts
+		if !l.opts.Timestamps {
+			line = rest
+		}
 	}
 
-	_ = sendMessage(l.conn, "close", fmt.Sprintf("{\"status\":\"closed\",\"pod\":\"%s\"}", pod.Name))
+	filter := l.filter.Load()
+	var entry *StructuredLog
+	if l.parseJSON || filter.NeedsFields() {
+		entry, _ = ParseStructuredLog(line)
+	}
+	if filter != nil {
+		level := LogLevelUnknown
+		if filter.NeedsLevel() {
+			if level = DetectLogLevel(line); level == LogLevelUnknown {
+				level = state.lastLevel
+			} else {
+				state.lastLevel = level
+			}
+		}
+		if !filter.Match(line, level) || !filter.MatchFields(entry) {
+			return nil
+		}
+	}
+	multiplexed := l.streamCount() > 1 || state.podStream.Container != ""
+	if l.parseJSON && entry != nil {
+		if multiplexed {
+			entry.Source = state.prefix
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return l.enqueueOut(ctx, state.podStream.buf, logOutMessage{msg: LogsMessage{Type: "structured", Data: string(data)}, cursor: state.cursor, at: at})
+	}
+	if multiplexed {
+		line = fmt.Sprintf("[%s]: %s", state.prefix, line)
+	}
+	return l.enqueueOut(ctx, state.podStream.buf, logOutMessage{msg: LogsMessage{Type: "log", Data: line}, cursor: state.cursor, at: at})
 }
 
 func (l *BatchLogHandler) heartbeat(ctx context.Context) {
@@ -120,80 +365,168 @@ func (l *BatchLogHandler) heartbeat(ctx context.Context) {
 				l.cancel() // Cancel internal context when connection is lost
 				return
 			}
+			var msg logClientMessage
+			if json.Unmarshal(temp, &msg) == nil && msg.Type == "filter" {
+				l.handleFilterMessage(msg.Filter)
+				continue
+			}
 			if strings.Contains(string(temp), "ping") {
-				err = sendMessage(l.conn, "pong", "pong")
-				if err != nil {
-					klog.Infof("Failed to send pong, cancelling internal context: %v", err)
-					l.cancel() // Cancel internal context when send fails
-					return
-				}
+				l.send("pong", "pong")
 			}
 		}
 	}
 }
 
+// logClientMessage is a control message sent by the client, e.g.
+// {"type":"filter","filter":{"include":"timeout","level":"warn"}}
+type logClientMessage struct {
+	Type   string            `json:"type"`
+	Filter *LogFilterOptions `json:"filter,omitempty"`
+}
+
+func (l *BatchLogHandler) handleFilterMessage(opts *LogFilterOptions) {
+	if opts == nil {
+		opts = &LogFilterOptions{}
+	}
+	filter, err := NewLogFilter(*opts)
+	if err != nil {
+		l.sendError(err.Error())
+		return
+	}
+	l.SetFilter(filter)
+	data, _ := json.Marshal(opts)
+	l.send("filter_updated", string(data))
+}
+
+// SetParseJSON sends JSON log lines as "structured" messages instead of "log"
+func (l *BatchLogHandler) SetParseJSON(parse bool) {
+	l.parseJSON = parse
+}
+
+// SetResume resumes the streams of a reconnecting client after the timestamps
+// of its last resume message, keyed by pod/container. Previously sent lines
+// are skipped, streams without a timestamp start as usual. With
+// backfillPrevious the remaining logs of a restarted container instance are
+// sent before switching to the new instance. It must be called before pods
+// are added.
+func (l *BatchLogHandler) SetResume(resume map[string]time.Time, backfillPrevious bool) {
+	l.resume = resume
+	l.backfillPrevious = backfillPrevious
+	// The writer owns the cursors once a stream has started, a stream that
+	// sends nothing new keeps its cursor in the next resume message
+	l.cursors = maps.Clone(resume)
+	if l.cursors == nil {
+		l.cursors = make(map[string]time.Time)
+	}
+}
+
+// SetFilter replaces the filter applied to log lines, nil disables filtering
+func (l *BatchLogHandler) SetFilter(filter *LogFilter) {
+	l.filter.Store(filter)
+}
+
+// SetContainerSelector streams the selected containers of every pod separately,
+// it must be called before pods are added
+func (l *BatchLogHandler) SetContainerSelector(selector *LogContainerSelector) {
+	l.containers = selector
+}
+
 // AddPod adds a new pod to the batch log handler and starts streaming its logs
 func (l *BatchLogHandler) AddPod(pod corev1.Pod) {
+	if l.containers == nil {
+		l.addStream(pod, "")
+		return
+	}
+	for _, container := range l.containers.containerNames(pod) {
+		l.addStream(pod, container)
+	}
+}
+
+func (l *BatchLogHandler) addStream(pod corev1.Pod, container string) {
 	key := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+	source := pod.Name
+	if container != "" {
+		key += "/" + container
+		source += "/" + container
+	}
 
-	if _, exists := l.pods[key]; exists {
+	l.mu.Lock()
+	if _, exists := l.pods[key]; exists || l.ctx.Err() != nil {
+		l.mu.Unlock()
 		return
 	}
-
+	if len(l.pods) >= l.maxStreams {
+		reported := l.limited
+		l.limited = true
+		l.mu.Unlock()
+		if !reported {
+			l.sendError(fmt.Sprintf("Too many log streams, only the first %d are shown", l.maxStreams))
+		}
+		return
+	}
+	podCtx, cancel := context.WithCancel(l.ctx)
 	podStream := &PodLogStream{
-		Pod:  pod,
-		Done: make(chan struct{}),
+		Pod:       pod,
+		Container: container,
+		Cancel:    cancel,
+		Done:      make(chan struct{}),
+		buf:       newLogBuffer(source, l.bufferSize),
 	}
 	l.pods[key] = podStream
+	l.mu.Unlock()
 
-	// Start streaming for this pod
-	go l.startPodLogStream(podStream)
+	// pod_added is queued before the stream's buffer is drained by the writer
+	l.send("pod_added", fmt.Sprintf("{\"pod\":\"%s\",\"namespace\":\"%s\",\"container\":\"%s\"}",
+		pod.Name, pod.Namespace, container))
+	l.mu.Lock()
+	l.buffers = append(l.buffers, podStream.buf)
+	l.mu.Unlock()
 
-	_ = sendMessage(l.conn, "pod_added", fmt.Sprintf("{\"pod\":\"%s\",\"namespace\":\"%s\"}",
-		pod.Name, pod.Namespace))
+	// Start streaming for this pod
+	go l.startPodLogStream(podCtx, podStream)
 }
 
 // RemovePod removes a pod from the batch log handler and stops streaming its logs
 func (l *BatchLogHandler) RemovePod(pod corev1.Pod) {
 	key := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
-	podStream, exists := l.pods[key]
-	if !exists {
-		return
-	}
-
-	if podStream.Cancel != nil {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for streamKey, podStream := range l.pods {
+		if streamKey != key && !strings.HasPrefix(streamKey, key+"/") {
+			continue
+		}
+		podStream.removed.Store(true)
 		podStream.Cancel()
+		delete(l.pods, streamKey)
 	}
+	if len(l.pods) < l.maxStreams {
+		l.limited = false
+	}
+}
 
-	go func() {
-		<-podStream.Done
-		_ = sendMessage(l.conn, "pod_removed", fmt.Sprintf("{\"pod\":\"%s\",\"namespace\":\"%s\"}",
-			pod.Name, pod.Namespace))
-	}()
-
-	delete(l.pods, key)
+func (l *BatchLogHandler) streamCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.pods)
 }
 
+// Stop stops all streams and the writer, it is safe to call more than once
 func (l *BatchLogHandler) Stop() {
-	for _, podStream := range l.pods {
-		if podStream.Cancel != nil {
-			podStream.Cancel()
-		}
-	}
-	l.cancel()
+	l.mu.Lock()
+	streams := l.pods
 	l.pods = make(map[string]*PodLogStream)
-}
+	l.mu.Unlock()
 
-// writerFunc adapts a function to io.Writer so we can create
-// small writers inline inside functions and capture local state.
-type writerFunc func([]byte) (int, error)
-
-func (wf writerFunc) Write(p []byte) (int, error) {
-	return wf(p)
+	l.cancel()
+	for _, podStream := range streams {
+		podStream.Cancel()
+		<-podStream.Done
+	}
+	<-l.writerDone
 }
 
 type LogsMessage struct {
-	Type string `json:"type"` // "log", "error", "connected", "close"
+	Type string `json:"type"` // "log", "error", "connected", "close", "filter_updated", "structured", "container_restarted", "dropped", "resume"
 	Data string `json:"data"`
 }
 
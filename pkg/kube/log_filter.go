@@ -0,0 +1,247 @@
+package kube
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LogLevel is the severity of a log line, LogLevelUnknown when it cannot be detected
+type LogLevel int
+
+const (
+	LogLevelUnknown LogLevel = iota
+	LogLevelTrace
+	LogLevelDebug
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+	LogLevelFatal
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelTrace:
+		return "trace"
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	case LogLevelFatal:
+		return "fatal"
+	}
+	return ""
+}
+
+// ParseLogLevel converts a level name such as "warning" or "ERR" to a LogLevel
+func ParseLogLevel(s string) LogLevel {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "trace", "trc":
+		return LogLevelTrace
+	case "debug", "dbg":
+		return LogLevelDebug
+	case "info", "information", "notice", "inf":
+		return LogLevelInfo
+	case "warn", "warning", "wrn":
+		return LogLevelWarn
+	case "error", "err", "eror":
+		return LogLevelError
+	case "fatal", "panic", "critical", "crit", "emerg", "emergency", "alert", "dpanic":
+		return LogLevelFatal
+	}
+	return LogLevelUnknown
+}
+
+var (
+	// RFC3339 timestamp added by the API server when timestamps=true
+	logTimestampPrefix = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T[0-9:.]+(?:Z|[+-]\d{2}:\d{2}) `)
+	jsonLevelPattern   = regexp.MustCompile(`"(?:level|lvl|severity|log\.level)"\s*:\s*(?:"([A-Za-z]+)"|(\d+))`)
+	logfmtLevelPattern = regexp.MustCompile(`(?:^|\s)(?:level|lvl|severity)=("?)([A-Za-z]+)`)
+	klogLevelPattern   = regexp.MustCompile(`^([IWEF])\d{4} \d{2}:\d{2}:\d{2}`)
+	wordLevelPattern   = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|ERR|FATAL|PANIC|CRITICAL)\b`)
+)
+
+// DetectLogLevel detects the level of a log line written as JSON, logfmt,
+// klog or with a plain upper case level word near the start of the line
+func DetectLogLevel(line string) LogLevel {
+	line = logTimestampPrefix.ReplaceAllString(line, "")
+	if strings.HasPrefix(strings.TrimSpace(line), "{") {
+		if m := jsonLevelPattern.FindStringSubmatch(line); m != nil {
+			if m[1] != "" {
+				return ParseLogLevel(m[1])
+			}
+			return pinoLevel(m[2])
+		}
+	}
+	if m := logfmtLevelPattern.FindStringSubmatch(line); m != nil {
+		if level := ParseLogLevel(m[2]); level != LogLevelUnknown {
+			return level
+		}
+	}
+	if m := klogLevelPattern.FindStringSubmatch(line); m != nil {
+		switch m[1] {
+		case "I":
+			return LogLevelInfo
+		case "W":
+			return LogLevelWarn
+		case "E":
+			return LogLevelError
+		case "F":
+			return LogLevelFatal
+		}
+	}
+	head := line
+	if len(head) > 120 {
+		head = head[:120]
+	}
+	if m := wordLevelPattern.FindString(head); m != "" {
+		return ParseLogLevel(m)
+	}
+	return LogLevelUnknown
+}
+
+// pinoLevel maps numeric levels used by pino and bunyan
+func pinoLevel(s string) LogLevel {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return LogLevelUnknown
+	}
+	switch {
+	case n >= 60:
+		return LogLevelFatal
+	case n >= 50:
+		return LogLevelError
+	case n >= 40:
+		return LogLevelWarn
+	case n >= 30:
+		return LogLevelInfo
+	case n >= 20:
+		return LogLevelDebug
+	case n >= 10:
+		return LogLevelTrace
+	}
+	return LogLevelUnknown
+}
+
+// LogFilterOptions are the user supplied log filter parameters
+type LogFilterOptions struct {
+	Include       string `json:"include,omitempty"`
+	Exclude       string `json:"exclude,omitempty"`
+	Level         string `json:"level,omitempty"`
+	CaseSensitive bool   `json:"caseSensitive,omitempty"`
+	// Fields are key=value conditions on JSON log lines, e.g. trace_id=abc
+	Fields []string `json:"fields,omitempty"`
+}
+
+// LogFilter decides which log lines are sent to the client
+type LogFilter struct {
+	include  *regexp.Regexp
+	exclude  *regexp.Regexp
+	minLevel LogLevel
+	fields   map[string]string
+}
+
+// NewLogFilter compiles the filter options, it returns nil when nothing is filtered
+func NewLogFilter(opts LogFilterOptions) (*LogFilter, error) {
+	f := &LogFilter{}
+	var err error
+	if f.include, err = compileLogPattern(opts.Include, opts.CaseSensitive); err != nil {
+		return nil, fmt.Errorf("invalid include pattern: %w", err)
+	}
+	if f.exclude, err = compileLogPattern(opts.Exclude, opts.CaseSensitive); err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+	if opts.Level != "" {
+		f.minLevel = ParseLogLevel(opts.Level)
+		if f.minLevel == LogLevelUnknown {
+			return nil, fmt.Errorf("invalid level: %s", opts.Level)
+		}
+	}
+	for _, field := range opts.Fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid field filter %q, expected key=value", field)
+		}
+		if f.fields == nil {
+			f.fields = map[string]string{}
+		}
+		f.fields[strings.TrimSpace(key)] = value
+	}
+	if f.include == nil && f.exclude == nil && f.minLevel == LogLevelUnknown && len(f.fields) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+func compileLogPattern(pattern string, caseSensitive bool) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// Match reports whether line passes the filter. level is the detected level
+// of the line, continuation lines should pass the level of the line they belong to.
+func (f *LogFilter) Match(line string, level LogLevel) bool {
+	if f == nil {
+		return true
+	}
+	// LogLevelUnknown is the lowest level, so lines without a level are dropped too
+	if f.minLevel != LogLevelUnknown && level < f.minLevel {
+		return false
+	}
+	if f.include != nil && !f.include.MatchString(line) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(line) {
+		return false
+	}
+	return true
+}
+
+// NeedsLevel reports whether Match uses the level, so callers can skip detection
+func (f *LogFilter) NeedsLevel() bool {
+	return f != nil && f.minLevel != LogLevelUnknown
+}
+
+// NeedsFields reports whether the filter has field conditions, which only
+// structured lines can satisfy
+func (f *LogFilter) NeedsFields() bool {
+	return f != nil && len(f.fields) > 0
+}
+
+// MatchFields reports whether a structured line satisfies all field conditions
+func (f *LogFilter) MatchFields(entry *StructuredLog) bool {
+	if !f.NeedsFields() {
+		return true
+	}
+	if entry == nil {
+		return false
+	}
+	for key, want := range f.fields {
+		var got any
+		var ok bool
+		switch key {
+		case "timestamp":
+			got, ok = entry.Timestamp, true
+		case "level":
+			got, ok = entry.Level, true
+		case "message":
+			got, ok = entry.Message, true
+		default:
+			got, ok = lookupField(entry.Fields, key)
+		}
+		if !ok || fmt.Sprint(got) != want {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package kube
+
+import "testing"
+
+func TestDetectLogLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want LogLevel
+	}{
+		{"logfmt", `ts=2024-01-01T00:00:00Z level=warn msg="disk slow"`, LogLevelWarn},
+		{"logfmt quoted", `time="2024" level="error" msg=boom`, LogLevelError},
+		{"json", `{"level":"debug","msg":"hello"}`, LogLevelDebug},
+		{"json numeric", `{"level":50,"msg":"failed"}`, LogLevelError},
+		{"json severity", `{"severity":"WARNING","message":"x"}`, LogLevelWarn},
+		{"klog info", `I0102 15:04:05.123456       1 main.go:10] started`, LogLevelInfo},
+		{"klog error", `E0102 15:04:05.123456       1 main.go:10] failed`, LogLevelError},
+		{"with timestamp", `2024-01-02T15:04:05.123456789Z E0102 15:04:05.123456 1 x.go:1] failed`, LogLevelError},
+		{"plain word", `2024-01-02 15:04:05 [ERROR] connection refused`, LogLevelError},
+		{"lower case word is not a level", `an error happened`, LogLevelUnknown},
+		{"no level", `    at com.example.Main.run(Main.java:10)`, LogLevelUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectLogLevel(tt.line); got != tt.want {
+				t.Errorf("DetectLogLevel(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  LogFilterOptions
+		line  string
+		level LogLevel
+		want  bool
+	}{
+		{"include match", LogFilterOptions{Include: "timeout"}, "request TIMEOUT", LogLevelUnknown, true},
+		{"include case sensitive", LogFilterOptions{Include: "timeout", CaseSensitive: true}, "request TIMEOUT", LogLevelUnknown, false},
+		{"include miss", LogFilterOptions{Include: "timeout"}, "request ok", LogLevelUnknown, false},
+		{"exclude match", LogFilterOptions{Exclude: "healthz"}, "GET /healthz", LogLevelUnknown, false},
+		{"exclude miss", LogFilterOptions{Exclude: "healthz"}, "GET /api", LogLevelUnknown, true},
+		{"level above min", LogFilterOptions{Level: "warn"}, "x", LogLevelError, true},
+		{"level below min", LogFilterOptions{Level: "warn"}, "x", LogLevelInfo, false},
+		{"unknown level dropped", LogFilterOptions{Level: "warn"}, "x", LogLevelUnknown, false},
+		{"combined", LogFilterOptions{Include: "db", Exclude: "retry", Level: "error"}, "db down", LogLevelError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewLogFilter(tt.opts)
+			if err != nil {
+				t.Fatalf("NewLogFilter() error = %v", err)
+			}
+			if got := f.Match(tt.line, tt.level); got != tt.want {
+				t.Errorf("Match(%q, %v) = %v, want %v", tt.line, tt.level, got, tt.want)
+			}
+		})
+	}
+
+	if f, err := NewLogFilter(LogFilterOptions{}); err != nil || f != nil {
+		t.Errorf("NewLogFilter(empty) = %v, %v, want nil, nil", f, err)
+	}
+	if _, err := NewLogFilter(LogFilterOptions{Include: "("}); err == nil {
+		t.Error("expected error for invalid include pattern")
+	}
+	if _, err := NewLogFilter(LogFilterOptions{Level: "loud"}); err == nil {
+		t.Error("expected error for invalid level")
+	}
+}
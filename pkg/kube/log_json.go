@@ -0,0 +1,131 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// StructuredLog is a JSON log line split into its well known parts
+type StructuredLog struct {
+	Timestamp string         `json:"timestamp,omitempty"`
+	Level     string         `json:"level,omitempty"`
+	Message   string         `json:"message"`
+	Fields    map[string]any `json:"fields,omitempty"`
+	// Source is the pod, or pod/container, when several streams are multiplexed
+	Source string `json:"source,omitempty"`
+}
+
+var (
+	timestampKeys = []string{"timestamp", "@timestamp", "time", "ts", "t"}
+	levelKeys     = []string{"level", "lvl", "severity", "log.level"}
+	messageKeys   = []string{"message", "msg", "@message", "log"}
+)
+
+// ParseStructuredLog parses a JSON object log line, optionally prefixed with the
+// timestamp added by the API server. It reports false for any other line.
+func ParseStructuredLog(line string) (*StructuredLog, bool) {
+	var apiTimestamp string
+	if loc := logTimestampPrefix.FindStringIndex(line); loc != nil {
+		apiTimestamp = strings.TrimSpace(line[:loc[1]])
+		line = line[loc[1]:]
+	}
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") || !strings.HasSuffix(line, "}") {
+		return nil, false
+	}
+	// Numbers are kept as written, float64 would print large integers such
+	// as IDs in exponent notation and round them
+	fields := map[string]any{}
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+
+	entry := &StructuredLog{Timestamp: apiTimestamp}
+	if v, ok := takeField(fields, timestampKeys); ok {
+		if ts := formatLogTimestamp(v); ts != "" {
+			entry.Timestamp = ts
+		}
+	}
+	if v, ok := takeField(fields, levelKeys); ok {
+		switch level := v.(type) {
+		case string:
+			entry.Level = strings.ToLower(level)
+		case json.Number:
+			entry.Level = pinoLevel(level.String()).String()
+		}
+	}
+	if v, ok := takeField(fields, messageKeys); ok {
+		if msg, ok := v.(string); ok {
+			entry.Message = msg
+		} else {
+			entry.Message = fmt.Sprint(v)
+		}
+	}
+	if len(fields) > 0 {
+		entry.Fields = fields
+	}
+	return entry, true
+}
+
+// takeField removes and returns the first of keys present in fields
+func takeField(fields map[string]any, keys []string) (any, bool) {
+	for _, key := range keys {
+		if v, ok := fields[key]; ok {
+			delete(fields, key)
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// formatLogTimestamp normalizes string timestamps as is and epoch seconds or
+// milliseconds, as written by zap and pino, to RFC3339
+func formatLogTimestamp(v any) string {
+	switch ts := v.(type) {
+	case string:
+		return ts
+	case json.Number:
+		f, err := ts.Float64()
+		if err != nil {
+			return ""
+		}
+		if f > 1e12 {
+			ms, err := ts.Int64()
+			if err != nil {
+				ms = int64(f)
+			}
+			return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano)
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(time.RFC3339Nano)
+	}
+	return ""
+}
+
+// lookupField returns a field by key, dots descend into nested objects
+func lookupField(fields map[string]any, key string) (any, bool) {
+	if v, ok := fields[key]; ok {
+		return v, true
+	}
+	parts := strings.Split(key, ".")
+	var cur any = fields
+	for _, part := range parts {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
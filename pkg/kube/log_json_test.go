@@ -0,0 +1,87 @@
+package kube
+
+import "testing"
+
+func TestParseStructuredLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		ok      bool
+		want    StructuredLog
+		wantKey string
+	}{
+		{
+			name:    "zap",
+			line:    `{"level":"INFO","ts":1700000000.5,"msg":"started","port":8080}`,
+			ok:      true,
+			want:    StructuredLog{Timestamp: "2023-11-14T22:13:20.5Z", Level: "info", Message: "started"},
+			wantKey: "port",
+		},
+		{
+			name:    "api timestamp prefix",
+			line:    `2024-01-02T15:04:05.000000001Z {"severity":"error","message":"boom","trace_id":"abc"}`,
+			ok:      true,
+			want:    StructuredLog{Timestamp: "2024-01-02T15:04:05.000000001Z", Level: "error", Message: "boom"},
+			wantKey: "trace_id",
+		},
+		{
+			name: "pino numeric level",
+			line: `{"level":40,"time":1700000000000,"msg":"slow"}`,
+			ok:   true,
+			want: StructuredLog{Timestamp: "2023-11-14T22:13:20Z", Level: "warn", Message: "slow"},
+		},
+		{name: "plain text", line: `level=info msg=started`},
+		{name: "invalid json", line: `{"level":`},
+		{name: "json array", line: `[1,2]`},
+		{name: "trailing data", line: `{"msg":"a"} {"msg":"b"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseStructuredLog(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("ParseStructuredLog() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got.Timestamp != tt.want.Timestamp || got.Level != tt.want.Level || got.Message != tt.want.Message {
+				t.Errorf("ParseStructuredLog() = %+v, want %+v", got, tt.want)
+			}
+			if tt.wantKey != "" {
+				if _, ok := got.Fields[tt.wantKey]; !ok {
+					t.Errorf("expected field %q in %v", tt.wantKey, got.Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestLogFilterFields(t *testing.T) {
+	f, err := NewLogFilter(LogFilterOptions{Fields: []string{"trace_id=abc", "http.status=500", "level=error"}})
+	if err != nil {
+		t.Fatalf("NewLogFilter() error = %v", err)
+	}
+	match, _ := ParseStructuredLog(`{"level":"error","msg":"x","trace_id":"abc","http":{"status":500}}`)
+	if !f.MatchFields(match) {
+		t.Error("expected entry to match field filters")
+	}
+	miss, _ := ParseStructuredLog(`{"level":"error","msg":"x","trace_id":"def","http":{"status":500}}`)
+	if f.MatchFields(miss) {
+		t.Error("expected entry with other trace_id not to match")
+	}
+	if f.MatchFields(nil) {
+		t.Error("expected unstructured line not to match field filters")
+	}
+	// Large integers are compared as written, not in exponent notation
+	f, err = NewLogFilter(LogFilterOptions{Fields: []string{"user_id=12345678", "order.id=9007199254740993"}})
+	if err != nil {
+		t.Fatalf("NewLogFilter() error = %v", err)
+	}
+	ids, _ := ParseStructuredLog(`{"msg":"x","user_id":12345678,"order":{"id":9007199254740993}}`)
+	if !f.MatchFields(ids) {
+		t.Errorf("expected entry to match large integer fields, fields %v", ids.Fields)
+	}
+	if _, err := NewLogFilter(LogFilterOptions{Fields: []string{"trace_id"}}); err == nil {
+		t.Error("expected error for field filter without value")
+	}
+}
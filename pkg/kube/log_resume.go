@@ -0,0 +1,167 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// maxLogStreamRetries is the number of consecutive reconnects without receiving a line
+	maxLogStreamRetries   = 5
+	logStreamPollInterval = 2 * time.Second
+)
+
+// splitLogTimestamp splits the RFC3339Nano timestamp added by the API server from a line
+func splitLogTimestamp(line string) (time.Time, string, bool) {
+	loc := logTimestampPrefix.FindStringIndex(line)
+	if loc == nil {
+		return time.Time{}, line, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, line[:loc[1]-1])
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return ts, line[loc[1]:], true
+}
+
+// containerInstanceInfo identifies a running instance of a container
+type containerInstanceInfo struct {
+	container    string
+	instance     string // container ID, changes on every restart
+	restartCount int32
+}
+
+// defaultLogContainer returns the container the API server streams when none is given
+func defaultLogContainer(pod *corev1.Pod) string {
+	if name := pod.Annotations["kubectl.kubernetes.io/default-container"]; name != "" {
+		return name
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+	return ""
+}
+
+func findContainerStatus(pod *corev1.Pod, name string) (*corev1.ContainerStatus, bool) {
+	for i := range pod.Status.InitContainerStatuses {
+		if pod.Status.InitContainerStatuses[i].Name == name {
+			return &pod.Status.InitContainerStatuses[i], true
+		}
+	}
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == name {
+			return &pod.Status.ContainerStatuses[i], false
+		}
+	}
+	return nil, false
+}
+
+func (l *BatchLogHandler) getContainerInstance(ctx context.Context, pod corev1.Pod, container string) (*corev1.Pod, *containerInstanceInfo, bool, error) {
+	current, err := l.clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if container == "" {
+		container = defaultLogContainer(current)
+	}
+	status, isInit := findContainerStatus(current, container)
+	if status == nil {
+		return current, nil, false, nil
+	}
+	return current, &containerInstanceInfo{
+		container:    container,
+		instance:     status.ContainerID,
+		restartCount: status.RestartCount,
+	}, isInit, nil
+}
+
+// containerInstance returns the ID of the container instance being streamed
+// and the name of the container, which is resolved when none is given
+func (l *BatchLogHandler) containerInstance(ctx context.Context, pod corev1.Pod, container string) (string, string) {
+	_, info, _, err := l.getContainerInstance(ctx, pod, container)
+	if err != nil || info == nil {
+		return "", container
+	}
+	return info.instance, info.container
+}
+
+// waitForContainer is called when a follow stream ended. It waits until the
+// container is running again, either the same instance after a dropped
+// connection or a new instance after a restart. It reports false when the
+// stream should not be resumed because the pod or container is gone for good.
+func (l *BatchLogHandler) waitForContainer(ctx context.Context, pod corev1.Pod, container, instance string, attempt int) (*containerInstanceInfo, bool) {
+	if attempt > 0 {
+		if !sleepContext(ctx, time.Duration(min(attempt, maxLogStreamRetries))*time.Second) {
+			return nil, false
+		}
+	}
+	for failures := 0; ; {
+		current, info, isInit, err := l.getContainerInstance(ctx, pod, container)
+		switch {
+		case apierrors.IsNotFound(err):
+			return nil, false
+		case err != nil:
+			if failures++; failures > maxLogStreamRetries {
+				klog.V(1).Infof("Giving up on log stream for %s/%s: %v", pod.Namespace, pod.Name, err)
+				return nil, false
+			}
+		case info == nil || current.DeletionTimestamp != nil:
+			return nil, false
+		case current.Status.Phase == corev1.PodSucceeded || current.Status.Phase == corev1.PodFailed:
+			return nil, false
+		case info.instance != instance && info.instance != "":
+			if status, _ := findContainerStatus(current, info.container); status.State.Waiting == nil {
+				return info, true
+			}
+		default:
+			status, _ := findContainerStatus(current, info.container)
+			if status.State.Running != nil {
+				return info, true
+			}
+			// A completed init container or a container that is never restarted has no more logs
+			if status.State.Terminated != nil && (isInit || current.Spec.RestartPolicy == corev1.RestartPolicyNever) {
+				return nil, false
+			}
+		}
+		if !sleepContext(ctx, logStreamPollInterval) {
+			return nil, false
+		}
+	}
+}
+
+// backfillPreviousLogs sends the lines of the previous container instance that
+// were written after the last line streamed
+func (l *BatchLogHandler) backfillPreviousLogs(ctx context.Context, pod corev1.Pod, opts *corev1.PodLogOptions, state *logStreamState) {
+	prev := opts.DeepCopy()
+	prev.Follow = false
+	prev.Previous = true
+	prev.TailLines = nil
+	prev.SinceSeconds = nil
+	prev.SinceTime = nil
+	if !state.lastTime.IsZero() {
+		since := metav1.NewTime(state.lastTime)
+		prev.SinceTime = &since
+		state.resumeAfter = state.lastTime
+	}
+	if _, err := l.streamContainerLogs(ctx, pod, prev, state); err != nil && !errors.Is(err, io.EOF) && ctx.Err() == nil {
+		klog.V(1).Infof("Failed to backfill previous logs for %s: %v", state.prefix, err)
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,45 @@
+package kube
+
+import (
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestLogContainerSelector(t *testing.T) {
+	pod := corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "init"}},
+			Containers:     []corev1.Container{{Name: "app"}, {Name: "sidecar"}},
+		},
+	}
+	tests := []struct {
+		name     string
+		selector LogContainerSelector
+		want     []string
+	}{
+		{"all containers", LogContainerSelector{}, []string{"app", "sidecar"}},
+		{"with init containers", LogContainerSelector{IncludeInitContainers: true}, []string{"init", "app", "sidecar"}},
+		{"selected", LogContainerSelector{Containers: []string{"sidecar"}}, []string{"sidecar"}},
+		{"selected init", LogContainerSelector{Containers: []string{"init", "app"}, IncludeInitContainers: true}, []string{"init", "app"}},
+		{"init needs flag", LogContainerSelector{Containers: []string{"init"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.selector.containerNames(pod); !slices.Equal(got, tt.want) {
+				t.Errorf("containerNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitLogTimestamp(t *testing.T) {
+	ts, rest, ok := splitLogTimestamp("2024-01-02T15:04:05.123456789Z hello world")
+	if !ok || rest != "hello world" || ts.Nanosecond() != 123456789 {
+		t.Errorf("splitLogTimestamp() = %v, %q, %v", ts, rest, ok)
+	}
+	if _, rest, ok := splitLogTimestamp("hello world"); ok || rest != "hello world" {
+		t.Errorf("splitLogTimestamp() without timestamp = %q, %v", rest, ok)
+	}
+}
@@ -0,0 +1,316 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/websocket"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// LogOverflowPolicy decides what happens when a stream produces lines faster
+// than the client reads them and its buffer is full
+type LogOverflowPolicy string
+
+const (
+	// LogOverflowBlock stops reading the pod's logs until the buffer has room
+	LogOverflowBlock LogOverflowPolicy = "block"
+	// LogOverflowDrop drops the oldest buffered lines and reports how many were dropped
+	LogOverflowDrop LogOverflowPolicy = "drop"
+	// LogOverflowDisconnect closes the connection of a client that cannot keep up
+	LogOverflowDisconnect LogOverflowPolicy = "disconnect"
+)
+
+const (
+	DefaultLogBufferSize = 1000
+	DefaultLogMaxStreams = 50
+
+	// logWriteBatch is the number of messages written from one stream before
+	// moving to the next, so a chatty pod cannot starve the others
+	logWriteBatch = 64
+
+	// DefaultLogWriteTimeout is how long a message may take to be written, a
+	// client that stops reading is disconnected after it
+	DefaultLogWriteTimeout = 30 * time.Second
+)
+
+func IsValidLogOverflowPolicy(policy string) bool {
+	switch LogOverflowPolicy(policy) {
+	case LogOverflowBlock, LogOverflowDrop, LogOverflowDisconnect:
+		return true
+	}
+	return false
+}
+
+// logOutMessage is a queued message, final is set on the last message of a stream.
+// at is the timestamp of a log line, the cursor of the stream is moved to it
+// once the line was written.
+type logOutMessage struct {
+	msg    LogsMessage
+	final  bool
+	cursor string
+	at     time.Time
+}
+
+// logBuffer is the bounded queue of one stream, drained by the writer goroutine
+type logBuffer struct {
+	source  string
+	ch      chan logOutMessage
+	dropped atomic.Int64
+}
+
+func newLogBuffer(source string, size int) *logBuffer {
+	return &logBuffer{source: source, ch: make(chan logOutMessage, size)}
+}
+
+// send queues a control message that is not tied to a stream
+func (l *BatchLogHandler) send(msgType, data string) {
+	select {
+	case l.control <- LogsMessage{Type: msgType, Data: data}:
+		l.wake()
+	case <-l.ctx.Done():
+	}
+}
+
+func (l *BatchLogHandler) sendError(errMsg string) {
+	l.send("error", errMsg)
+}
+
+// enqueue queues a message of a stream according to the overflow policy
+func (l *BatchLogHandler) enqueue(ctx context.Context, buf *logBuffer, msg LogsMessage) error {
+	return l.enqueueOut(ctx, buf, logOutMessage{msg: msg})
+}
+
+func (l *BatchLogHandler) enqueueOut(ctx context.Context, buf *logBuffer, out logOutMessage) error {
+	select {
+	case buf.ch <- out:
+		l.wake()
+		return nil
+	default:
+	}
+
+	switch l.overflow {
+	case LogOverflowDrop:
+		for {
+			select {
+			case <-buf.ch:
+				buf.dropped.Add(1)
+			default:
+			}
+			select {
+			case buf.ch <- out:
+				l.wake()
+				return nil
+			default:
+			}
+		}
+	case LogOverflowDisconnect:
+		l.fail(fmt.Sprintf("Client is too slow, more than %d lines of %s are pending", cap(buf.ch), buf.source))
+		return fmt.Errorf("log buffer of %s is full", buf.source)
+	default:
+		select {
+		case buf.ch <- out:
+			l.wake()
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// finish queues the last message of a stream, it is always delivered
+func (l *BatchLogHandler) finish(buf *logBuffer, msgs ...LogsMessage) {
+	for i, msg := range msgs {
+		select {
+		case buf.ch <- logOutMessage{msg: msg, final: i == len(msgs)-1}:
+			l.wake()
+		case <-l.ctx.Done():
+			return
+		}
+	}
+}
+
+func (l *BatchLogHandler) wake() {
+	select {
+	case l.notify <- struct{}{}:
+	default:
+	}
+}
+
+// fail closes the connection, errMsg is sent to the client on a best effort basis
+func (l *BatchLogHandler) fail(errMsg string) {
+	if !l.failure.CompareAndSwap(nil, &errMsg) {
+		return
+	}
+	l.cancel()
+	if l.conn == nil {
+		return
+	}
+	// Unblock a write to a client that stopped reading, the writer then sends
+	// errMsg with its own deadline and the connection is closed after it
+	_ = l.conn.SetWriteDeadline(time.Now())
+	go func() {
+		<-l.writerDone
+		_ = l.conn.Close()
+	}()
+}
+
+// writeLoop is the only goroutine writing to the WebSocket connection
+func (l *BatchLogHandler) writeLoop() {
+	defer close(l.writerDone)
+	for {
+		select {
+		case <-l.ctx.Done():
+			if errMsg := l.failure.Load(); errMsg != nil {
+				_ = l.conn.SetWriteDeadline(time.Now().Add(time.Second))
+				_ = sendErrorMessage(l.conn, *errMsg)
+			}
+			return
+		case <-l.notify:
+		}
+		for l.writePending() {
+		}
+	}
+}
+
+// writePending writes the queued control messages and a batch of every
+// stream, it reports whether anything was written
+func (l *BatchLogHandler) writePending() bool {
+	wrote := false
+	for {
+		select {
+		case msg := <-l.control:
+			if !l.write(msg) {
+				return false
+			}
+			wrote = true
+			continue
+		default:
+		}
+		break
+	}
+
+	l.mu.Lock()
+	buffers := slices.Clone(l.buffers)
+	l.mu.Unlock()
+	for _, buf := range buffers {
+		if n := buf.dropped.Swap(0); n > 0 {
+			if !l.write(LogsMessage{Type: "dropped", Data: fmt.Sprintf("{\"source\":\"%s\",\"count\":%d}", buf.source, n)}) {
+				return false
+			}
+		}
+	batch:
+		for range logWriteBatch {
+			select {
+			case out := <-buf.ch:
+				if !l.write(out.msg) {
+					return false
+				}
+				wrote = true
+				if out.cursor != "" && !out.at.IsZero() {
+					l.cursors[out.cursor] = out.at
+					l.cursorsChanged = true
+				}
+				if out.final {
+					l.retireBuffer(buf)
+					break batch
+				}
+			default:
+				break batch
+			}
+		}
+	}
+	if l.cursorsChanged {
+		// Reconnecting clients pass the last resume message back, see SetResume
+		data, _ := json.Marshal(l.cursors)
+		if !l.write(LogsMessage{Type: "resume", Data: string(data)}) {
+			return false
+		}
+		l.cursorsChanged = false
+	}
+	return wrote
+}
+
+func (l *BatchLogHandler) write(msg LogsMessage) bool {
+	if l.ctx.Err() != nil {
+		return false
+	}
+	_ = l.conn.SetWriteDeadline(time.Now().Add(l.writeTimeout))
+	if err := websocket.JSON.Send(l.conn, msg); err != nil {
+		klog.V(1).Infof("Failed to write log message, closing stream: %v", err)
+		l.cancel()
+		return false
+	}
+	return true
+}
+
+func (l *BatchLogHandler) retireBuffer(buf *logBuffer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buffers = slices.DeleteFunc(l.buffers, func(b *logBuffer) bool {
+		return b == buf
+	})
+}
+
+// HistoricalLogLine is a log line read from a log backend instead of the kubelet
+type HistoricalLogLine struct {
+	Pod       string
+	Container string
+	Timestamp time.Time
+	Line      string
+}
+
+// ReplayLogs sends historical lines in the same format as live streams, lines
+// must be sorted by time. A close message is sent for every pod and container.
+func (l *BatchLogHandler) ReplayLogs(lines []HistoricalLogLine) {
+	buf := newLogBuffer("history", l.bufferSize)
+	l.mu.Lock()
+	l.buffers = append(l.buffers, buf)
+	l.mu.Unlock()
+
+	states := map[string]*logStreamState{}
+	var order []*logStreamState
+	for _, line := range lines {
+		key := line.Pod + "/" + line.Container
+		if _, ok := states[key]; !ok {
+			state := &logStreamState{
+				podStream: &PodLogStream{Pod: corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: line.Pod}}, buf: buf},
+				prefix:    line.Pod,
+				lastLevel: LogLevelUnknown,
+			}
+			states[key] = state
+			order = append(order, state)
+		}
+	}
+	// Lines are prefixed like live streams when more than one container is replayed
+	if len(order) > 1 {
+		for key, state := range states {
+			state.prefix = key
+			state.podStream.Container = strings.TrimPrefix(key, state.podStream.Pod.Name+"/")
+		}
+	}
+
+	for _, line := range lines {
+		state := states[line.Pod+"/"+line.Container]
+		if err := l.sendLogLine(l.ctx, state, line.Timestamp.UTC().Format(time.RFC3339Nano)+" "+line.Line); err != nil {
+			return
+		}
+	}
+
+	msgs := make([]LogsMessage, 0, len(order))
+	for _, state := range order {
+		msgs = append(msgs, LogsMessage{Type: "close", Data: fmt.Sprintf("{\"status\":\"closed\",\"pod\":\"%s\",\"container\":\"%s\",\"source\":\"history\"}",
+			state.podStream.Pod.Name, state.podStream.Container)})
+	}
+	if len(msgs) == 0 {
+		msgs = append(msgs, LogsMessage{Type: "close", Data: "{\"status\":\"closed\",\"source\":\"history\"}"})
+	}
+	l.finish(buf, msgs...)
+}
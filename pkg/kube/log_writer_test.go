@@ -0,0 +1,334 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLogHandler(overflow LogOverflowPolicy) *BatchLogHandler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BatchLogHandler{
+		ctx:      ctx,
+		cancel:   cancel,
+		notify:   make(chan struct{}, 1),
+		overflow: overflow,
+	}
+}
+
+func TestLogBufferOverflow(t *testing.T) {
+	t.Run("drop keeps the newest lines", func(t *testing.T) {
+		l := newTestLogHandler(LogOverflowDrop)
+		buf := newLogBuffer("pod", 2)
+		for i := range 5 {
+			if err := l.enqueue(l.ctx, buf, LogsMessage{Type: "log", Data: fmt.Sprint(i)}); err != nil {
+				t.Fatalf("enqueue() error = %v", err)
+			}
+		}
+		if got := buf.dropped.Load(); got != 3 {
+			t.Errorf("dropped = %d, want 3", got)
+		}
+		if got := (<-buf.ch).msg.Data; got != "3" {
+			t.Errorf("oldest buffered line = %s, want 3", got)
+		}
+	})
+
+	t.Run("disconnect cancels the handler", func(t *testing.T) {
+		l := newTestLogHandler(LogOverflowDisconnect)
+		buf := newLogBuffer("pod", 1)
+		_ = l.enqueue(l.ctx, buf, LogsMessage{Type: "log"})
+		if err := l.enqueue(l.ctx, buf, LogsMessage{Type: "log"}); err == nil {
+			t.Fatal("expected error when the buffer is full")
+		}
+		if l.ctx.Err() == nil || l.failure.Load() == nil {
+			t.Error("expected handler to be cancelled with a failure message")
+		}
+	})
+
+	t.Run("block waits for room", func(t *testing.T) {
+		l := newTestLogHandler(LogOverflowBlock)
+		buf := newLogBuffer("pod", 1)
+		_ = l.enqueue(l.ctx, buf, LogsMessage{Type: "log"})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := l.enqueue(ctx, buf, LogsMessage{Type: "log"}); err == nil {
+			t.Fatal("expected enqueue to block until the context is done")
+		}
+	})
+}
+
+// TestBatchLogHandlerConcurrentPods adds and removes pods from several
+// goroutines while logs are written, run with -race.
+func TestBatchLogHandlerConcurrentPods(t *testing.T) {
+	const pods = 20
+	var objects []corev1.Pod
+	for i := range pods {
+		objects = append(objects, corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", i), Namespace: "default"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		})
+	}
+	clientset := fake.NewClientset()
+
+	done := make(chan struct{})
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer close(done)
+		bl := newBatchLogHandler(ws, clientset, &corev1.PodLogOptions{Follow: true})
+		bl.SetLimits(pods, 4, LogOverflowBlock)
+		defer bl.Stop()
+
+		var wg sync.WaitGroup
+		for i := range objects {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				bl.AddPod(objects[i])
+				bl.AddPod(objects[i])
+				if i%2 == 0 {
+					bl.RemovePod(objects[i])
+				}
+			}()
+		}
+		wg.Wait()
+		bl.StreamLogs(context.Background())
+	}))
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	_ = ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	added, closed := 0, 0
+	for closed < pods {
+		var msg LogsMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("Receive() error = %v (added %d, closed %d)", err, added, closed)
+		}
+		switch msg.Type {
+		case "pod_added":
+			added++
+		case "close":
+			closed++
+		case "error":
+			t.Fatalf("unexpected error message: %s", msg.Data)
+		}
+	}
+	if added != pods {
+		t.Errorf("pod_added = %d, want %d", added, pods)
+	}
+
+	_ = ws.Close()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("handler did not stop after the client disconnected")
+	}
+}
+
+func TestBatchLogHandlerStreamLimit(t *testing.T) {
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		bl := newBatchLogHandler(ws, fake.NewClientset(), &corev1.PodLogOptions{})
+		bl.SetLimits(1, 0, "")
+		defer bl.Stop()
+		bl.AddPod(corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}})
+		bl.AddPod(corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default"}})
+		bl.StreamLogs(context.Background())
+	}))
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer func() {
+		_ = ws.Close()
+	}()
+	_ = ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	var types []string
+	for !strings.Contains(strings.Join(types, ","), "close") {
+		var msg LogsMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("Receive() error = %v, got %v", err, types)
+		}
+		types = append(types, msg.Type)
+		if msg.Type == "pod_added" {
+			var data map[string]string
+			_ = json.Unmarshal([]byte(msg.Data), &data)
+			if data["pod"] != "a" {
+				t.Errorf("pod %s added beyond the stream limit", data["pod"])
+			}
+		}
+	}
+	if !strings.Contains(strings.Join(types, ","), "error") {
+		t.Errorf("expected a stream limit error, got %v", types)
+	}
+}
+
+func TestBatchLogHandlerReplayLogs(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		bl := newBatchLogHandler(ws, fake.NewClientset(), &corev1.PodLogOptions{})
+		defer bl.Stop()
+		go bl.ReplayLogs([]HistoricalLogLine{
+			{Pod: "a", Container: "app", Timestamp: ts, Line: "first"},
+			{Pod: "b", Container: "app", Timestamp: ts.Add(time.Second), Line: "second"},
+		})
+		bl.StreamLogs(context.Background())
+	}))
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer func() {
+		_ = ws.Close()
+	}()
+	_ = ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	var logs []string
+	for closed := 0; closed < 2; {
+		var msg LogsMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		switch msg.Type {
+		case "log":
+			logs = append(logs, msg.Data)
+		case "close":
+			closed++
+		}
+	}
+	want := []string{"[a/app]: first", "[b/app]: second"}
+	if strings.Join(logs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("replayed logs = %q, want %q", logs, want)
+	}
+}
+
+// TestBatchLogHandlerSlowClient checks a client that stops reading does not
+// block the writer, and the handler, forever
+func TestBatchLogHandlerSlowClient(t *testing.T) {
+	for _, overflow := range []LogOverflowPolicy{LogOverflowBlock, LogOverflowDisconnect} {
+		t.Run(string(overflow), func(t *testing.T) {
+			done := make(chan struct{})
+			server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+				defer close(done)
+				bl := newBatchLogHandler(ws, fake.NewClientset(), &corev1.PodLogOptions{})
+				bl.SetLimits(0, 4, overflow)
+				bl.writeTimeout = 200 * time.Millisecond
+				defer bl.Stop()
+
+				line := strings.Repeat("x", 64*1024)
+				lines := make([]HistoricalLogLine, 0, 1000)
+				for i := range 1000 {
+					lines = append(lines, HistoricalLogLine{Pod: "a", Container: "app", Timestamp: time.Unix(int64(i), 0), Line: line})
+				}
+				go bl.ReplayLogs(lines)
+				bl.StreamLogs(context.Background())
+			}))
+			defer server.Close()
+
+			ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			// The client never reads
+			defer func() {
+				_ = ws.Close()
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("handler did not stop while the client was not reading")
+			}
+		})
+	}
+}
+
+// TestBatchLogHandlerResumeCursors checks the per stream cursors sent to the
+// client, they are tracked even when the client does not want timestamps
+func TestBatchLogHandlerResumeCursors(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	earlier := ts.Add(-time.Hour)
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		bl := newBatchLogHandler(ws, fake.NewClientset(), &corev1.PodLogOptions{Follow: true})
+		bl.SetResume(map[string]time.Time{"a/app": ts, "c/app": earlier}, false)
+		defer bl.Stop()
+
+		buf := newLogBuffer("a", 16)
+		bl.mu.Lock()
+		bl.buffers = append(bl.buffers, buf)
+		bl.mu.Unlock()
+		stream := func(pod string) *logStreamState {
+			return &logStreamState{
+				podStream: &PodLogStream{Pod: corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: pod}}, buf: buf},
+				prefix:    pod,
+				cursor:    pod + "/app",
+				lastLevel: LogLevelUnknown,
+			}
+		}
+		a, b := stream("a"), stream("b")
+		// a was resumed, the line the client already has is skipped
+		a.resumeAfter = ts
+		go func() {
+			_ = bl.sendLogLine(bl.ctx, a, ts.Format(time.RFC3339Nano)+" seen")
+			_ = bl.sendLogLine(bl.ctx, a, ts.Add(time.Second).Format(time.RFC3339Nano)+" new")
+			_ = bl.sendLogLine(bl.ctx, b, ts.Add(2*time.Second).Format(time.RFC3339Nano)+" other")
+			bl.finish(buf, LogsMessage{Type: "close"})
+		}()
+		bl.StreamLogs(context.Background())
+	}))
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer func() {
+		_ = ws.Close()
+	}()
+	_ = ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	var logs []string
+	cursors := map[string]time.Time{}
+	for closed := false; !closed || len(cursors) < 3 || !cursors["b/app"].Equal(ts.Add(2*time.Second)); {
+		var msg LogsMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("Receive() error = %v (logs %q, cursors %v)", err, logs, cursors)
+		}
+		switch msg.Type {
+		case "log":
+			logs = append(logs, msg.Data)
+		case "resume":
+			cursors = map[string]time.Time{}
+			if err := json.Unmarshal([]byte(msg.Data), &cursors); err != nil {
+				t.Fatalf("invalid resume message %s: %v", msg.Data, err)
+			}
+		case "close":
+			closed = true
+		}
+	}
+	if want := []string{"new", "other"}; strings.Join(logs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("logs = %q, want %q", logs, want)
+	}
+	want := map[string]time.Time{"a/app": ts.Add(time.Second), "b/app": ts.Add(2 * time.Second), "c/app": earlier}
+	for key, at := range want {
+		if !cursors[key].Equal(at) {
+			t.Errorf("cursor of %s = %v, want %v", key, cursors[key], at)
+		}
+	}
+}
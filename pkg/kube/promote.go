@@ -0,0 +1,71 @@
+package kube
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// podSpecPaths are the paths of the pod specs of pods, workloads and CronJobs
+var podSpecPaths = [][]string{
+	{"spec"},
+	{"spec", "template", "spec"},
+	{"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// RewriteImages replaces the images of the containers of obj. A key of images
+// matches an image exactly, or an image repository, in which case the tag or
+// digest of the image is kept unless the replacement has its own.
+func RewriteImages(obj map[string]interface{}, images map[string]string) {
+	if len(images) == 0 {
+		return
+	}
+	for _, path := range podSpecPaths {
+		for _, field := range []string{"containers", "initContainers", "ephemeralContainers"} {
+			containers, found, _ := unstructured.NestedSlice(obj, append(path, field)...)
+			if !found {
+				continue
+			}
+			for _, container := range containers {
+				c, ok := container.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if image, ok := c["image"].(string); ok {
+					c["image"] = RewriteImage(image, images)
+				}
+			}
+			_ = unstructured.SetNestedSlice(obj, containers, append(path, field)...)
+		}
+	}
+}
+
+// RewriteImage returns the replacement of image, see RewriteImages
+func RewriteImage(image string, images map[string]string) string {
+	if replacement, ok := images[image]; ok {
+		return replacement
+	}
+	repository, reference := splitImage(image)
+	replacement, ok := images[repository]
+	if !ok {
+		return image
+	}
+	if _, ref := splitImage(replacement); ref != "" {
+		return replacement
+	}
+	return replacement + reference
+}
+
+// splitImage splits an image into its repository and its tag or digest
+// including the separator, e.g. ":1.0" or "@sha256:..."
+func splitImage(image string) (string, string) {
+	name, digest := image, ""
+	if i := strings.Index(image, "@"); i >= 0 {
+		name, digest = image[:i], image[i:]
+	}
+	// A colon before the last slash separates the registry port
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		return name[:i], name[i:] + digest
+	}
+	return name, digest
+}
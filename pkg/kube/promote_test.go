@@ -0,0 +1,26 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteImage(t *testing.T) {
+	images := map[string]string{
+		"nginx:1.25":            "nginx:1.27",
+		"registry.dev:5000/web": "registry.prod/web",
+		"busybox":               "mirror/busybox:stable",
+	}
+	for image, expected := range map[string]string{
+		"nginx:1.25":                         "nginx:1.27",
+		"nginx:1.26":                         "nginx:1.26",
+		"registry.dev:5000/web:1.2":          "registry.prod/web:1.2",
+		"registry.dev:5000/web@sha256:abc":   "registry.prod/web@sha256:abc",
+		"registry.dev:5000/web:1.2@sha256:a": "registry.prod/web:1.2@sha256:a",
+		"registry.dev:5000/api:1.2":          "registry.dev:5000/api:1.2",
+		"busybox:1.36":                       "mirror/busybox:stable",
+	} {
+		assert.Equal(t, expected, RewriteImage(image, images), image)
+	}
+}
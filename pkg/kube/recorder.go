@@ -0,0 +1,158 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// SessionRecorder writes terminal events in asciinema v2 (asciicast) format.
+// See https://docs.asciinema.org/manual/asciicast/v2/
+type SessionRecorder struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	size  int64
+	limit int64
+	err   error
+
+	// The header is written with the first event, so it has the size of the
+	// client's terminal when it reports one before any output
+	header        asciicastHeader
+	headerWritten bool
+
+	truncated bool
+}
+
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     uint16            `json:"width"`
+	Height    uint16            `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// NewSessionRecorder returns a recorder writing to w. width and height are the
+// terminal size in the header unless the client reports its size before the
+// first output, the header is written with the first event. Events are dropped once more than limit bytes are
+// written, limit <= 0 means unlimited.
+func NewSessionRecorder(w io.Writer, title string, width, height uint16, limit int64) *SessionRecorder {
+	start := time.Now()
+	return &SessionRecorder{
+		w:     w,
+		start: start,
+		limit: limit,
+		header: asciicastHeader{
+			Version:   2,
+			Width:     width,
+			Height:    height,
+			Timestamp: start.Unix(),
+			Title:     title,
+			Env:       map[string]string{"TERM": "xterm-256color", "SHELL": "/bin/sh"},
+		},
+	}
+}
+
+// Output records data written to the terminal
+func (r *SessionRecorder) Output(p []byte) {
+	r.event("o", string(p))
+}
+
+// Input records data typed by the user
+func (r *SessionRecorder) Input(p []byte) {
+	r.event("i", string(p))
+}
+
+// Resize records a terminal size change
+func (r *SessionRecorder) Resize(cols, rows uint16) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if !r.headerWritten {
+		r.header.Width, r.header.Height = cols, rows
+		r.mu.Unlock()
+		return
+	}
+	r.mu.Unlock()
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Close writes the header of a recording without events
+func (r *SessionRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.headerWritten {
+		r.writeHeaderLocked()
+	}
+	return r.err
+}
+
+// Size returns the number of bytes written so far
+func (r *SessionRecorder) Size() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.size
+}
+
+// Truncated reports whether events were dropped because of the size limit
+func (r *SessionRecorder) Truncated() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.truncated
+}
+
+// Err returns the first write error, if any
+func (r *SessionRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *SessionRecorder) event(code, data string) {
+	if r == nil || len(data) == 0 {
+		return
+	}
+	// Take the timestamp under the lock so that concurrent output and resize
+	// events are written in increasing time order
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	line, err := json.Marshal([]any{
+		float64(time.Since(r.start).Microseconds()) / 1e6,
+		code,
+		data,
+	})
+	if err != nil {
+		return
+	}
+	if !r.headerWritten {
+		r.writeHeaderLocked()
+	}
+	if r.err != nil || r.truncated {
+		return
+	}
+	if r.limit > 0 && r.size+int64(len(line))+1 > r.limit {
+		r.truncated = true
+		return
+	}
+	r.err = r.writeLineLocked(line)
+}
+
+func (r *SessionRecorder) writeHeaderLocked() {
+	r.headerWritten = true
+	header, err := json.Marshal(r.header)
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.err = r.writeLineLocked(header)
+}
+
+func (r *SessionRecorder) writeLineLocked(line []byte) error {
+	n, err := r.w.Write(append(line, '\n'))
+	r.size += int64(n)
+	return err
+}
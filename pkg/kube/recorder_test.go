@@ -0,0 +1,111 @@
+package kube
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSessionRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewSessionRecorder(&buf, "test", 80, 24, 0)
+	// The size reported before any output is the size of the header
+	r.Resize(100, 30)
+	r.Output([]byte("$ "))
+	r.Input([]byte("ls\r"))
+	r.Resize(120, 40)
+	r.Output(nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d: %q", len(lines), buf.String())
+	}
+
+	var header asciicastHeader
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		t.Fatalf("invalid header: %v", err)
+	}
+	if header.Version != 2 || header.Width != 100 || header.Height != 30 {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	expected := []struct{ code, data string }{{"o", "$ "}, {"i", "ls\r"}, {"r", "120x40"}}
+	for i, want := range expected {
+		var event []any
+		if err := json.Unmarshal([]byte(lines[i+1]), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", lines[i+1], err)
+		}
+		if len(event) != 3 || event[1] != want.code || event[2] != want.data {
+			t.Errorf("event %d = %v, want [_ %s %q]", i, event, want.code, want.data)
+		}
+	}
+	if r.Size() != int64(buf.Len()) {
+		t.Errorf("Size() = %d, want %d", r.Size(), buf.Len())
+	}
+}
+
+func TestSessionRecorderLimit(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewSessionRecorder(&buf, "", 80, 24, 200)
+	for range 10 {
+		r.Output([]byte("0123456789"))
+	}
+	if !r.Truncated() {
+		t.Errorf("expected recording to be truncated")
+	}
+	if int64(buf.Len()) > 200 {
+		t.Errorf("recording exceeded limit: %d bytes", buf.Len())
+	}
+
+	var nilRecorder *SessionRecorder
+	nilRecorder.Output([]byte("ignored"))
+	nilRecorder.Resize(80, 24)
+}
+
+func TestSessionRecorderEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewSessionRecorder(&buf, "", 80, 24, 0)
+	if buf.Len() != 0 {
+		t.Fatalf("header written before the first event: %q", buf.String())
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	var header asciicastHeader
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &header); err != nil || header.Width != 80 || header.Height != 24 {
+		t.Errorf("header = %q, %v, want the default size", buf.String(), err)
+	}
+}
+
+func TestSessionRecorderConcurrentEventsAreOrdered(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewSessionRecorder(&buf, "test", 80, 24, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				r.Output([]byte("x"))
+				r.Resize(uint16(80+j%2), 24)
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	last := 0.0
+	for _, line := range lines[1:] {
+		var event []any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		at := event[0].(float64)
+		if at < last {
+			t.Fatalf("event at %v written after event at %v", at, last)
+		}
+		last = at
+	}
+}
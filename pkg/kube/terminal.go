@@ -8,6 +8,7 @@ import (
 
 	"golang.org/x/net/websocket"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/klog/v2"
@@ -15,6 +16,9 @@ import (
 
 const EndOfTransmission = "\u0004"
 
+// DefaultShellCommand is run when a terminal session does not specify a command
+var DefaultShellCommand = []string{"sh", "-c", "bash || sh"}
+
 // TerminalMessage represents messages sent over the WebSocket
 type TerminalMessage struct {
 	Type string `json:"type"` // "stdin", "resize", "ping"
@@ -31,6 +35,8 @@ type TerminalSession struct {
 	namespace string
 	podName   string
 	container string
+	command   []string
+	recorder  *SessionRecorder
 
 	lastHeartbeat time.Time // Track last heartbeat for ping/pong
 }
@@ -46,6 +52,16 @@ func NewTerminalSession(client *K8sClient, conn *websocket.Conn, namespace, podN
 	}
 }
 
+// SetCommand sets the command run by an exec session, DefaultShellCommand is used when empty
+func (session *TerminalSession) SetCommand(command []string) {
+	session.command = command
+}
+
+// SetRecorder records all stdin, stdout and resize events of the session
+func (session *TerminalSession) SetRecorder(recorder *SessionRecorder) {
+	session.recorder = recorder
+}
+
 func (session *TerminalSession) Start(ctx context.Context, subResource string) error {
 	req := session.k8sClient.ClientSet.CoreV1().RESTClient().Post().
 		Resource("pods").
@@ -53,18 +69,33 @@ func (session *TerminalSession) Start(ctx context.Context, subResource string) e
 		Namespace(session.namespace).
 		SubResource(subResource)
 
-	// Set up exec parameters
-	req.VersionedParams(&corev1.PodExecOptions{
-		Container: session.container,
-		Command:   []string{"sh", "-c", "bash || sh"},
-		Stdin:     true,
-		Stdout:    true,
-		Stderr:    true,
-		TTY:       true,
-	}, scheme.ParameterCodec)
+	// Set up exec or attach parameters
+	var opts runtime.Object
+	if subResource == "attach" {
+		opts = &corev1.PodAttachOptions{
+			Container: session.container,
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    true,
+			TTY:       true,
+		}
+	} else {
+		command := session.command
+		if len(command) == 0 {
+			command = DefaultShellCommand
+		}
+		opts = &corev1.PodExecOptions{
+			Container: session.container,
+			Command:   command,
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    true,
+			TTY:       true,
+		}
+	}
+	req.VersionedParams(opts, scheme.ParameterCodec)
 
-	// TODO: use NewWebSocketExecutor
-	exec, err := remotecommand.NewSPDYExecutor(session.k8sClient.Configuration, "POST", req.URL())
+	exec, err := session.k8sClient.NewExecutor(req.URL())
 
 	if err != nil {
 		log.Printf("Failed to create executor: %v", err)
@@ -110,9 +141,11 @@ func (session *TerminalSession) Read(p []byte) (int, error) {
 	switch msg.Type {
 	case "stdin":
 		data := []byte(msg.Data)
+		session.recorder.Input(data)
 		return copy(p, data), nil
 	case "resize":
 		if msg.Rows > 0 && msg.Cols > 0 {
+			session.recorder.Resize(msg.Cols, msg.Rows)
 			select {
 			case session.sizeChan <- &remotecommand.TerminalSize{
 				Width:  msg.Cols,
@@ -140,6 +173,7 @@ func (session *TerminalSession) Write(p []byte) (int, error) {
 		log.Printf("Write stdout error: %v", err)
 		return 0, err
 	}
+	session.recorder.Output(p)
 	return len(p), nil
 }
 
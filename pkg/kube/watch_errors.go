@@ -0,0 +1,61 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// watchErrorWindow is how long a failed watch marks the cache as out of sync.
+// Reflectors retry with a backoff of at most 30s, a watch that keeps failing
+// reports a new error well within the window.
+const watchErrorWindow = 2 * time.Minute
+
+// watchErrors records the watches of an informer cache that failed recently,
+// the informers keep serving their last state in the meantime
+type watchErrors struct {
+	mu     sync.Mutex
+	errors map[string]watchError // key: the reflector's type description
+}
+
+type watchError struct {
+	message string
+	at      time.Time
+}
+
+// handle is the cache's DefaultWatchErrorHandler
+func (w *watchErrors) handle(_ context.Context, r *toolscache.Reflector, err error) {
+	// Expired resource versions and closed watches are part of the normal
+	// watch cycle, the reflector relists without losing sync
+	if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.errors == nil {
+		w.errors = make(map[string]watchError)
+	}
+	w.errors[r.TypeDescription()] = watchError{message: err.Error(), at: time.Now()}
+}
+
+// recent returns the errors of the watches that failed within the window before now
+func (w *watchErrors) recent(now time.Time) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []string
+	for typ, e := range w.errors {
+		if now.Sub(e.at) > watchErrorWindow {
+			delete(w.errors, typ)
+			continue
+		}
+		errs = append(errs, typ+": "+e.message)
+	}
+	sort.Strings(errs)
+	return errs
+}
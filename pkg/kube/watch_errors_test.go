@@ -0,0 +1,36 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+func TestWatchErrors(t *testing.T) {
+	r := toolscache.NewReflector(&toolscache.ListWatch{}, &corev1.Pod{}, toolscache.NewStore(toolscache.MetaNamespaceKeyFunc), 0)
+	w := &watchErrors{}
+	ctx := context.Background()
+
+	w.handle(ctx, r, io.EOF)
+	w.handle(ctx, r, apierrors.NewResourceExpired("too old resource version"))
+	if errs := w.recent(time.Now()); len(errs) != 0 {
+		t.Fatalf("recent() = %v, expected watch restarts are not errors", errs)
+	}
+
+	w.handle(ctx, r, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New("denied")))
+	errs := w.recent(time.Now())
+	if len(errs) != 1 || errs[0] != `*v1.Pod: pods is forbidden: denied` {
+		t.Fatalf("recent() = %q, want the forbidden watch", errs)
+	}
+	// A watch that stopped failing ages out
+	if errs := w.recent(time.Now().Add(watchErrorWindow + time.Second)); len(errs) != 0 {
+		t.Errorf("recent() after the window = %v, want none", errs)
+	}
+}
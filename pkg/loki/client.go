@@ -0,0 +1,168 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Labels used to select Kubernetes logs, as set by promtail, grafana agent and alloy
+const (
+	NamespaceLabel = "namespace"
+	PodLabel       = "pod"
+	ContainerLabel = "container"
+)
+
+// Client queries a Loki compatible log backend
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// Entry is a single log line
+type Entry struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Line      string            `json:"line"`
+	Labels    map[string]string `json:"labels"`
+}
+
+type queryRangeResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+func NewClientWithRoundTripper(lokiURL string, rt http.RoundTripper) (*Client, error) {
+	if lokiURL == "" {
+		return nil, fmt.Errorf("loki URL cannot be empty")
+	}
+	u, err := url.Parse(lokiURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid loki URL: %s", lokiURL)
+	}
+	return &Client{
+		baseURL: strings.TrimRight(lokiURL, "/"),
+		client:  &http.Client{Transport: rt, Timeout: 60 * time.Second},
+	}, nil
+}
+
+// QueryRange runs a LogQL log query between start and end, returning the
+// newest limit entries sorted by time in ascending order
+func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, limit int) ([]Entry, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	params.Set("limit", strconv.Itoa(limit))
+	// Backward returns the newest lines when the range has more than limit
+	params.Set("direction", "backward")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/loki/api/v1/query_range?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error querying loki: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("loki returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result queryRangeResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("error decoding loki response: %w", err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("loki query failed: %s", result.Error)
+	}
+	if result.Data.ResultType != "streams" {
+		return nil, fmt.Errorf("unexpected loki result type: %s", result.Data.ResultType)
+	}
+
+	var entries []Entry
+	for _, stream := range result.Data.Result {
+		for _, v := range stream.Values {
+			ns, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, Entry{
+				Timestamp: time.Unix(0, ns),
+				Line:      strings.TrimRight(v[1], "\n"),
+				Labels:    stream.Stream,
+			})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+// PodLogQuery returns the LogQL selector for the logs of pods in a namespace,
+// an empty container matches all containers
+func PodLogQuery(namespace string, pods []string, container string) string {
+	matchers := []string{fmt.Sprintf("%s=%s", NamespaceLabel, strconv.Quote(namespace))}
+	if len(pods) == 1 {
+		matchers = append(matchers, fmt.Sprintf("%s=%s", PodLabel, strconv.Quote(pods[0])))
+	} else if len(pods) > 1 {
+		quoted := make([]string, 0, len(pods))
+		for _, pod := range pods {
+			quoted = append(quoted, regexpQuote(pod))
+		}
+		matchers = append(matchers, fmt.Sprintf("%s=~%s", PodLabel, strconv.Quote(strings.Join(quoted, "|"))))
+	}
+	if container != "" {
+		matchers = append(matchers, fmt.Sprintf("%s=%s", ContainerLabel, strconv.Quote(container)))
+	}
+	return "{" + strings.Join(matchers, ", ") + "}"
+}
+
+// PodPatternLogQuery returns the LogQL selector for the logs of the pods in a
+// namespace whose name matches the regular expression podPattern, e.g. the
+// current and past pods of a workload
+func PodPatternLogQuery(namespace, podPattern, container string) string {
+	matchers := []string{
+		fmt.Sprintf("%s=%s", NamespaceLabel, strconv.Quote(namespace)),
+		fmt.Sprintf("%s=~%s", PodLabel, strconv.Quote(podPattern)),
+	}
+	if container != "" {
+		matchers = append(matchers, fmt.Sprintf("%s=%s", ContainerLabel, strconv.Quote(container)))
+	}
+	return "{" + strings.Join(matchers, ", ") + "}"
+}
+
+func regexpQuote(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`\.+*?()|[]{}^$`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
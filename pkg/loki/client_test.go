@@ -0,0 +1,85 @@
+package loki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPodLogQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		pods      []string
+		container string
+		want      string
+	}{
+		{"namespace only", nil, "", `{namespace="default"}`},
+		{"single pod", []string{"web-0"}, "app", `{namespace="default", pod="web-0", container="app"}`},
+		{"multiple pods", []string{"web-0", "web.1"}, "", `{namespace="default", pod=~"web-0|web\\.1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PodLogQuery("default", tt.pods, tt.container); got != tt.want {
+				t.Errorf("PodLogQuery() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodPatternLogQuery(t *testing.T) {
+	got := PodPatternLogQuery("default", `web-[a-z0-9]{1,10}-[a-z0-9]{5}`, "app")
+	want := `{namespace="default", pod=~"web-[a-z0-9]{1,10}-[a-z0-9]{5}", container="app"}`
+	if got != want {
+		t.Errorf("PodPatternLogQuery() = %s, want %s", got, want)
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	start, end := time.Unix(0, 1700000000000000000), time.Unix(0, 1700000000000000009)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/query_range" {
+			http.NotFound(w, r)
+			return
+		}
+		want := url.Values{
+			"query":     {`{namespace="default"}`},
+			"start":     {"1700000000000000000"},
+			"end":       {"1700000000000000009"},
+			"limit":     {"2"},
+			"direction": {"backward"},
+		}
+		if !reflect.DeepEqual(r.URL.Query(), want) {
+			http.Error(w, "bad query: "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		// Backward queries return the newest lines, newest first
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"pod":"b","container":"app"},"values":[["1700000000000000002","second\n"]]},
+			{"stream":{"pod":"a","container":"app"},"values":[["1700000000000000003","third"],["1700000000000000001","first"]]}
+		]}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithRoundTripper(server.URL+"/", http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("NewClientWithRoundTripper() error = %v", err)
+	}
+	entries, err := client.QueryRange(context.Background(), `{namespace="default"}`, start, end, 2)
+	if err != nil {
+		t.Fatalf("QueryRange() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("QueryRange() returned %d entries, want 2", len(entries))
+	}
+	if entries[0].Line != "second" || entries[1].Line != "third" || entries[0].Labels["pod"] != "b" {
+		t.Errorf("QueryRange() = %+v, want the newest entries in ascending order", entries)
+	}
+
+	if _, err := client.QueryRange(context.Background(), `{namespace="other"}`, start, end, 10); err == nil {
+		t.Error("expected error for a failed query")
+	}
+}
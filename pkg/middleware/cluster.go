@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"errors"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
-	"github.com/zxh326/kite/pkg/cluster"
+	kitecluster "github.com/zxh326/kite/pkg/cluster"
 )
 
 const (
@@ -13,7 +16,7 @@ const (
 )
 
 // ClusterMiddleware extracts cluster name from header and injects clients into context
-func ClusterMiddleware(cm *cluster.ClusterManager) gin.HandlerFunc {
+func ClusterMiddleware(cm *kitecluster.ClusterManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		clusterName := c.GetHeader(ClusterNameHeader)
 		if clusterName == "" {
@@ -24,12 +27,21 @@ func ClusterMiddleware(cm *cluster.ClusterManager) gin.HandlerFunc {
 				clusterName, _ = c.Cookie(ClusterNameHeader)
 			}
 		}
-		cluster, err := cm.GetClientSet(clusterName)
+		// The ClientSet is held for the whole request, so terminals and watches
+		// keep working when the cluster is updated while they are open
+		cluster, release, err := cm.AcquireClientSet(clusterName)
+		if errors.Is(err, kitecluster.ErrClusterWarmingUp) {
+			c.Header("Retry-After", "5")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "warmingUp": true})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(404, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
+		defer release()
 		c.Set("cluster", cluster)
 		c.Set(ClusterNameKey, cluster.Name)
 		c.Next()
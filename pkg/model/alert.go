@@ -0,0 +1,120 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AlertConditionCrashLoop             = "crash_loop"
+	AlertConditionNodeNotReady          = "node_not_ready"
+	AlertConditionDeploymentUnavailable = "deployment_unavailable"
+	AlertConditionPVCAlmostFull         = "pvc_almost_full"
+	AlertConditionCertificateExpiry     = "certificate_expiry"
+
+	AlertTargetWebhook = "webhook"
+	AlertTargetSlack   = "slack"
+
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+)
+
+// AlertRule is an admin defined condition evaluated against every cluster in scope
+type AlertRule struct {
+	Model
+	Name        string `json:"name" gorm:"type:varchar(255);uniqueIndex;not null"`
+	Description string `json:"description" gorm:"type:text"`
+	Enabled     bool   `json:"enabled" gorm:"type:boolean"`
+	Condition   string `json:"condition" gorm:"type:varchar(50);not null"`
+	Severity    string `json:"severity" gorm:"type:varchar(20)"`
+	// Clusters and Namespaces limit the rule, empty means all
+	Clusters   SliceString `json:"clusters" gorm:"type:text"`
+	Namespaces SliceString `json:"namespaces" gorm:"type:text"`
+	// ForMinutes is how long the condition must hold before the alert fires
+	ForMinutes int `json:"forMinutes"`
+	// Threshold is the used percentage for PVCs and the remaining days for certificates
+	Threshold float64 `json:"threshold"`
+	// RepeatMinutes re-sends firing alerts after this many minutes, 0 never repeats
+	RepeatMinutes int `json:"repeatMinutes"`
+
+	Targets []AlertTarget `json:"targets" gorm:"many2many:alert_rule_targets;constraint:OnDelete:CASCADE"`
+}
+
+// AlertTarget is a webhook that receives notifications, either the generic
+// JSON payload or a Slack compatible message
+type AlertTarget struct {
+	Model
+	Name    string       `json:"name" gorm:"type:varchar(255);uniqueIndex;not null"`
+	Type    string       `json:"type" gorm:"type:varchar(20);not null"`
+	URL     SecretString `json:"-" gorm:"type:text"`
+	Enabled bool         `json:"enabled" gorm:"type:boolean"`
+}
+
+// AlertSilence suppresses notifications of matching alerts until EndsAt,
+// empty fields match every alert
+type AlertSilence struct {
+	Model
+	RuleID    uint      `json:"ruleId" gorm:"index"`
+	Cluster   string    `json:"cluster" gorm:"type:varchar(100)"`
+	Namespace string    `json:"namespace" gorm:"type:varchar(100)"`
+	Name      string    `json:"name" gorm:"type:varchar(255)"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt" gorm:"index"`
+	Comment   string    `json:"comment" gorm:"type:text"`
+	CreatedBy string    `json:"createdBy" gorm:"type:varchar(255)"`
+}
+
+// AlertNotification is the delivery record of one notification to one target
+type AlertNotification struct {
+	Model
+	RuleID     uint   `json:"ruleId" gorm:"index"`
+	RuleName   string `json:"ruleName" gorm:"type:varchar(255)"`
+	Cluster    string `json:"cluster" gorm:"type:varchar(100);index"`
+	Status     string `json:"status" gorm:"type:varchar(20)"`
+	GroupKey   string `json:"groupKey" gorm:"type:varchar(255)"`
+	AlertCount int    `json:"alertCount"`
+	// Payload is the generic JSON notification that was sent
+	Payload    string `json:"payload" gorm:"type:text"`
+	TargetID   uint   `json:"targetId" gorm:"index"`
+	TargetName string `json:"targetName" gorm:"type:varchar(255)"`
+	Success    bool   `json:"success" gorm:"type:boolean"`
+	Error      string `json:"error" gorm:"type:text"`
+}
+
+// ListEnabledAlertRules returns the enabled rules with their targets
+func ListEnabledAlertRules() ([]AlertRule, error) {
+	var rules []AlertRule
+	if err := DB.Preload("Targets").Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// ListActiveAlertSilences returns the silences in effect at the given time
+func ListActiveAlertSilences(now time.Time) ([]AlertSilence, error) {
+	var silences []AlertSilence
+	if err := DB.Where("starts_at <= ? AND ends_at > ?", now, now).Find(&silences).Error; err != nil {
+		return nil, err
+	}
+	return silences, nil
+}
+
+func AddAlertNotification(n *AlertNotification) error {
+	return DB.Create(n).Error
+}
+
+// TrimAlertNotifications keeps only the max most recent notification records
+func TrimAlertNotifications(max int) (int64, error) {
+	var cutoff AlertNotification
+	err := DB.Select("id").Order("id desc").Offset(max).Limit(1).First(&cutoff).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	res := DB.Where("id <= ?", cutoff.ID).Delete(&AlertNotification{})
+	return res.RowsAffected, res.Error
+}
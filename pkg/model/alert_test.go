@@ -0,0 +1,40 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTrimAlertNotifications(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&AlertNotification{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	prev := DB
+	DB = db
+	t.Cleanup(func() { DB = prev })
+
+	if n, err := TrimAlertNotifications(2); err != nil || n != 0 {
+		t.Fatalf("TrimAlertNotifications() on an empty table = %d, %v", n, err)
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := AddAlertNotification(&AlertNotification{RuleName: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := TrimAlertNotifications(2); err != nil || n != 2 {
+		t.Fatalf("TrimAlertNotifications() = %d, %v, want 2", n, err)
+	}
+	var kept []AlertNotification
+	if err := DB.Order("id").Find(&kept).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 2 || kept[0].RuleName != "c" || kept[1].RuleName != "d" {
+		t.Errorf("kept = %+v, want the 2 most recent", kept)
+	}
+}
@@ -1,14 +1,53 @@
 package model
 
+const (
+	ClusterAuthKubeconfig  = "kubeconfig"
+	ClusterAuthToken       = "token"
+	ClusterAuthCertificate = "certificate"
+)
+
 type Cluster struct {
 	Model
-	Name          string       `json:"name" gorm:"type:varchar(100);uniqueIndex;not null"`
-	Description   string       `json:"description" gorm:"type:text"`
-	Config        SecretString `json:"config" gorm:"type:text"`
-	PrometheusURL string       `json:"prometheus_url,omitempty" gorm:"type:varchar(255)"`
-	InCluster     bool         `json:"in_cluster" gorm:"type:boolean;default:false"`
-	IsDefault     bool         `json:"is_default" gorm:"type:boolean;default:false"`
-	Enable        bool         `json:"enable" gorm:"type:boolean;default:true"`
+	Name        string `json:"name" gorm:"type:varchar(100);uniqueIndex;not null"`
+	Description string `json:"description" gorm:"type:text"`
+	// Labels, e.g. env=prod, filter the cluster list and match role cluster selectors
+	Labels StringMap    `json:"labels" gorm:"type:text"`
+	Config SecretString `json:"config" gorm:"type:text"`
+	// AuthType selects the credentials of clusters that are not in-cluster:
+	// kubeconfig (default) uses Config, token and certificate use the fields below
+	AuthType   string       `json:"auth_type,omitempty" gorm:"type:varchar(20)"`
+	Server     string       `json:"server,omitempty" gorm:"type:varchar(255)"`
+	CAData     SecretString `json:"-" gorm:"type:text"`
+	Token      SecretString `json:"-" gorm:"type:text"`
+	ClientCert SecretString `json:"-" gorm:"type:text"`
+	ClientKey  SecretString `json:"-" gorm:"type:text"`
+	// ProxyURL is an http(s) or socks5 proxy to the API server, e.g. a bastion,
+	// ProxyUsername and ProxyPassword are its credentials
+	ProxyURL      string       `json:"proxy_url,omitempty" gorm:"type:varchar(255)"`
+	ProxyUsername string       `json:"proxy_username,omitempty" gorm:"type:varchar(255)"`
+	ProxyPassword SecretString `json:"-" gorm:"type:text"`
+	// TLSServerName overrides the server name verified against the API server certificate
+	TLSServerName string `json:"tls_server_name,omitempty" gorm:"type:varchar(255)"`
+	PrometheusURL string `json:"prometheus_url,omitempty" gorm:"type:varchar(255)"`
+	// LokiURL is a Loki compatible backend queried for historical pod logs
+	LokiURL   string `json:"loki_url,omitempty" gorm:"type:varchar(255)"`
+	InCluster bool   `json:"in_cluster" gorm:"type:boolean;default:false"`
+	IsDefault bool   `json:"is_default" gorm:"type:boolean;default:false"`
+	Enable    bool   `json:"enable" gorm:"type:boolean;default:true"`
+	// ExecProtocol overrides the exec/attach streaming protocol: auto, websocket or spdy
+	ExecProtocol string `json:"exec_protocol,omitempty" gorm:"type:varchar(20)"`
+	// RecordEvents archives Warning events of the cluster, RecordNormalEvents adds Normal events
+	RecordEvents       bool `json:"record_events" gorm:"type:boolean;default:false"`
+	RecordNormalEvents bool `json:"record_normal_events" gorm:"type:boolean;default:false"`
+	// AlwaysOn connects the cluster at startup and never disconnects it when idle
+	AlwaysOn bool `json:"always_on" gorm:"type:boolean;default:false"`
+	// CacheNamespaces limits the informer cache to these namespaces, empty caches all namespaces
+	CacheNamespaces SliceString `json:"cache_namespaces" gorm:"type:text"`
+	// CacheUncachedResources are always read from the API server, e.g. secrets
+	CacheUncachedResources SliceString `json:"cache_uncached_resources" gorm:"type:text"`
+	// CacheStripManagedFields and CacheMaxAnnotationSize shrink the objects held in the cache
+	CacheStripManagedFields bool `json:"cache_strip_managed_fields" gorm:"type:boolean;default:false"`
+	CacheMaxAnnotationSize  int  `json:"cache_max_annotation_size"`
 }
 
 func AddCluster(cluster *Cluster) error {
@@ -124,3 +124,24 @@ func equalSliceString(a, b SliceString) bool {
 	}
 	return true
 }
+
+func TestStringMap(t *testing.T) {
+	var m StringMap
+	if err := m.Scan(""); err != nil || m != nil {
+		t.Errorf("Scan(\"\") got = %v, %v", m, err)
+	}
+	if err := m.Scan([]byte(`{"env":"prod"}`)); err != nil || m["env"] != "prod" {
+		t.Errorf("Scan() got = %v, %v", m, err)
+	}
+	if err := m.Scan(1); err == nil {
+		t.Error("Scan(1) expected an error")
+	}
+
+	v, err := StringMap{"env": "prod", "region": "eu"}.Value()
+	if err != nil || v != `{"env":"prod","region":"eu"}` {
+		t.Errorf("Value() got = %v, %v", v, err)
+	}
+	if v, _ := StringMap(nil).Value(); v != "" {
+		t.Errorf("Value() of nil got = %v", v)
+	}
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ArchivedEvent is a Kubernetes event persisted by the event recorder of a
+// cluster. Occurrences of the same reason on the same object are folded into
+// one row, Count is the total number of occurrences seen.
+type ArchivedEvent struct {
+	Model
+	ClusterName  string `json:"clusterName" gorm:"type:varchar(100);not null;uniqueIndex:idx_archived_events_key,priority:1"`
+	Namespace    string `json:"namespace" gorm:"type:varchar(100);uniqueIndex:idx_archived_events_key,priority:2"`
+	InvolvedKind string `json:"involvedKind" gorm:"type:varchar(100);not null;uniqueIndex:idx_archived_events_key,priority:3"`
+	InvolvedName string `json:"involvedName" gorm:"type:varchar(253);not null;uniqueIndex:idx_archived_events_key,priority:4"`
+	Reason       string `json:"reason" gorm:"type:varchar(128);uniqueIndex:idx_archived_events_key,priority:5"`
+	InvolvedUID  string `json:"involvedUID" gorm:"type:varchar(64)"`
+
+	Type    string `json:"type" gorm:"type:varchar(20);index"`
+	Message string `json:"message" gorm:"type:text"`
+	Source  string `json:"source" gorm:"type:varchar(255)"`
+	Count   int32  `json:"count"`
+
+	FirstTimestamp time.Time `json:"firstTimestamp"`
+	LastTimestamp  time.Time `json:"lastTimestamp" gorm:"index"`
+
+	// LastEventUID and LastEventCount identify the Kubernetes event last
+	// folded into this row, so repeated updates of it are not counted twice
+	LastEventUID   string `json:"-" gorm:"type:varchar(64)"`
+	LastEventCount int32  `json:"-"`
+}
+
+// ArchiveEvent inserts ev or folds it into the row of the same object and reason
+func ArchiveEvent(ev *ArchivedEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var existing ArchivedEvent
+		err := tx.Where("cluster_name = ? AND namespace = ? AND involved_kind = ? AND involved_name = ? AND reason = ?",
+			ev.ClusterName, ev.Namespace, ev.InvolvedKind, ev.InvolvedName, ev.Reason).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ev.Count = ev.LastEventCount
+			return tx.Create(ev).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case existing.LastEventUID == ev.LastEventUID:
+			if ev.LastEventCount <= existing.LastEventCount {
+				return nil
+			}
+			existing.Count += ev.LastEventCount - existing.LastEventCount
+		case ev.LastTimestamp.After(existing.LastTimestamp):
+			existing.Count += ev.LastEventCount
+		default:
+			// An older event, e.g. replayed after a restart, is already counted
+			return nil
+		}
+		existing.InvolvedUID = ev.InvolvedUID
+		existing.Type = ev.Type
+		existing.Message = ev.Message
+		existing.Source = ev.Source
+		existing.LastEventUID = ev.LastEventUID
+		existing.LastEventCount = ev.LastEventCount
+		if ev.FirstTimestamp.Before(existing.FirstTimestamp) {
+			existing.FirstTimestamp = ev.FirstTimestamp
+		}
+		if ev.LastTimestamp.After(existing.LastTimestamp) {
+			existing.LastTimestamp = ev.LastTimestamp
+		}
+		return tx.Save(&existing).Error
+	})
+}
+
+// ArchivedEventQuery selects archived events, empty fields match everything
+type ArchivedEventQuery struct {
+	ClusterName  string
+	Namespace    string
+	InvolvedKind string
+	InvolvedName string
+	Since        time.Time
+	Until        time.Time
+	Limit        int
+}
+
+// ListArchivedEvents returns the matching events, most recent first
+func ListArchivedEvents(q ArchivedEventQuery) ([]ArchivedEvent, error) {
+	db := DB.Where("cluster_name = ?", q.ClusterName)
+	if q.Namespace != "" {
+		db = db.Where("namespace = ?", q.Namespace)
+	}
+	if q.InvolvedKind != "" {
+		db = db.Where("involved_kind = ?", q.InvolvedKind)
+	}
+	if q.InvolvedName != "" {
+		db = db.Where("involved_name = ?", q.InvolvedName)
+	}
+	if !q.Since.IsZero() {
+		db = db.Where("last_timestamp >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		db = db.Where("first_timestamp <= ?", q.Until)
+	}
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+	var events []ArchivedEvent
+	if err := db.Order("last_timestamp desc").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// DeleteArchivedEventsBefore deletes events last seen before the given time
+func DeleteArchivedEventsBefore(before time.Time) (int64, error) {
+	res := DB.Where("last_timestamp < ?", before).Delete(&ArchivedEvent{})
+	return res.RowsAffected, res.Error
+}
+
+// TrimArchivedEvents keeps only the max most recently seen events of a cluster
+func TrimArchivedEvents(clusterName string, max int) (int64, error) {
+	var cutoff ArchivedEvent
+	err := DB.Select("last_timestamp").Where("cluster_name = ?", clusterName).
+		Order("last_timestamp desc").Offset(max).Limit(1).First(&cutoff).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	res := DB.Where("cluster_name = ? AND last_timestamp <= ?", clusterName, cutoff.LastTimestamp).Delete(&ArchivedEvent{})
+	return res.RowsAffected, res.Error
+}
+
+// ListArchivedEventClusters returns the names of clusters with archived events
+func ListArchivedEventClusters() ([]string, error) {
+	var names []string
+	err := DB.Model(&ArchivedEvent{}).Distinct("cluster_name").Pluck("cluster_name", &names).Error
+	return names, err
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupEventTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&ArchivedEvent{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	prev := DB
+	DB = db
+	t.Cleanup(func() { DB = prev })
+}
+
+func TestArchiveEvent(t *testing.T) {
+	setupEventTestDB(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(uid string, count int32, last time.Time) *ArchivedEvent {
+		return &ArchivedEvent{
+			ClusterName: "c1", Namespace: "default", InvolvedKind: "Pod", InvolvedName: "web-0", Reason: "BackOff",
+			Type: "Warning", Message: "back-off", FirstTimestamp: base, LastTimestamp: last,
+			LastEventUID: uid, LastEventCount: count,
+		}
+	}
+
+	steps := []struct {
+		name string
+		ev   *ArchivedEvent
+		want int32
+	}{
+		{"new event", event("a", 2, base.Add(time.Minute)), 2},
+		{"same event counted again", event("a", 5, base.Add(2*time.Minute)), 5},
+		{"same event replayed", event("a", 5, base.Add(2*time.Minute)), 5},
+		{"new event of the same reason", event("b", 3, base.Add(time.Hour)), 8},
+		{"older event is already counted", event("a", 5, base.Add(2*time.Minute)), 8},
+	}
+	for _, step := range steps {
+		if err := ArchiveEvent(step.ev); err != nil {
+			t.Fatalf("%s: ArchiveEvent() error = %v", step.name, err)
+		}
+		events, err := ListArchivedEvents(ArchivedEventQuery{ClusterName: "c1"})
+		if err != nil {
+			t.Fatalf("%s: ListArchivedEvents() error = %v", step.name, err)
+		}
+		if len(events) != 1 || events[0].Count != step.want {
+			t.Fatalf("%s: got %d rows, count %d, want 1 row, count %d", step.name, len(events), events[0].Count, step.want)
+		}
+	}
+
+	other := event("c", 1, base.Add(3*time.Hour))
+	other.Reason = "Unhealthy"
+	if err := ArchiveEvent(other); err != nil {
+		t.Fatalf("ArchiveEvent() error = %v", err)
+	}
+	events, _ := ListArchivedEvents(ArchivedEventQuery{ClusterName: "c1", Since: base.Add(2 * time.Hour)})
+	if len(events) != 1 || events[0].Reason != "Unhealthy" {
+		t.Fatalf("ListArchivedEvents(since) = %+v, want only Unhealthy", events)
+	}
+
+	if n, err := TrimArchivedEvents("c1", 1); err != nil || n != 1 {
+		t.Fatalf("TrimArchivedEvents() = %d, %v, want 1", n, err)
+	}
+	if n, err := DeleteArchivedEventsBefore(base.Add(4 * time.Hour)); err != nil || n != 1 {
+		t.Fatalf("DeleteArchivedEventsBefore() = %d, %v, want 1", n, err)
+	}
+}
@@ -98,6 +98,12 @@ func InitDB() {
 		RoleAssignment{},
 		ResourceHistory{},
 		ResourceTemplate{},
+		TerminalRecording{},
+		ArchivedEvent{},
+		AlertRule{},
+		AlertTarget{},
+		AlertSilence{},
+		AlertNotification{},
 	}
 	for _, model := range models {
 		err = DB.AutoMigrate(model)
@@ -8,10 +8,13 @@ type Role struct {
 	IsSystem    bool   `json:"isSystem" gorm:"type:boolean;not null;default:false"`
 
 	// Rules
-	Clusters   SliceString `json:"clusters" gorm:"type:text"`
-	Resources  SliceString `json:"resources" gorm:"type:text"`
-	Namespaces SliceString `json:"namespaces" gorm:"type:text"`
-	Verbs      SliceString `json:"verbs" gorm:"type:text"`
+	Clusters SliceString `json:"clusters" gorm:"type:text"`
+	// ClusterSelector is a label selector, e.g. env!=prod, matching clusters besides Clusters
+	ClusterSelector string      `json:"clusterSelector" gorm:"type:text"`
+	Resources       SliceString `json:"resources" gorm:"type:text"`
+	Namespaces      SliceString `json:"namespaces" gorm:"type:text"`
+	Verbs           SliceString `json:"verbs" gorm:"type:text"`
+	Commands        SliceString `json:"commands" gorm:"type:text"`
 
 	Assignments []RoleAssignment `json:"assignments" gorm:"foreignKey:RoleID;constraint:OnDelete:CASCADE"`
 }
@@ -42,6 +45,7 @@ var (
 		Resources:   []string{"*"},
 		Namespaces:  []string{"*"},
 		Verbs:       []string{"*"},
+		Commands:    []string{"*"},
 	}
 	DefaultViewerRole = Role{
 		Name:        "viewer",
@@ -81,6 +85,13 @@ func InitDefaultRole() error {
 	if err = DB.Where("name = ?", DefaultAdminRole.Name).FirstOrCreate(&DefaultAdminRole).Error; err != nil {
 		return err
 	}
+	// admin roles created before terminal commands existed
+	if len(DefaultAdminRole.Commands) == 0 || (len(DefaultAdminRole.Commands) == 1 && DefaultAdminRole.Commands[0] == "") {
+		DefaultAdminRole.Commands = []string{"*"}
+		if err = DB.Model(&DefaultAdminRole).Update("commands", DefaultAdminRole.Commands).Error; err != nil {
+			return err
+		}
+	}
 	if err = DB.Where("name = ?", DefaultViewerRole.Name).FirstOrCreate(&DefaultViewerRole).Error; err != nil {
 		return err
 	}
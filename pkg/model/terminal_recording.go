@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	TerminalSessionTypePod  = "pod"
+	TerminalSessionTypeNode = "node"
+
+	RecordingStorageDB   = "db"
+	RecordingStorageFile = "file"
+)
+
+// TerminalRecording is an asciinema v2 recording of an interactive terminal session
+type TerminalRecording struct {
+	Model
+	ClusterName string `json:"clusterName" gorm:"type:varchar(100);not null;index"`
+	SessionType string `json:"sessionType" gorm:"type:varchar(20);not null;index"`
+	Namespace   string `json:"namespace" gorm:"type:varchar(100);index"`
+	PodName     string `json:"podName" gorm:"type:varchar(255);index"`
+	Container   string `json:"container" gorm:"type:varchar(255)"`
+	NodeName    string `json:"nodeName,omitempty" gorm:"type:varchar(255)"`
+	Command     string `json:"command,omitempty" gorm:"type:text"`
+
+	StartedAt time.Time  `json:"startedAt" gorm:"index"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	Size      int64      `json:"size"`
+	Truncated bool       `json:"truncated" gorm:"type:boolean;default:false"`
+
+	Storage  string `json:"storage" gorm:"type:varchar(20);not null"`
+	FilePath string `json:"-" gorm:"type:varchar(500)"`
+	Data     string `json:"-"`
+
+	// OperatorID is cleared when the user is deleted, recordings are kept for
+	// auditing and OperatorName still names the user
+	OperatorID   *uint  `json:"operatorId" gorm:"index"`
+	OperatorName string `json:"operatorName" gorm:"type:varchar(255)"`
+	Operator     *User  `json:"operator" gorm:"foreignKey:OperatorID;constraint:OnDelete:SET NULL"`
+}
+
+func GetTerminalRecordingByID(id uint) (*TerminalRecording, error) {
+	var recording TerminalRecording
+	if err := DB.Preload("Operator").First(&recording, id).Error; err != nil {
+		return nil, err
+	}
+	return &recording, nil
+}
+
+// ListExpiredTerminalRecordings returns recordings started before the given time
+func ListExpiredTerminalRecordings(before time.Time) ([]TerminalRecording, error) {
+	var recordings []TerminalRecording
+	if err := DB.Select("id", "storage", "file_path").Where("started_at < ?", before).Find(&recordings).Error; err != nil {
+		return nil, err
+	}
+	return recordings, nil
+}
+
+func DeleteTerminalRecording(recording *TerminalRecording) error {
+	return DB.Delete(recording).Error
+}
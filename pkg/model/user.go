@@ -175,6 +175,8 @@ func LoginUser(u *User) error {
 // DeleteUserByID removes a user by ID
 func DeleteUserByID(id uint) error {
 	_ = DB.Where("operator_id = ?", id).Delete(&ResourceHistory{}).Error
+	// Terminal recordings are audit records, they outlive their operator
+	_ = DB.Model(&TerminalRecording{}).Where("operator_id = ?", id).Update("operator_id", nil).Error
 	return DB.Delete(&User{}, id).Error
 }
 
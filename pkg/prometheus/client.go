@@ -405,3 +405,26 @@ func (c *Client) GetPodMetrics(ctx context.Context, namespace, podName, containe
 		Fallback:   false,
 	}, nil
 }
+
+// GetPVCUsage returns the used fraction of every PVC reported by the kubelets,
+// keyed by namespace/name
+func (c *Client) GetPVCUsage(ctx context.Context) (map[string]float64, error) {
+	query := `max by (namespace, persistentvolumeclaim) (kubelet_volume_stats_used_bytes / kubelet_volume_stats_capacity_bytes)`
+	result, warnings, err := c.client.Query(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		klog.V(1).Infof("PVC usage query warnings: %v", warnings)
+	}
+	vector, ok := result.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %s", result.Type())
+	}
+	usage := make(map[string]float64, len(vector))
+	for _, sample := range vector {
+		key := string(sample.Metric["namespace"]) + "/" + string(sample.Metric["persistentvolumeclaim"])
+		usage[key] = float64(sample.Value)
+	}
+	return usage, nil
+}
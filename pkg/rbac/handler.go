@@ -45,6 +45,10 @@ func CreateRole(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "role name is required"})
 		return
 	}
+	if _, err := ParseClusterSelector(role.ClusterSelector); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid clusterSelector: " + err.Error()})
+		return
+	}
 	if err := model.DB.Create(&role).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create role: " + err.Error()})
 		return
@@ -70,6 +74,10 @@ func UpdateRole(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if _, err := ParseClusterSelector(req.ClusterSelector); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid clusterSelector: " + err.Error()})
+		return
+	}
 	var role model.Role
 	if err := model.DB.First(&role, uint(dbID)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
@@ -79,9 +87,11 @@ func UpdateRole(c *gin.Context) {
 	role.Name = req.Name
 	role.Description = req.Description
 	role.Clusters = req.Clusters
+	role.ClusterSelector = req.ClusterSelector
 	role.Namespaces = req.Namespaces
 	role.Resources = req.Resources
 	role.Verbs = req.Verbs
+	role.Commands = req.Commands
 
 	if err := model.DB.Save(&role).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update role: " + err.Error()})
@@ -39,12 +39,14 @@ func loadRolesFromDB() error {
 
 	for _, r := range roles {
 		cr := common.Role{
-			Name:        r.Name,
-			Description: r.Description,
-			Clusters:    r.Clusters,
-			Namespaces:  r.Namespaces,
-			Resources:   r.Resources,
-			Verbs:       r.Verbs,
+			Name:            r.Name,
+			Description:     r.Description,
+			Clusters:        r.Clusters,
+			ClusterSelector: r.ClusterSelector,
+			Namespaces:      r.Namespaces,
+			Resources:       r.Resources,
+			Verbs:           r.Verbs,
+			Commands:        r.Commands,
 		}
 		cfg.Roles = append(cfg.Roles, cr)
 
@@ -60,6 +62,7 @@ func loadRolesFromDB() error {
 			cfg.RoleMapping = append(cfg.RoleMapping, rm)
 		}
 	}
+	setClusterSelectors(cfg.Roles)
 	rwlock.Lock()
 	RBACConfig = cfg
 	rwlock.Unlock()
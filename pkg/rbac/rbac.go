@@ -2,20 +2,39 @@ package rbac
 
 import (
 	"fmt"
+	"path"
 	"regexp"
 	"slices"
 	"strings"
+	"sync/atomic"
 
 	"github.com/zxh326/kite/pkg/common"
 	"github.com/zxh326/kite/pkg/model"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/klog/v2"
 )
 
+// clusterLabels holds the labels of every registered cluster, set by the cluster manager
+var clusterLabels atomic.Pointer[map[string]labels.Set]
+
+// clusterSelectors holds the parsed cluster selectors of the loaded roles
+var clusterSelectors atomic.Pointer[map[string]labels.Selector]
+
+// SetClusterLabels replaces the labels matched by role cluster selectors
+func SetClusterLabels(clusters map[string]map[string]string) {
+	m := make(map[string]labels.Set, len(clusters))
+	for name, l := range clusters {
+		m[name] = labels.Set(l)
+	}
+	clusterLabels.Store(&m)
+}
+
 // CanAccess checks if user/oidcGroup can access resource with verb in cluster/namespace
 func CanAccess(user model.User, resource, verb, cluster, namespace string) bool {
 	roles := GetUserRoles(user)
 	for _, role := range roles {
-		if match(role.Clusters, cluster) &&
+		if matchCluster(role, cluster) &&
 			match(role.Namespaces, namespace) &&
 			match(role.Resources, resource) &&
 			match(role.Verbs, verb) {
@@ -29,10 +48,32 @@ func CanAccess(user model.User, resource, verb, cluster, namespace string) bool
 	return false
 }
 
+// CanExecCommand checks if user may run command in a pod terminal. The default
+// shell only needs the exec verb, any other command must also be allowed by the
+// commands list of a role granting exec. Commands are matched by executable name.
+func CanExecCommand(user model.User, cluster, namespace string, command []string) bool {
+	if len(command) == 0 {
+		return false
+	}
+	roles := GetUserRoles(user)
+	for _, role := range roles {
+		if matchCluster(role, cluster) &&
+			match(role.Namespaces, namespace) &&
+			match(role.Resources, "pods") &&
+			match(role.Verbs, string(common.VerbExec)) &&
+			matchCommand(role.Commands, command[0]) {
+			return true
+		}
+	}
+	klog.V(1).Infof("RBAC Check - User: %s, Command: %v, Cluster: %s, Namespace: %s, No Access",
+		user.Key(), command, cluster, namespace)
+	return false
+}
+
 func CanAccessCluster(user model.User, name string) bool {
 	roles := GetUserRoles(user)
 	for _, role := range roles {
-		if match(role.Clusters, name) {
+		if matchCluster(role, name) {
 			return true
 		}
 	}
@@ -42,7 +83,7 @@ func CanAccessCluster(user model.User, name string) bool {
 func CanAccessNamespace(user model.User, cluster, name string) bool {
 	roles := GetUserRoles(user)
 	for _, role := range roles {
-		if match(role.Clusters, cluster) && match(role.Namespaces, name) {
+		if matchCluster(role, cluster) && match(role.Namespaces, name) {
 			return true
 		}
 	}
@@ -112,6 +153,117 @@ func match(list []string, val string) bool {
 	return false
 }
 
+// matchCommand is like match, but regular expressions must match the whole
+// executable so that e.g. "sh" does not allow "bash". Rules containing "/"
+// match the full path of the executable, other rules only match executables
+// given by name, so that "psql" does not allow "/tmp/psql". Denials also
+// match the base name of executables given by path.
+func matchCommand(list []string, executable string) bool {
+	byPath := strings.Contains(executable, "/")
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if len(v) > 1 && strings.HasPrefix(v, "!") {
+			if v[1:] == executable || (!strings.Contains(v[1:], "/") && v[1:] == path.Base(executable)) {
+				return false
+			}
+			continue
+		}
+		if byPath != strings.Contains(v, "/") && v != "*" {
+			continue
+		}
+		if v == "*" || v == executable {
+			return true
+		}
+		re, err := regexp.Compile("^(?:" + v + ")$")
+		if err != nil {
+			klog.Error(err)
+			continue
+		}
+		if re.MatchString(executable) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCluster checks the cluster names and the cluster selector of a role.
+// Selectors only match registered clusters and never clusters excluded by name.
+func matchCluster(role common.Role, cluster string) bool {
+	if match(role.Clusters, cluster) {
+		return true
+	}
+	if role.ClusterSelector == "" || contains(role.Clusters, "!"+cluster) {
+		return false
+	}
+	known := clusterLabels.Load()
+	if known == nil {
+		return false
+	}
+	set, ok := (*known)[cluster]
+	if !ok {
+		return false
+	}
+	selector, err := roleClusterSelector(role.ClusterSelector)
+	if err != nil {
+		klog.Error(err)
+		return false
+	}
+	return selector.Matches(set)
+}
+
+// ParseClusterSelector parses the cluster selector of a role. Unlike in
+// Kubernetes, != and notin require the label to be set, so that env!=prod
+// does not select a cluster whose env is unknown.
+func ParseClusterSelector(s string) (labels.Selector, error) {
+	selector, err := labels.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	requirements, _ := selector.Requirements()
+	for _, r := range requirements {
+		if r.Operator() != selection.NotEquals && r.Operator() != selection.NotIn {
+			continue
+		}
+		exists, err := labels.NewRequirement(r.Key(), selection.Exists, nil)
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*exists)
+	}
+	return selector, nil
+}
+
+// setClusterSelectors parses the cluster selectors of roles once, invalid
+// selectors match no cluster
+func setClusterSelectors(roles []common.Role) {
+	m := make(map[string]labels.Selector)
+	for _, role := range roles {
+		if role.ClusterSelector == "" {
+			continue
+		}
+		selector, err := ParseClusterSelector(role.ClusterSelector)
+		if err != nil {
+			klog.Warningf("Invalid cluster selector %q of role %s: %v", role.ClusterSelector, role.Name, err)
+			continue
+		}
+		m[role.ClusterSelector] = selector
+	}
+	clusterSelectors.Store(&m)
+}
+
+func roleClusterSelector(s string) (labels.Selector, error) {
+	if m := clusterSelectors.Load(); m != nil {
+		if selector, ok := (*m)[s]; ok {
+			return selector, nil
+		}
+	}
+	// Roles that were not loaded from the database, e.g. set on the user
+	return ParseClusterSelector(s)
+}
+
 func contains(list []string, val string) bool {
 	return slices.Contains(list, val)
 }
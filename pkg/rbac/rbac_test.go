@@ -275,3 +275,138 @@ func TestCanAccess(t *testing.T) {
 		})
 	}
 }
+
+func TestCanExecCommand(t *testing.T) {
+	dbRole := common.Role{
+		Name:       "db-operator",
+		Clusters:   []string{"*"},
+		Resources:  []string{"pods"},
+		Namespaces: []string{"databases"},
+		Verbs:      []string{"exec"},
+		Commands:   []string{"psql", "redis-.*", "!mysql", "!/opt/tools/dump", "/opt/tools/.*"},
+	}
+	legacyRole := common.Role{
+		Name:       "legacy",
+		Clusters:   []string{"*"},
+		Resources:  []string{"*"},
+		Namespaces: []string{"*"},
+		Verbs:      []string{"*"},
+		Commands:   []string{""},
+	}
+
+	tests := []struct {
+		name      string
+		roles     []common.Role
+		namespace string
+		command   []string
+		expected  bool
+	}{
+		{name: "allowed command", roles: []common.Role{dbRole}, namespace: "databases", command: []string{"psql", "-U", "postgres"}, expected: true},
+		{name: "name rule does not match a path", roles: []common.Role{dbRole}, namespace: "databases", command: []string{"/tmp/psql"}, expected: false},
+		{name: "path rule matches the full path", roles: []common.Role{dbRole}, namespace: "databases", command: []string{"/opt/tools/pgcli"}, expected: true},
+		{name: "path rule does not match a name", roles: []common.Role{dbRole}, namespace: "databases", command: []string{"pgcli"}, expected: false},
+		{name: "denied path", roles: []common.Role{dbRole}, namespace: "databases", command: []string{"/opt/tools/dump"}, expected: false},
+		{name: "denied name given by path", roles: []common.Role{dbRole}, namespace: "databases", command: []string{"/usr/bin/mysql"}, expected: false},
+		{name: "regexp must match the whole name", roles: []common.Role{dbRole}, namespace: "databases", command: []string{"redis-cli"}, expected: true},
+		{name: "regexp substring does not match", roles: []common.Role{dbRole}, namespace: "databases", command: []string{"xpsqlx"}, expected: false},
+		{name: "denied command", roles: []common.Role{dbRole}, namespace: "databases", command: []string{"mysql"}, expected: false},
+		{name: "unlisted command", roles: []common.Role{dbRole}, namespace: "databases", command: []string{"bash"}, expected: false},
+		{name: "namespace not granted", roles: []common.Role{dbRole}, namespace: "default", command: []string{"psql"}, expected: false},
+		{name: "empty commands allow nothing", roles: []common.Role{legacyRole}, namespace: "default", command: []string{"psql"}, expected: false},
+		{name: "empty command", roles: []common.Role{dbRole}, namespace: "databases", command: nil, expected: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			RBACConfig = &common.RolesConfig{
+				Roles:       tc.roles,
+				RoleMapping: []common.RoleMapping{{Name: tc.roles[0].Name, Users: []string{"*"}}},
+			}
+			result := CanExecCommand(model.User{Username: "user"}, "cluster", tc.namespace, tc.command)
+			if result != tc.expected {
+				t.Errorf("Expected CanExecCommand to return %v but got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestClusterSelector(t *testing.T) {
+	stagingRole := common.Role{
+		Name:            "staging",
+		Clusters:        []string{"!staging-legacy"},
+		ClusterSelector: "env!=prod,team=payments",
+		Resources:       []string{"*"},
+		Namespaces:      []string{"*"},
+		Verbs:           []string{"get"},
+	}
+	user := model.User{Roles: []common.Role{stagingRole}}
+
+	clusterLabels.Store(nil)
+	if CanAccessCluster(user, "staging-eu") {
+		t.Error("selectors must not match before cluster labels are known")
+	}
+
+	SetClusterLabels(map[string]map[string]string{
+		"staging-eu":     {"env": "staging", "team": "payments"},
+		"prod-eu":        {"env": "prod", "team": "payments"},
+		"staging-other":  {"env": "staging", "team": "search"},
+		"staging-legacy": {"env": "staging", "team": "payments"},
+		"unlabeled":      nil,
+	})
+	t.Cleanup(func() { clusterLabels.Store(nil) })
+
+	tests := []struct {
+		cluster  string
+		expected bool
+	}{
+		{"staging-eu", true},
+		{"prod-eu", false},
+		{"staging-other", false},
+		{"staging-legacy", false},
+		{"unlabeled", false},
+		{"unknown", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.cluster, func(t *testing.T) {
+			if got := CanAccessCluster(user, tc.cluster); got != tc.expected {
+				t.Errorf("CanAccessCluster(%s) = %v, want %v", tc.cluster, got, tc.expected)
+			}
+			if got := CanAccess(user, "pods", "get", tc.cluster, "default"); got != tc.expected {
+				t.Errorf("CanAccess(%s) = %v, want %v", tc.cluster, got, tc.expected)
+			}
+		})
+	}
+}
+
+// TestClusterSelectorNotEquals checks != and notin only select clusters that
+// have the label, an unlabeled cluster may as well be a production cluster
+func TestClusterSelectorNotEquals(t *testing.T) {
+	SetClusterLabels(map[string]map[string]string{
+		"staging":   {"env": "staging"},
+		"prod":      {"env": "prod"},
+		"unlabeled": nil,
+	})
+	t.Cleanup(func() {
+		clusterLabels.Store(nil)
+		clusterSelectors.Store(nil)
+	})
+
+	for _, selector := range []string{"env!=prod", "env notin (prod)"} {
+		role := common.Role{Name: "non-prod", ClusterSelector: selector}
+		setClusterSelectors([]common.Role{role})
+		if _, ok := (*clusterSelectors.Load())[selector]; !ok {
+			t.Fatalf("selector %q was not parsed when the roles were loaded", selector)
+		}
+		user := model.User{Roles: []common.Role{role}}
+		for cluster, want := range map[string]bool{"staging": true, "prod": false, "unlabeled": false} {
+			if got := CanAccessCluster(user, cluster); got != want {
+				t.Errorf("%s: CanAccessCluster(%s) = %v, want %v", selector, cluster, got, want)
+			}
+		}
+	}
+
+	setClusterSelectors([]common.Role{{Name: "invalid", ClusterSelector: "env in prod"}})
+	if len(*clusterSelectors.Load()) != 0 {
+		t.Error("invalid selectors must not be cached")
+	}
+}
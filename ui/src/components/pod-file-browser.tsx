@@ -254,7 +254,15 @@ export function PodFileBrowser({
                           {file.name}
                         </Button>
                       ) : (
-                        <span>{file.name}</span>
+                        <span>
+                          {file.name}
+                          {file.linkTarget && (
+                            <span className="text-muted-foreground">
+                              {' -> '}
+                              {file.linkTarget}
+                            </span>
+                          )}
+                        </span>
                       )}
                     </TableCell>
                     <TableCell className="font-mono text-xs">
@@ -818,6 +818,8 @@ export interface FileInfo {
   mode: string
   uid: string
   gid: string
+  // linkTarget is the target of symbolic links
+  linkTarget?: string
 }
 
 export const podListFiles = async (